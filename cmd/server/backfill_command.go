@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+)
+
+// runBackfillCommand handles "server backfill -model ID [flags]", which
+// reprocesses stored uploads with a model and prints how the predictions
+// changed, and returns the exit code
+func runBackfillCommand(args []string) int {
+	var request models.BackfillRequest
+	var since string
+	var asJSON bool
+	var configArgs []string
+
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.StringVar(&request.ModelID, "model", "", "model to reprocess stored uploads with (required)")
+	fs.IntVar(&request.Limit, "limit", 0, "reprocess at most this many stored uploads (0 for all)")
+	fs.StringVar(&since, "since", "", "only reprocess results processed after this RFC 3339 time")
+	fs.BoolVar(&asJSON, "json", false, "print the full run, including every item, as JSON")
+	fs.Func("config", "path to a YAML or TOML config file", func(value string) error {
+		configArgs = append(configArgs, "-config", value)
+		return nil
+	})
+	fs.Func("set", "override a setting by environment variable name (repeatable)", func(value string) error {
+		configArgs = append(configArgs, "-set", value)
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if request.ModelID == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: server backfill -model ID [-limit N] [-since TIME] [-json] [-config FILE] [-set KEY=VALUE ...]")
+		return 2
+	}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -since: %v\n", err)
+			return 2
+		}
+		request.Since = t
+	}
+
+	cfg, err := config.Load(configArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	// The server's persisted jobs belong to the server, not to this run
+	cfg.Jobs.StateFile = filepath.Join(os.TempDir(), fmt.Sprintf("backfill-jobs-%d.json", os.Getpid()))
+	logger := logging.New(cfg.Logging)
+
+	blobStore, err := services.NewBlobStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create blob store: %v\n", err)
+		return 1
+	}
+	if blobStore == nil {
+		fmt.Fprintln(os.Stderr, "Backfill needs stored uploads, but BLOB_BACKEND is none")
+		return 1
+	}
+
+	imageService := services.NewImageService(cfg, logger)
+	imageService.SetBlobStore(blobStore)
+	modelService := services.NewModelService(cfg, logger)
+	tensorFlowService := services.NewTensorFlowService(cfg, logger)
+	defer tensorFlowService.Close()
+	if err := loadDemoTensorFlowModel(tensorFlowService, cfg); err != nil {
+		logger.Warnf("Failed to load demo TensorFlow model: %v", err)
+	}
+
+	predictionService := services.NewEnhancedPredictionService(modelService, imageService, tensorFlowService, logger)
+	predictionService.SetInferenceLimiter(services.NewInferenceLimiter(cfg))
+	predictionService.SetCircuitBreaker(services.NewCircuitBreaker(cfg))
+	predictionService.SetFallbackPolicy(cfg.Model.FallbackPolicy, cfg.Model.FallbackModel)
+
+	jobService := services.NewJobService(cfg, predictionService, logger)
+	if err := jobService.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start job service: %v\n", err)
+		return 1
+	}
+	defer jobService.Shutdown(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	backfillService := services.NewBackfillService(jobService, modelService, blobStore, logger)
+	run, err := backfillService.Run(ctx, request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(run); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		printBackfillSummary(run)
+	}
+
+	if run.Status != models.StatusCompleted {
+		return 1
+	}
+	return 0
+}
+
+// printBackfillSummary writes the per-class summary of a run as a table
+func printBackfillSummary(run *models.BackfillRun) {
+	if run.Summary == nil {
+		fmt.Printf("Backfill %s %s: %s\n", run.ID, run.Status, run.Error)
+		return
+	}
+
+	summary := run.Summary
+	fmt.Printf("Backfill %s with model %s: %d compared, %d failed, %d label changes, mean confidence shift %+.4f\n\n",
+		run.ID, run.ModelID, summary.Compared, summary.Failed, summary.LabelChanges, summary.MeanConfidenceShift)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLASS\tIMAGES\tLABEL CHANGES\tCONFIDENCE SHIFT\tCHANGED TO")
+	for _, class := range summary.Classes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%+.4f\t%s\n",
+			class.Class, class.Images, class.LabelChanges, class.MeanConfidenceShift, formatCounts(class.ChangedTo))
+	}
+	w.Flush()
+}
+
+// formatCounts formats label counts as "a=2 b=1", most frequent first
+func formatCounts(counts map[string]int) string {
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if counts[labels[i]] != counts[labels[j]] {
+			return counts[labels[i]] > counts[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+
+	var out string
+	for i, label := range labels {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%s=%d", label, counts[label])
+	}
+	return out
+}
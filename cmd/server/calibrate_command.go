@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+)
+
+// runCalibrateCommand handles "server calibrate -model ID -data DIR
+// [flags]", which fits calibration parameters for a model from a labeled
+// validation folder with one subdirectory of images per class, and returns
+// the exit code
+func runCalibrateCommand(args []string) int {
+	var modelID, dataDir, method string
+	var write bool
+	var configArgs []string
+
+	fs := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+	fs.StringVar(&modelID, "model", "", "model to calibrate (required)")
+	fs.StringVar(&dataDir, "data", "", "validation folder with one subdirectory of images per class (required)")
+	fs.StringVar(&method, "method", models.CalibrationTemperature, "calibration method: temperature or platt")
+	fs.BoolVar(&write, "write", false, "store the calibration in the model's metadata.json")
+	fs.Func("config", "path to a YAML or TOML config file", func(value string) error {
+		configArgs = append(configArgs, "-config", value)
+		return nil
+	})
+	fs.Func("set", "override a setting by environment variable name (repeatable)", func(value string) error {
+		configArgs = append(configArgs, "-set", value)
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if modelID == "" || dataDir == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: server calibrate -model ID -data DIR [-method temperature|platt] [-write] [-config FILE] [-set KEY=VALUE ...]")
+		return 2
+	}
+
+	cfg, err := config.Load(configArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	logger := logging.New(cfg.Logging)
+
+	imageService := services.NewImageService(cfg, logger)
+	modelService := services.NewModelService(cfg, logger)
+	tensorFlowService := services.NewTensorFlowService(cfg, logger)
+	defer tensorFlowService.Close()
+	if err := loadDemoTensorFlowModel(tensorFlowService, cfg); err != nil {
+		logger.Warnf("Failed to load demo TensorFlow model: %v", err)
+	}
+	predictionService := services.NewEnhancedPredictionService(modelService, imageService, tensorFlowService, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	classes, samples, skipped, err := collectCalibrationSamples(ctx, predictionService, modelID, dataDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	calibration, err := services.FitCalibration(method, classes, samples)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fit calibration: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Fitted %s calibration for model %s on %d images (%d skipped)\n", method, modelID, len(samples), skipped)
+	if calibration.Method == models.CalibrationTemperature {
+		fmt.Printf("Temperature: %.4f\n", calibration.Temperature)
+	} else {
+		fmt.Printf("Platt parameters for %d of %d classes\n", len(calibration.Platt), len(classes))
+	}
+	fmt.Printf("Expected calibration error: %.4f -> %.4f\n",
+		services.ExpectedCalibrationError(nil, classes, samples),
+		services.ExpectedCalibrationError(calibration, classes, samples))
+
+	if !write {
+		encoded, err := json.MarshalIndent(map[string]*models.Calibration{"calibration": calibration}, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("\nAdd to the model's metadata.json, or rerun with -write:\n%s\n", encoded)
+		return 0
+	}
+
+	metadataPath := filepath.Join(cfg.Model.Path, modelID, "metadata.json")
+	if err := writeCalibration(metadataPath, calibration); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write calibration: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote calibration to %s; it applies when the model is next loaded\n", metadataPath)
+	return 0
+}
+
+// collectCalibrationSamples runs the model over every image in the class
+// subdirectories of dataDir. Images the model cannot score, or whose class
+// the model does not know, are skipped and counted.
+func collectCalibrationSamples(ctx context.Context, predictionService *services.EnhancedPredictionService, modelID, dataDir string) ([]string, []services.CalibrationSample, int, error) {
+	type labeledImage struct {
+		path  string
+		class string
+	}
+
+	classDirs, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read validation folder: %w", err)
+	}
+	var images []labeledImage
+	for _, classDir := range classDirs {
+		if !classDir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(dataDir, classDir.Name()))
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to read class folder: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				images = append(images, labeledImage{filepath.Join(dataDir, classDir.Name(), entry.Name()), classDir.Name()})
+			}
+		}
+	}
+	if len(images) == 0 {
+		return nil, nil, 0, fmt.Errorf("no images found in %s", dataDir)
+	}
+
+	var (
+		mu      sync.Mutex
+		classes []string
+		samples []services.CalibrationSample
+		skipped int
+	)
+	work := make(chan labeledImage)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for image := range work {
+				data, err := os.ReadFile(image.path)
+				var imageClasses []string
+				var probs []float64
+				if err == nil {
+					imageClasses, probs, err = predictionService.RawScores(ctx, data, modelID)
+				}
+				label := slices.Index(imageClasses, image.class)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", image.path, err)
+					skipped++
+				case label < 0:
+					fmt.Fprintf(os.Stderr, "Skipping %s: model has no class %q\n", image.path, image.class)
+					skipped++
+				default:
+					classes = imageClasses
+					samples = append(samples, services.CalibrationSample{Probabilities: probs, Label: label})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, image := range images {
+		select {
+		case work <- image:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("calibration interrupted: %w", err)
+	}
+	return classes, samples, skipped, nil
+}
+
+// writeCalibration sets the calibration in a model's metadata file,
+// keeping its other fields as they are
+func writeCalibration(metadataPath string, calibration *models.Calibration) error {
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return err
+	}
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", metadataPath, err)
+	}
+
+	encoded, err := json.Marshal(calibration)
+	if err != nil {
+		return err
+	}
+	metadata["calibration"] = encoded
+
+	data, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := metadataPath + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, metadataPath)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+)
+
+// runConfigCommand handles "server config print [flags]", which writes the
+// effective configuration with secrets redacted, and returns the exit code
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: server config print [-config FILE] [-set KEY=VALUE ...]")
+		return 2
+	}
+
+	cfg, err := config.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
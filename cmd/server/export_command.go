@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+)
+
+// runExportCommand handles "server export -format FORMAT -o FILE [flags]",
+// which writes stored images with corrected or confident labels to a tar
+// archive for retraining, and returns the exit code
+func runExportCommand(args []string) int {
+	var request models.ExportRequest
+	var since, until, output string
+	var configArgs []string
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.StringVar(&request.Format, "format", models.ExportFormatImageNet, "dataset layout: imagenet, csv, jsonl or coco")
+	fs.StringVar(&output, "o", "", "tar archive to write, or - for standard output (required)")
+	fs.StringVar(&request.ModelID, "model", "", "only export results of this model")
+	fs.Func("label", "only export images with this label (repeatable)", func(value string) error {
+		request.Labels = append(request.Labels, value)
+		return nil
+	})
+	fs.StringVar(&since, "since", "", "only export results processed at or after this RFC 3339 time")
+	fs.StringVar(&until, "until", "", "only export results processed before this RFC 3339 time")
+	fs.Float64Var(&request.MinConfidence, "min-confidence", 0, "confidence unreviewed predictions need to be exported (default 0.9)")
+	fs.StringVar(&request.Feedback, "feedback", models.ExportFeedbackAny, "any, reviewed, corrected, confirmed or unreviewed")
+	fs.IntVar(&request.Limit, "limit", 0, "export at most this many images (0 for all)")
+	fs.Func("config", "path to a YAML or TOML config file", func(value string) error {
+		configArgs = append(configArgs, "-config", value)
+		return nil
+	})
+	fs.Func("set", "override a setting by environment variable name (repeatable)", func(value string) error {
+		configArgs = append(configArgs, "-set", value)
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if output == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: server export -o FILE [-format imagenet|csv|jsonl|coco] [-model ID] [-label L ...] [-since TIME] [-until TIME] [-min-confidence P] [-feedback FILTER] [-limit N] [-config FILE] [-set KEY=VALUE ...]")
+		return 2
+	}
+	for name, value := range map[string]string{"since": since, "until": until} {
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -%s: %v\n", name, err)
+			return 2
+		}
+		if name == "since" {
+			request.Since = t
+		} else {
+			request.Until = t
+		}
+	}
+	if err := services.ValidateExportRequest(&request); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	cfg, err := config.Load(configArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	logger := logging.New(cfg.Logging)
+
+	blobStore, err := services.NewBlobStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create blob store: %v\n", err)
+		return 1
+	}
+	if blobStore == nil {
+		fmt.Fprintln(os.Stderr, "Export needs stored uploads, but BLOB_BACKEND is none")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	exportService := services.NewExportService(blobStore, logger)
+	items, err := exportService.Select(ctx, request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	summary, err := writeExport(ctx, exportService, output, request.Format, items)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	printExportSummary(summary)
+	return 0
+}
+
+// writeExport writes the archive to output. Files are written next to
+// their destination and renamed once complete, so an interrupted export
+// leaves no partial archive behind.
+func writeExport(ctx context.Context, exportService *services.ExportService, output, format string, items []models.ExportItem) (*models.ExportSummary, error) {
+	if output == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		summary, err := exportService.WriteArchive(ctx, w, format, items)
+		if err != nil {
+			return nil, err
+		}
+		return summary, w.Flush()
+	}
+
+	tempPath := output + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempPath)
+
+	w := bufio.NewWriter(file)
+	summary, err := exportService.WriteArchive(ctx, w, format, items)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summary, os.Rename(tempPath, output)
+}
+
+// printExportSummary writes the images exported per label to standard
+// error, keeping standard output free for the archive
+func printExportSummary(summary *models.ExportSummary) {
+	fmt.Fprintf(os.Stderr, "Exported %d images in %s format (%d missing from the blob store)\n",
+		summary.Images, summary.Format, summary.Missing)
+	if len(summary.Labels) > 0 {
+		fmt.Fprintf(os.Stderr, "Labels: %s\n", formatCounts(summary.Labels))
+	}
+}
@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
 	"github.com/francknouama/image-recognition-webapp/internal/handlers"
+	"github.com/francknouama/image-recognition-webapp/internal/health"
+	"github.com/francknouama/image-recognition-webapp/internal/lifecycle"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
+	"github.com/francknouama/image-recognition-webapp/internal/version"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
@@ -20,41 +29,153 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "backfill":
+			os.Exit(runBackfillCommand(os.Args[2:]))
+		case "calibrate":
+			os.Exit(runCalibrateCommand(os.Args[2:]))
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		}
+	}
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Setup logging
-	setupLogging(cfg)
+	logger := logging.New(cfg.Logging)
 
-	logrus.Info("Starting image recognition web application...")
+	logger.WithFields(logrus.Fields{
+		"version": version.Version,
+		"commit":  version.Commit,
+	}).Info("Starting image recognition web application...")
+	metrics.SetBuildInfo(version.Version, version.Commit)
+
+	// Setup tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Fatalf("Failed to setup tracing: %v", err)
+	}
 
 	// Initialize services
-	imageService := services.NewImageService(cfg)
-	modelService := services.NewModelService(cfg)
-	tensorFlowService := services.NewTensorFlowService(cfg)
-	fileManager, err := services.NewFileManager(cfg)
+	imageService := services.NewImageService(cfg, logger)
+	modelService := services.NewModelService(cfg, logger)
+	tensorFlowService := services.NewTensorFlowService(cfg, logger)
+	fileManager, err := services.NewFileManager(cfg, logger)
 	if err != nil {
-		logrus.Fatalf("Failed to create file manager: %v", err)
+		logger.Fatalf("Failed to create file manager: %v", err)
 	}
-	
-	// Ensure all directories exist
-	if err := fileManager.EnsureDirectories(); err != nil {
-		logrus.Errorf("Failed to create directories: %v", err)
+	fileManager.StartPeriodicCleanup()
+
+	// Original uploads and thumbnails are kept for results pages and reprocessing
+	blobStore, err := services.NewBlobStore(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create blob store: %v", err)
+	}
+	if blobStore != nil {
+		imageService.SetBlobStore(blobStore)
+		logger.Infof("Storing uploads in %s blob store", blobStore.Backend())
+
+		// Feedback accuracy survives restarts through the archived results
+		restored, err := modelService.RestoreFeedback(context.Background(), blobStore)
+		if err != nil {
+			logger.Warnf("Failed to restore feedback counts: %v", err)
+		} else if restored > 0 {
+			logger.Infof("Restored feedback from %d archived results", restored)
+		}
 	}
-	
-	// Start periodic cleanup (every hour)
-	fileManager.SetCleanupAge(2 * time.Hour) // Clean files older than 2 hours in development
-	fileManager.StartPeriodicCleanup(1 * time.Hour)
 	
 	// Use enhanced prediction service with TensorFlow support
-	predictionService := services.NewEnhancedPredictionService(modelService, imageService, tensorFlowService)
+	predictionService := services.NewEnhancedPredictionService(modelService, imageService, tensorFlowService, logger)
+	inferenceLimiter := services.NewInferenceLimiter(cfg)
+	predictionService.SetInferenceLimiter(inferenceLimiter)
+	circuitBreaker := services.NewCircuitBreaker(cfg)
+	predictionService.SetCircuitBreaker(circuitBreaker)
+	predictionService.SetFallbackPolicy(cfg.Model.FallbackPolicy, cfg.Model.FallbackModel)
+	if cfg.BatchingEnabled() {
+		predictionService.SetBatchScheduler(services.NewBatchScheduler(cfg, tensorFlowService, logger))
+	}
+	// Candidate models run in the background on live traffic for comparison
+	shadowRunner := services.NewShadowRunner(cfg)
+	predictionService.SetShadowRunner(shadowRunner)
 	
 	// Load a mock TensorFlow model for demonstration
 	if err := loadDemoTensorFlowModel(tensorFlowService, cfg); err != nil {
-		logrus.Warnf("Failed to load demo TensorFlow model: %v", err)
+		logger.Warnf("Failed to load demo TensorFlow model: %v", err)
+	}
+
+	// Async prediction jobs, resuming any persisted by the last shutdown
+	jobService := services.NewJobService(cfg, predictionService, logger)
+	if err := jobService.Start(); err != nil {
+		logger.Fatalf("Failed to start job service: %v", err)
+	}
+
+	// Stored uploads can be reprocessed with another model and exported
+	// as training data
+	var backfillService *services.BackfillService
+	var exportService *services.ExportService
+	if blobStore != nil {
+		backfillService = services.NewBackfillService(jobService, modelService, blobStore, logger)
+		exportService = services.NewExportService(blobStore, logger)
+	}
+
+	// Label sets are served as virtual models next to the loaded ones
+	labelSetService := services.NewLabelSetService(cfg, modelService, predictionService, logger)
+	if err := labelSetService.Load(); err != nil {
+		logger.Fatalf("Failed to load label sets: %v", err)
+	}
+
+	// Readiness covers model loading, writable storage and queue saturation
+	healthChecker := health.New()
+	healthChecker.AddReadinessCheck("models", modelService.CheckReady)
+	healthChecker.AddReadinessCheck("upload_dir", health.WritableDir(cfg.Upload.UploadDir))
+	healthChecker.AddReadinessCheck("temp_dir", health.WritableDir(cfg.Upload.TempDir))
+	switch store := blobStore.(type) {
+	case *services.LocalBlobStore:
+		healthChecker.AddReadinessCheck("blob_dir", health.WritableDir(cfg.Blob.Dir))
+	case *services.S3BlobStore:
+		healthChecker.AddReadinessCheck("blob_bucket", store.CheckReady)
+	}
+	healthChecker.AddReadinessCheck("inference_queue", inferenceLimiter.CheckReady)
+
+	// Rate limits, log level, upload limits, CORS, retention, the model
+	// traffic split and shadow models can be reloaded on SIGHUP or through
+	// the admin API without a restart
+	rateLimiter := rate.NewLimiter(rate.Limit(cfg.Server.RateLimit), cfg.Server.RateBurst)
+	reloader := config.NewReloader(cfg, os.Args[1:], logger)
+	reloader.OnReload("rate_limiter", func(cfg *config.Config) {
+		rateLimiter.SetLimit(rate.Limit(cfg.Server.RateLimit))
+		rateLimiter.SetBurst(cfg.Server.RateBurst)
+	})
+	reloader.OnReload("logger", func(cfg *config.Config) {
+		logging.SetLevel(logger, cfg.Logging.Level)
+	})
+	reloader.OnReload("upload_limits", func(cfg *config.Config) {
+		imageService.SetUploadLimits(cfg.Upload.MaxFileSize, cfg.Upload.AllowedTypes)
+	})
+	reloader.OnReload("file_cleanup", func(cfg *config.Config) {
+		fileManager.Configure(cfg.Upload)
+	})
+	reloader.OnReload("model_routing", func(cfg *config.Config) {
+		modelService.SetRoutingWeights(cfg.Model.RoutingWeights)
+	})
+	reloader.OnReload("shadow_models", func(cfg *config.Config) {
+		shadowRunner.SetModels(cfg.Model.ShadowModels)
+	})
+
+	// Stored images are served through signed, expiring URLs
+	urlSigner, err := services.NewURLSigner(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create URL signer: %v", err)
 	}
 
 	// Initialize handlers
@@ -62,18 +183,34 @@ func main() {
 		ImageService:      imageService,
 		PredictionService: predictionService,
 		ModelService:      modelService,
-		RateLimiter:      rate.NewLimiter(rate.Limit(cfg.Server.RateLimit), cfg.Server.RateBurst),
+		InferenceLimiter:  inferenceLimiter,
+		CircuitBreaker:    circuitBreaker,
+		Health:            healthChecker,
+		JobService:        jobService,
+		BackfillService:   backfillService,
+		LabelSetService:   labelSetService,
+		ExportService:     exportService,
+		ShadowRunner:      shadowRunner,
+		FileManager:       fileManager,
+		Reloader:          reloader,
+		URLSigner:         urlSigner,
+		RateLimiter:      rateLimiter,
+		Logger:           logger,
 	}
 	
 	h := handlers.New(handlerConfig)
 
 	// Setup router
-	router := setupRouter(cfg, h)
+	router := setupRouter(cfg, h, logger)
+	corsHandler := newCORSHandler(cfg.CORS, router)
+	reloader.OnReload("cors", func(cfg *config.Config) {
+		corsHandler.Update(cfg.CORS)
+	})
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:           fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:        router,
+		Handler:        corsHandler,
 		ReadTimeout:    time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout:   time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		IdleTimeout:    time.Duration(cfg.Server.IdleTimeout) * time.Second,
@@ -81,10 +218,23 @@ func main() {
 	}
 
 	// Start server in goroutine
+	healthChecker.MarkStarted()
 	go func() {
-		logrus.Infof("Server starting on port %d", cfg.Server.Port)
+		logger.Infof("Server starting on port %d", cfg.Server.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logrus.Fatalf("Failed to start server: %v", err)
+			logger.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Reload configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logger.Info("Received SIGHUP, reloading configuration")
+			if _, err := reloader.Reload(); err != nil {
+				logger.Errorf("Configuration reload failed: %v", err)
+			}
 		}
 	}()
 
@@ -92,40 +242,46 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	signal.Stop(hup)
 
-	logrus.Info("Shutting down server...")
+	logger.Info("Shutting down server...")
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		logrus.Errorf("Server forced to shutdown: %v", err)
-	}
+	// Drain from the outside in: stop new traffic, let in-flight requests,
+	// predictions and jobs finish, then stop workers and close engines
+	lifecycleManager := lifecycle.New(logger)
+	lifecycleManager.OnShutdown("readiness", func(ctx context.Context) error {
+		healthChecker.SetDraining()
+		select {
+		case <-time.After(time.Duration(cfg.Server.DrainDelay) * time.Second):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	lifecycleManager.OnShutdown("http_server", server.Shutdown)
+	lifecycleManager.OnShutdown("jobs", jobService.Shutdown)
+	lifecycleManager.OnShutdown("inference", predictionService.Drain)
+	lifecycleManager.OnShutdown("file_cleanup", func(ctx context.Context) error {
+		fileManager.Stop()
+		return nil
+	})
+	lifecycleManager.OnShutdown("tensorflow", func(ctx context.Context) error {
+		tensorFlowService.Close()
+		return nil
+	})
+	lifecycleManager.OnShutdown("tracing", lifecycle.StopFunc(shutdownTracing))
 
-	logrus.Info("Server exited")
-}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout)*time.Second)
+	defer cancel()
 
-func setupLogging(cfg *config.Config) {
-	logrus.SetFormatter(&logrus.JSONFormatter{})
-	
-	level, err := logrus.ParseLevel(cfg.Logging.Level)
-	if err != nil {
-		level = logrus.InfoLevel
+	if err := lifecycleManager.Shutdown(ctx); err != nil {
+		logger.Errorf("Shutdown did not complete cleanly: %v", err)
 	}
-	logrus.SetLevel(level)
 
-	if cfg.Logging.Output == "file" && cfg.Logging.File != "" {
-		file, err := os.OpenFile(cfg.Logging.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
-		if err != nil {
-			logrus.Warn("Failed to open log file, using stdout")
-		} else {
-			logrus.SetOutput(file)
-		}
-	}
+	logger.Info("Server exited")
 }
 
-func setupRouter(cfg *config.Config, h *handlers.Handler) http.Handler {
+func setupRouter(cfg *config.Config, h *handlers.Handler, logger *logrus.Logger) *gin.Engine {
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -133,18 +289,13 @@ func setupRouter(cfg *config.Config, h *handlers.Handler) http.Handler {
 	router := gin.New()
 
 	// Middleware
-	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
-
-	// CORS configuration
-	c := cors.New(cors.Options{
-		AllowedOrigins:   cfg.CORS.AllowedOrigins,
-		AllowedMethods:   cfg.CORS.AllowedMethods,
-		AllowedHeaders:   cfg.CORS.AllowedHeaders,
-		ExposedHeaders:   cfg.CORS.ExposedHeaders,
-		AllowCredentials: cfg.CORS.AllowCredentials,
-		MaxAge:           cfg.CORS.MaxAge,
-	})
+	router.Use(tracing.Middleware())
+	router.Use(logging.RequestIDMiddleware())
+	router.Use(logging.AccessLogMiddleware(logger))
+	if cfg.Metrics.Enabled {
+		router.Use(metrics.Middleware())
+	}
 
 	// Static files
 	router.Static("/static", "./web/static")
@@ -152,24 +303,85 @@ func setupRouter(cfg *config.Config, h *handlers.Handler) http.Handler {
 
 	// Health check
 	router.GET("/health", h.HealthCheck)
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+	router.GET("/startupz", h.Startupz)
 	router.GET("/api/health", h.APIHealthCheck)
 
+	// Prometheus metrics
+	if cfg.Metrics.Enabled {
+		router.GET(cfg.Metrics.Path, gin.WrapH(metrics.Handler()))
+	}
+
 	// Main routes
 	router.GET("/", h.Index)
 	router.GET("/upload", h.UploadPage)
-	router.POST("/upload", h.Upload)
+	router.POST("/upload", h.ModelRouting(cfg.Model), h.Upload)
 	router.GET("/results/:id", h.GetResults)
+	router.GET("/results/:id/image", h.ResultImage)
+	router.GET("/results/:id/thumb", h.ResultThumbnail)
+	router.GET("/results/:id/download", h.DownloadResult)
+	router.POST("/results/:id/feedback", h.SubmitFeedback)
 	router.GET("/status", h.StatusPage)
 
 	// API routes
 	api := router.Group("/api")
 	{
-		api.POST("/predict", h.APIPredictImage)
+		api.POST("/predict", h.ModelRouting(cfg.Model), h.APIPredictImage)
 		api.GET("/models", h.APIListModels)
 		api.GET("/results/:id", h.APIGetResults)
+		api.POST("/results/:id/feedback", h.APISubmitFeedback)
+		api.POST("/jobs", h.ModelRouting(cfg.Model), h.APISubmitJob)
+		api.GET("/jobs/:id", h.APIGetJob)
+		api.POST("/label-sets", h.APICreateLabelSet)
+		api.GET("/label-sets", h.APIListLabelSets)
+		api.GET("/label-sets/:id", h.APIGetLabelSet)
+		api.PUT("/label-sets/:id", h.APIUpdateLabelSet)
+		api.DELETE("/label-sets/:id", h.APIDeleteLabelSet)
+	}
+
+	// Admin routes
+	admin := router.Group("/admin", h.AdminAuth(cfg.Server.AdminToken))
+	{
+		admin.POST("/config/reload", h.AdminReloadConfig)
+		admin.POST("/backfill", h.AdminStartBackfill)
+		admin.GET("/backfill/:id", h.AdminGetBackfill)
+		admin.GET("/shadow", h.AdminShadowReport)
+		admin.GET("/export", h.AdminExportDataset)
 	}
 
-	return c.Handler(router)
+	return router
+}
+
+// corsHandler applies CORS in front of the router. The policy can be
+// replaced at runtime when the configuration is reloaded.
+type corsHandler struct {
+	next   http.Handler
+	policy atomic.Pointer[http.Handler]
+}
+
+// newCORSHandler wraps next with the given CORS policy
+func newCORSHandler(cfg config.CORSConfig, next http.Handler) *corsHandler {
+	h := &corsHandler{next: next}
+	h.Update(cfg)
+	return h
+}
+
+// Update replaces the CORS policy
+func (h *corsHandler) Update(cfg config.CORSConfig) {
+	policy := cors.New(cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}).Handler(h.next)
+	h.policy.Store(&policy)
+}
+
+func (h *corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.policy.Load()).ServeHTTP(w, r)
 }
 
 // loadDemoTensorFlowModel loads a demo TensorFlow model for testing
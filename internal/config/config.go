@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
+	"slices"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -12,137 +15,620 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Environment string
-	Server      ServerConfig
-	Model       ModelConfig
-	Upload      UploadConfig
-	CORS        CORSConfig
-	Logging     LoggingConfig
+	Environment string       `yaml:"environment" toml:"environment"`
+	Server      ServerConfig `yaml:"server" toml:"server"`
+	Model       ModelConfig  `yaml:"model" toml:"model"`
+	// Models holds per-model overrides of the model settings, keyed by model ID
+	Models  map[string]ModelOverrides `yaml:"models,omitempty" toml:"models,omitempty"`
+	Upload  UploadConfig              `yaml:"upload" toml:"upload"`
+	Blob    BlobConfig                `yaml:"blob" toml:"blob"`
+	CORS    CORSConfig                `yaml:"cors" toml:"cors"`
+	Logging LoggingConfig             `yaml:"logging" toml:"logging"`
+	Metrics MetricsConfig             `yaml:"metrics" toml:"metrics"`
+	Tracing TracingConfig             `yaml:"tracing" toml:"tracing"`
+	Jobs    JobsConfig                `yaml:"jobs" toml:"jobs"`
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port           int
-	ReadTimeout    int
-	WriteTimeout   int
-	IdleTimeout    int
-	MaxHeaderBytes int
-	RateLimit      float64
-	RateBurst      int
+	Port           int     `yaml:"port" toml:"port"`
+	ReadTimeout    int     `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout   int     `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout    int     `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes int     `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	RateLimit      float64 `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst      int     `yaml:"rate_burst" toml:"rate_burst"`
+	// ShutdownTimeout bounds graceful draining on shutdown in seconds
+	ShutdownTimeout int `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// DrainDelay is how long readiness reports draining before the listener
+	// closes, giving load balancers time to stop routing (seconds)
+	DrainDelay int `yaml:"drain_delay" toml:"drain_delay"`
+	// AdminToken is the bearer token required by the /admin endpoints,
+	// which are disabled while it is empty
+	AdminToken string `yaml:"admin_token" toml:"admin_token" secret:"true"`
+	// URLSigningKey signs the expiring image URLs of results. When empty a
+	// random key is generated, so URLs do not survive a restart.
+	URLSigningKey string `yaml:"url_signing_key" toml:"url_signing_key" secret:"true"`
+	// SignedURLTTL is how long signed image URLs stay valid in seconds
+	SignedURLTTL int `yaml:"signed_url_ttl" toml:"signed_url_ttl"`
 }
 
 // ModelConfig holds model-related configuration
 type ModelConfig struct {
-	Path         string
-	Version      string
-	UpdateURL    string
-	CachePath    string
-	MaxModels    int
-	LoadTimeout  int
+	Path      string `yaml:"path" toml:"path"`
+	Version   string `yaml:"version" toml:"version"`
+	UpdateURL string `yaml:"update_url" toml:"update_url"`
+	// RegistryToken authenticates requests to UpdateURL
+	RegistryToken string `yaml:"registry_token" toml:"registry_token" secret:"true"`
+	CachePath     string `yaml:"cache_path" toml:"cache_path"`
+	MaxModels     int    `yaml:"max_models" toml:"max_models"`
+	LoadTimeout   int    `yaml:"load_timeout" toml:"load_timeout"`
+	// InferenceTimeout is the default per-request inference deadline in milliseconds
+	InferenceTimeout int `yaml:"inference_timeout_ms" toml:"inference_timeout_ms"`
+	// InferenceTimeouts overrides InferenceTimeout per model ID (milliseconds)
+	InferenceTimeouts map[string]int `yaml:"inference_timeouts_ms,omitempty" toml:"inference_timeouts_ms,omitempty"`
+	// MaxConcurrentInferences bounds running inferences per model (0 disables the limiter)
+	MaxConcurrentInferences int `yaml:"max_concurrent_inferences" toml:"max_concurrent_inferences"`
+	// MaxQueuedInferences bounds requests waiting for an inference slot per model
+	MaxQueuedInferences int `yaml:"max_queued_inferences" toml:"max_queued_inferences"`
+	// QueueTimeout is the longest a request may wait for a slot in milliseconds
+	QueueTimeout int `yaml:"queue_timeout_ms" toml:"queue_timeout_ms"`
+	// MaxBatchSize is the most requests run together in one inference batch (1 disables batching)
+	MaxBatchSize int `yaml:"max_batch_size" toml:"max_batch_size"`
+	// BatchWindow is how long a batch collects requests before it runs in milliseconds
+	BatchWindow int `yaml:"batch_window_ms" toml:"batch_window_ms"`
+	// FallbackPolicy decides what happens when the primary engine fails:
+	// "fail", "model" (use FallbackModel) or "simulated" (development only)
+	FallbackPolicy string `yaml:"fallback_policy" toml:"fallback_policy"`
+	// FallbackModel is the model used by the "model" fallback policy
+	FallbackModel string `yaml:"fallback_model" toml:"fallback_model"`
+	// BreakerFailureRate is the engine error rate that opens a model's circuit breaker
+	BreakerFailureRate float64 `yaml:"breaker_failure_rate" toml:"breaker_failure_rate"`
+	// BreakerMinRequests is the fewest calls in the window before the breaker may open
+	BreakerMinRequests int `yaml:"breaker_min_requests" toml:"breaker_min_requests"`
+	// BreakerWindow is the number of recent engine calls the error rate is computed over
+	BreakerWindow int `yaml:"breaker_window" toml:"breaker_window"`
+	// BreakerOpenTimeout is how long an open breaker rejects calls in milliseconds
+	BreakerOpenTimeout int `yaml:"breaker_open_timeout_ms" toml:"breaker_open_timeout_ms"`
+	// BreakerHalfOpenProbes is how many trial calls must succeed to close the breaker
+	BreakerHalfOpenProbes int `yaml:"breaker_half_open_probes" toml:"breaker_half_open_probes"`
+	// RoutingWeights splits requests without a model_id between models by
+	// relative weight; empty sends them all to the default model
+	RoutingWeights map[string]int `yaml:"routing_weights,omitempty" toml:"routing_weights,omitempty"`
+	// RoutingKeyHeader carries the API key that keeps a client on one variant
+	RoutingKeyHeader string `yaml:"routing_key_header" toml:"routing_key_header"`
+	// RoutingCookie keeps browsers without an API key on one variant
+	RoutingCookie string `yaml:"routing_cookie" toml:"routing_cookie"`
+	// RoutingOverrideHeader names the model a request is routed to, bypassing the split
+	RoutingOverrideHeader string `yaml:"routing_override_header" toml:"routing_override_header"`
+	// ShadowModels are candidate models run in the background on live
+	// traffic and compared with the model that served the response
+	ShadowModels []string `yaml:"shadow_models" toml:"shadow_models"`
+	// ShadowMaxConcurrent bounds running shadow inferences; requests beyond it are not shadowed
+	ShadowMaxConcurrent int `yaml:"shadow_max_concurrent" toml:"shadow_max_concurrent"`
+	// LabelSetsFile persists the label sets served as virtual models
+	LabelSetsFile string `yaml:"label_sets_file" toml:"label_sets_file"`
 }
 
+// ModelOverrides holds the settings of a single model. Unset fields
+// inherit the global model configuration.
+type ModelOverrides struct {
+	InferenceTimeout        *int `yaml:"inference_timeout_ms,omitempty" toml:"inference_timeout_ms,omitempty"`
+	MaxConcurrentInferences *int `yaml:"max_concurrent_inferences,omitempty" toml:"max_concurrent_inferences,omitempty"`
+	MaxQueuedInferences     *int `yaml:"max_queued_inferences,omitempty" toml:"max_queued_inferences,omitempty"`
+	QueueTimeout            *int `yaml:"queue_timeout_ms,omitempty" toml:"queue_timeout_ms,omitempty"`
+	MaxBatchSize            *int `yaml:"max_batch_size,omitempty" toml:"max_batch_size,omitempty"`
+	BatchWindow             *int `yaml:"batch_window_ms,omitempty" toml:"batch_window_ms,omitempty"`
+}
+
+// Engine fallback policies
+const (
+	FallbackPolicyFail      = "fail"
+	FallbackPolicyModel     = "model"
+	FallbackPolicySimulated = "simulated"
+)
+
 // UploadConfig holds upload-related configuration
 type UploadConfig struct {
-	MaxFileSize   int64
-	AllowedTypes  []string
-	UploadDir     string
-	TempDir       string
-	CleanupAfter  int
+	MaxFileSize  int64    `yaml:"max_file_size" toml:"max_file_size"`
+	AllowedTypes []string `yaml:"allowed_types" toml:"allowed_types"`
+	UploadDir    string   `yaml:"upload_dir" toml:"upload_dir"`
+	TempDir      string   `yaml:"temp_dir" toml:"temp_dir"`
+	// CleanupAfter is how long files are kept in TempDir in seconds (0 keeps them)
+	CleanupAfter int `yaml:"cleanup_after" toml:"cleanup_after"`
+	// UploadRetention is how long files are kept in UploadDir in seconds (0 keeps them)
+	UploadRetention int `yaml:"upload_retention" toml:"upload_retention"`
+	// MaxDiskUsage caps the bytes stored across TempDir and UploadDir,
+	// evicting the oldest files first (0 disables the cap)
+	MaxDiskUsage int64 `yaml:"max_disk_usage" toml:"max_disk_usage"`
+	// CleanupInterval is how often retention is enforced in seconds
+	CleanupInterval int `yaml:"cleanup_interval" toml:"cleanup_interval"`
+	// CleanupDryRun logs what cleanup would remove without deleting anything
+	CleanupDryRun bool `yaml:"cleanup_dry_run" toml:"cleanup_dry_run"`
+}
+
+// Blob store backends
+const (
+	BlobBackendNone  = "none"
+	BlobBackendLocal = "local"
+	BlobBackendS3    = "s3"
+)
+
+// BlobConfig holds configuration for the store that keeps original uploads
+// and their thumbnails
+type BlobConfig struct {
+	// Backend is "local", "s3" or "none" (uploads are not kept, the default).
+	// Stored blobs are never cleaned up, so storage is opt-in.
+	Backend string `yaml:"backend" toml:"backend"`
+	// Dir is the root directory of the local backend
+	Dir string `yaml:"dir" toml:"dir"`
+	// ThumbnailSize is the bounding box of stored thumbnails in pixels
+	ThumbnailSize int `yaml:"thumbnail_size" toml:"thumbnail_size"`
+	// S3Endpoint is the base URL of an S3-compatible service, e.g.
+	// https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	S3Endpoint  string `yaml:"s3_endpoint" toml:"s3_endpoint"`
+	S3Bucket    string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3Region    string `yaml:"s3_region" toml:"s3_region"`
+	S3AccessKey string `yaml:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key" toml:"s3_secret_key" secret:"true"`
 }
 
 // CORSConfig holds CORS-related configuration
 type CORSConfig struct {
-	AllowedOrigins   []string
-	AllowedMethods   []string
-	AllowedHeaders   []string
-	ExposedHeaders   []string
-	AllowCredentials bool
-	MaxAge           int
+	AllowedOrigins   []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers" toml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers" toml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age" toml:"max_age"`
 }
 
 // LoggingConfig holds logging-related configuration
 type LoggingConfig struct {
-	Level  string
-	Output string
-	File   string
+	Level  string `yaml:"level" toml:"level"`
+	Output string `yaml:"output" toml:"output"`
+	File   string `yaml:"file" toml:"file"`
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Path    string `yaml:"path" toml:"path"`
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	File        string  `yaml:"file" toml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+}
+
+// JobsConfig holds async prediction job configuration
+type JobsConfig struct {
+	Workers   int `yaml:"workers" toml:"workers"`
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+	// StateFile is where unfinished jobs are persisted on shutdown
+	StateFile string `yaml:"state_file" toml:"state_file"`
+}
+
+// Load resolves the configuration from args and creates the directories it
+// names. See Parse for how the sources are layered.
+func Load(args []string) (*Config, error) {
+	config, err := Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createDirectories(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Parse resolves the configuration without side effects. Sources are
+// layered in increasing precedence: built-in defaults, the config file
+// (-config or CONFIG_FILE, YAML or TOML), environment variables, and
+// -set KEY=VALUE flags, where KEY is the environment variable name.
+// Malformed values are reported together rather than one at a time.
+func Parse(args []string) (*Config, error) {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
 		logrus.Debug("No .env file found, using environment variables")
 	}
 
-	config := &Config{
-		Environment: getEnv("ENVIRONMENT", "development"),
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaults()
+
+	configFile := flags.configFile
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+	if configFile != "" {
+		if err := loadFile(configFile, config); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	errs = append(errs, bind(config, envSource{})...)
+	errs = append(errs, bind(config, flags.overrides)...)
+	errs = append(errs, flags.overrides.unused()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration values: %w", errors.Join(errs...))
+	}
+
+	// Simulated fallback is a development convenience; elsewhere fail loudly
+	if config.Model.FallbackPolicy == "" {
+		config.Model.FallbackPolicy = FallbackPolicyFail
+		if config.IsDevelopment() {
+			config.Model.FallbackPolicy = FallbackPolicySimulated
+		}
+	}
+
+	// Validate configuration
+	if err := validateConfig(config); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	return config, nil
+}
+
+// defaults returns the built-in configuration
+func defaults() *Config {
+	return &Config{
+		Environment: "development",
 		Server: ServerConfig{
-			Port:           getEnvAsInt("PORT", 8080),
-			ReadTimeout:    getEnvAsInt("READ_TIMEOUT", 30),
-			WriteTimeout:   getEnvAsInt("WRITE_TIMEOUT", 30),
-			IdleTimeout:    getEnvAsInt("IDLE_TIMEOUT", 120),
-			MaxHeaderBytes: getEnvAsInt("MAX_HEADER_BYTES", 1048576), // 1MB
-			RateLimit:      getEnvAsFloat64("RATE_LIMIT", 10.0),
-			RateBurst:      getEnvAsInt("RATE_BURST", 20),
+			Port:           8080,
+			ReadTimeout:    30,
+			WriteTimeout:   30,
+			IdleTimeout:    120,
+			MaxHeaderBytes: 1048576, // 1MB
+			RateLimit:      10.0,
+			RateBurst:      20,
+
+			ShutdownTimeout: 30,
+			DrainDelay:      0,
+			SignedURLTTL:    3600,
 		},
 		Model: ModelConfig{
-			Path:        getEnv("MODEL_PATH", "./models"),
-			Version:     getEnv("MODEL_VERSION", "latest"),
-			UpdateURL:   getEnv("MODEL_UPDATE_URL", ""),
-			CachePath:   getEnv("MODEL_CACHE_PATH", "./cache/models"),
-			MaxModels:   getEnvAsInt("MAX_MODELS", 3),
-			LoadTimeout: getEnvAsInt("MODEL_LOAD_TIMEOUT", 60),
+			Path:              "./models",
+			Version:           "latest",
+			CachePath:         "./cache/models",
+			MaxModels:         3,
+			LoadTimeout:       60,
+			InferenceTimeout:  10000,
+			InferenceTimeouts: map[string]int{},
+
+			MaxConcurrentInferences: 4,
+			MaxQueuedInferences:     16,
+			QueueTimeout:            2000,
+			MaxBatchSize:            8,
+			BatchWindow:             5,
+
+			RoutingWeights:        map[string]int{},
+			RoutingKeyHeader:      "X-API-Key",
+			RoutingCookie:         "model_variant",
+			RoutingOverrideHeader: "X-Model-Variant",
+			ShadowMaxConcurrent:   2,
+			LabelSetsFile:         "./data/label_sets.json",
+
+			BreakerFailureRate:    0.5,
+			BreakerMinRequests:    10,
+			BreakerWindow:         20,
+			BreakerOpenTimeout:    30000,
+			BreakerHalfOpenProbes: 3,
 		},
 		Upload: UploadConfig{
-			MaxFileSize:  getEnvAsInt64("MAX_FILE_SIZE", 10485760), // 10MB
-			AllowedTypes: getEnvAsSlice("ALLOWED_TYPES", []string{"image/jpeg", "image/png", "image/webp"}),
-			UploadDir:    getEnv("UPLOAD_DIR", "./uploads"),
-			TempDir:      getEnv("TEMP_DIR", "./temp"),
-			CleanupAfter: getEnvAsInt("CLEANUP_AFTER", 3600), // 1 hour
+			MaxFileSize:  10485760, // 10MB
+			AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+			UploadDir:    "./uploads",
+			TempDir:      "./temp",
+			CleanupAfter: 3600, // 1 hour
+
+			UploadRetention: 86400, // 24 hours
+			CleanupInterval: 3600,
+		},
+		Blob: BlobConfig{
+			Backend:       BlobBackendNone,
+			Dir:           "./data/blobs",
+			ThumbnailSize: 256,
+			S3Region:      "us-east-1",
 		},
 		CORS: CORSConfig{
-			AllowedOrigins:   getEnvAsSlice("CORS_ALLOWED_ORIGINS", []string{"*"}),
-			AllowedMethods:   getEnvAsSlice("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-			AllowedHeaders:   getEnvAsSlice("CORS_ALLOWED_HEADERS", []string{"*"}),
-			ExposedHeaders:   getEnvAsSlice("CORS_EXPOSED_HEADERS", []string{}),
-			AllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
-			MaxAge:           getEnvAsInt("CORS_MAX_AGE", 86400), // 24 hours
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"*"},
+			ExposedHeaders: []string{"X-Request-ID"},
+			MaxAge:         86400, // 24 hours
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Output: getEnv("LOG_OUTPUT", "stdout"),
-			File:   getEnv("LOG_FILE", ""),
+			Level:  "info",
+			Output: "stdout",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "./logs/traces.json",
+			SampleRatio: 1.0,
+			ServiceName: "image-recognition-webapp",
+		},
+		Jobs: JobsConfig{
+			Workers:   2,
+			QueueSize: 100,
+			StateFile: "./data/jobs.json",
 		},
 	}
+}
 
-	// Validate configuration
-	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("configuration validation failed: %w", err)
-	}
+// bind applies the values src provides to config, keyed by environment
+// variable name
+func bind(config *Config, src source) []error {
+	b := &binder{src: src}
 
-	return config, nil
+	b.string("ENVIRONMENT", &config.Environment)
+
+	b.int("PORT", &config.Server.Port)
+	b.int("READ_TIMEOUT", &config.Server.ReadTimeout)
+	b.int("WRITE_TIMEOUT", &config.Server.WriteTimeout)
+	b.int("IDLE_TIMEOUT", &config.Server.IdleTimeout)
+	b.int("MAX_HEADER_BYTES", &config.Server.MaxHeaderBytes)
+	b.float64("RATE_LIMIT", &config.Server.RateLimit)
+	b.int("RATE_BURST", &config.Server.RateBurst)
+	b.int("SHUTDOWN_TIMEOUT", &config.Server.ShutdownTimeout)
+	b.int("SHUTDOWN_DRAIN_DELAY", &config.Server.DrainDelay)
+	b.string("ADMIN_TOKEN", &config.Server.AdminToken)
+	b.string("URL_SIGNING_KEY", &config.Server.URLSigningKey)
+	b.int("SIGNED_URL_TTL", &config.Server.SignedURLTTL)
+
+	b.string("MODEL_PATH", &config.Model.Path)
+	b.string("MODEL_VERSION", &config.Model.Version)
+	b.string("MODEL_UPDATE_URL", &config.Model.UpdateURL)
+	b.string("MODEL_REGISTRY_TOKEN", &config.Model.RegistryToken)
+	b.string("MODEL_CACHE_PATH", &config.Model.CachePath)
+	b.int("MAX_MODELS", &config.Model.MaxModels)
+	b.int("MODEL_LOAD_TIMEOUT", &config.Model.LoadTimeout)
+	b.int("MODEL_INFERENCE_TIMEOUT_MS", &config.Model.InferenceTimeout)
+	b.intMap("MODEL_INFERENCE_TIMEOUTS_MS", &config.Model.InferenceTimeouts)
+	b.int("MAX_CONCURRENT_INFERENCES", &config.Model.MaxConcurrentInferences)
+	b.int("MAX_QUEUED_INFERENCES", &config.Model.MaxQueuedInferences)
+	b.int("INFERENCE_QUEUE_TIMEOUT_MS", &config.Model.QueueTimeout)
+	b.int("INFERENCE_MAX_BATCH_SIZE", &config.Model.MaxBatchSize)
+	b.int("INFERENCE_BATCH_WINDOW_MS", &config.Model.BatchWindow)
+	b.string("MODEL_FALLBACK_POLICY", &config.Model.FallbackPolicy)
+	b.string("MODEL_FALLBACK_MODEL", &config.Model.FallbackModel)
+	b.float64("BREAKER_FAILURE_RATE", &config.Model.BreakerFailureRate)
+	b.int("BREAKER_MIN_REQUESTS", &config.Model.BreakerMinRequests)
+	b.int("BREAKER_WINDOW", &config.Model.BreakerWindow)
+	b.int("BREAKER_OPEN_TIMEOUT_MS", &config.Model.BreakerOpenTimeout)
+	b.int("BREAKER_HALF_OPEN_PROBES", &config.Model.BreakerHalfOpenProbes)
+	b.intMap("MODEL_ROUTING_WEIGHTS", &config.Model.RoutingWeights)
+	b.string("MODEL_ROUTING_KEY_HEADER", &config.Model.RoutingKeyHeader)
+	b.string("MODEL_ROUTING_COOKIE", &config.Model.RoutingCookie)
+	b.string("MODEL_ROUTING_OVERRIDE_HEADER", &config.Model.RoutingOverrideHeader)
+	b.slice("MODEL_SHADOW_MODELS", &config.Model.ShadowModels)
+	b.int("MODEL_SHADOW_MAX_CONCURRENT", &config.Model.ShadowMaxConcurrent)
+	b.string("MODEL_LABEL_SETS_FILE", &config.Model.LabelSetsFile)
+
+	b.int64("MAX_FILE_SIZE", &config.Upload.MaxFileSize)
+	b.slice("ALLOWED_TYPES", &config.Upload.AllowedTypes)
+	b.string("UPLOAD_DIR", &config.Upload.UploadDir)
+	b.string("TEMP_DIR", &config.Upload.TempDir)
+	b.int("CLEANUP_AFTER", &config.Upload.CleanupAfter)
+	b.int("UPLOAD_RETENTION", &config.Upload.UploadRetention)
+	b.int64("MAX_DISK_USAGE", &config.Upload.MaxDiskUsage)
+	b.int("CLEANUP_INTERVAL", &config.Upload.CleanupInterval)
+	b.bool("CLEANUP_DRY_RUN", &config.Upload.CleanupDryRun)
+
+	b.string("BLOB_BACKEND", &config.Blob.Backend)
+	b.string("BLOB_DIR", &config.Blob.Dir)
+	b.int("BLOB_THUMBNAIL_SIZE", &config.Blob.ThumbnailSize)
+	b.string("BLOB_S3_ENDPOINT", &config.Blob.S3Endpoint)
+	b.string("BLOB_S3_BUCKET", &config.Blob.S3Bucket)
+	b.string("BLOB_S3_REGION", &config.Blob.S3Region)
+	b.string("BLOB_S3_ACCESS_KEY", &config.Blob.S3AccessKey)
+	b.string("BLOB_S3_SECRET_KEY", &config.Blob.S3SecretKey)
+
+	b.slice("CORS_ALLOWED_ORIGINS", &config.CORS.AllowedOrigins)
+	b.slice("CORS_ALLOWED_METHODS", &config.CORS.AllowedMethods)
+	b.slice("CORS_ALLOWED_HEADERS", &config.CORS.AllowedHeaders)
+	b.slice("CORS_EXPOSED_HEADERS", &config.CORS.ExposedHeaders)
+	b.bool("CORS_ALLOW_CREDENTIALS", &config.CORS.AllowCredentials)
+	b.int("CORS_MAX_AGE", &config.CORS.MaxAge)
+
+	b.string("LOG_LEVEL", &config.Logging.Level)
+	b.string("LOG_OUTPUT", &config.Logging.Output)
+	b.string("LOG_FILE", &config.Logging.File)
+
+	b.bool("METRICS_ENABLED", &config.Metrics.Enabled)
+	b.string("METRICS_PATH", &config.Metrics.Path)
+
+	b.string("TRACING_EXPORTER", &config.Tracing.Exporter)
+	b.string("OTEL_EXPORTER_OTLP_ENDPOINT", &config.Tracing.Endpoint)
+	b.string("TRACING_FILE", &config.Tracing.File)
+	b.float64("TRACING_SAMPLE_RATIO", &config.Tracing.SampleRatio)
+	b.string("OTEL_SERVICE_NAME", &config.Tracing.ServiceName)
+
+	b.int("JOB_WORKERS", &config.Jobs.Workers)
+	b.int("JOB_QUEUE_SIZE", &config.Jobs.QueueSize)
+	b.string("JOB_STATE_FILE", &config.Jobs.StateFile)
+
+	return b.errs
 }
 
-// validateConfig validates the loaded configuration
+// validateConfig validates the loaded configuration, reporting every
+// problem found
 func validateConfig(config *Config) error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
 	if config.Server.Port < 1 || config.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+		invalid("invalid server port: %d", config.Server.Port)
+	}
+
+	if config.Server.RateLimit <= 0 || config.Server.RateBurst < 1 {
+		invalid("invalid rate limit: rate=%f burst=%d", config.Server.RateLimit, config.Server.RateBurst)
+	}
+
+	if config.Server.SignedURLTTL < 1 {
+		invalid("invalid signed URL TTL: %d", config.Server.SignedURLTTL)
 	}
 
 	if config.Upload.MaxFileSize <= 0 {
-		return fmt.Errorf("invalid max file size: %d", config.Upload.MaxFileSize)
+		invalid("invalid max file size: %d", config.Upload.MaxFileSize)
 	}
 
 	if len(config.Upload.AllowedTypes) == 0 {
-		return fmt.Errorf("no allowed file types specified")
+		invalid("no allowed file types specified")
+	}
+
+	if config.Upload.CleanupAfter < 0 || config.Upload.UploadRetention < 0 ||
+		config.Upload.MaxDiskUsage < 0 || config.Upload.CleanupInterval < 1 {
+		invalid("invalid cleanup settings: cleanup_after=%d upload_retention=%d max_disk_usage=%d interval=%d",
+			config.Upload.CleanupAfter, config.Upload.UploadRetention,
+			config.Upload.MaxDiskUsage, config.Upload.CleanupInterval)
+	}
+
+	switch config.Blob.Backend {
+	case BlobBackendNone:
+	case BlobBackendLocal:
+		if config.Blob.Dir == "" {
+			invalid("blob backend %q requires BLOB_DIR", BlobBackendLocal)
+		}
+	case BlobBackendS3:
+		if config.Blob.S3Endpoint == "" || config.Blob.S3Bucket == "" || config.Blob.S3Region == "" {
+			invalid("blob backend %q requires BLOB_S3_ENDPOINT, BLOB_S3_BUCKET and BLOB_S3_REGION", BlobBackendS3)
+		} else if u, err := url.Parse(config.Blob.S3Endpoint); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https") {
+			invalid("invalid S3 endpoint: %s", config.Blob.S3Endpoint)
+		}
+	default:
+		invalid("invalid blob backend: %s", config.Blob.Backend)
+	}
+
+	if config.Blob.ThumbnailSize < 1 {
+		invalid("invalid thumbnail size: %d", config.Blob.ThumbnailSize)
+	}
+
+	if _, err := logrus.ParseLevel(config.Logging.Level); err != nil {
+		invalid("invalid log level: %s", config.Logging.Level)
+	}
+
+	if config.Model.InferenceTimeout < 0 {
+		invalid("invalid inference timeout: %d", config.Model.InferenceTimeout)
+	}
+
+	for modelID, timeout := range config.Model.InferenceTimeouts {
+		if timeout < 0 {
+			invalid("invalid inference timeout for model %s: %d", modelID, timeout)
+		}
+	}
+
+	if config.Model.MaxConcurrentInferences < 0 || config.Model.MaxQueuedInferences < 0 || config.Model.QueueTimeout < 0 {
+		invalid("invalid inference concurrency limits: concurrent=%d queued=%d timeout=%d",
+			config.Model.MaxConcurrentInferences, config.Model.MaxQueuedInferences, config.Model.QueueTimeout)
+	}
+
+	if config.Model.MaxBatchSize < 0 || config.Model.BatchWindow < 0 {
+		invalid("invalid inference batching: size=%d window=%d",
+			config.Model.MaxBatchSize, config.Model.BatchWindow)
+	}
+
+	for _, modelID := range slices.Sorted(maps.Keys(config.Models)) {
+		overrides := config.Models[modelID]
+		for name, value := range map[string]*int{
+			"inference_timeout_ms":      overrides.InferenceTimeout,
+			"max_concurrent_inferences": overrides.MaxConcurrentInferences,
+			"max_queued_inferences":     overrides.MaxQueuedInferences,
+			"queue_timeout_ms":          overrides.QueueTimeout,
+			"max_batch_size":            overrides.MaxBatchSize,
+			"batch_window_ms":           overrides.BatchWindow,
+		} {
+			if value != nil && *value < 0 {
+				invalid("invalid %s for model %s: %d", name, modelID, *value)
+			}
+		}
+	}
+
+	switch config.Model.FallbackPolicy {
+	case FallbackPolicyFail:
+	case FallbackPolicyModel:
+		if config.Model.FallbackModel == "" {
+			invalid("fallback policy %q requires MODEL_FALLBACK_MODEL", FallbackPolicyModel)
+		}
+	case FallbackPolicySimulated:
+		if !config.IsDevelopment() {
+			invalid("fallback policy %q is only allowed in development", FallbackPolicySimulated)
+		}
+	default:
+		invalid("invalid fallback policy: %s", config.Model.FallbackPolicy)
+	}
+
+	if config.Model.BreakerFailureRate <= 0 || config.Model.BreakerFailureRate > 1 {
+		invalid("invalid circuit breaker failure rate: %f", config.Model.BreakerFailureRate)
+	}
+
+	if config.Model.BreakerWindow < 1 || config.Model.BreakerMinRequests < 1 ||
+		config.Model.BreakerOpenTimeout < 0 || config.Model.BreakerHalfOpenProbes < 1 {
+		invalid("invalid circuit breaker settings: window=%d min_requests=%d open_timeout=%d half_open_probes=%d",
+			config.Model.BreakerWindow, config.Model.BreakerMinRequests,
+			config.Model.BreakerOpenTimeout, config.Model.BreakerHalfOpenProbes)
+	}
+
+	totalWeight := 0
+	for modelID, weight := range config.Model.RoutingWeights {
+		if weight < 0 {
+			invalid("invalid routing weight for model %s: %d", modelID, weight)
+		}
+		totalWeight += weight
+	}
+	if len(config.Model.RoutingWeights) > 0 && totalWeight == 0 {
+		invalid("routing weights must route some traffic")
+	}
+
+	if config.Model.ShadowMaxConcurrent < 1 {
+		invalid("invalid shadow concurrency: %d", config.Model.ShadowMaxConcurrent)
+	}
+
+	if config.Server.ShutdownTimeout < 0 || config.Server.DrainDelay < 0 {
+		invalid("invalid shutdown timing: timeout=%d drain_delay=%d",
+			config.Server.ShutdownTimeout, config.Server.DrainDelay)
+	}
+
+	if config.Jobs.Workers < 1 || config.Jobs.QueueSize < 1 {
+		invalid("invalid job settings: workers=%d queue_size=%d", config.Jobs.Workers, config.Jobs.QueueSize)
+	}
+
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		invalid("invalid tracing sample ratio: %f", config.Tracing.SampleRatio)
 	}
 
-	// Create necessary directories
+	return errors.Join(errs...)
+}
+
+// createDirectories creates the directories named by the configuration
+func createDirectories(config *Config) error {
 	dirs := []string{
 		config.Upload.UploadDir,
 		config.Upload.TempDir,
 		config.Model.Path,
 		config.Model.CachePath,
+		filepath.Dir(config.Jobs.StateFile),
+		filepath.Dir(config.Model.LabelSetsFile),
+	}
+	if config.Blob.Backend == BlobBackendLocal {
+		dirs = append(dirs, config.Blob.Dir)
 	}
 
 	for _, dir := range dirs {
@@ -154,56 +640,47 @@ func validateConfig(config *Config) error {
 	return nil
 }
 
-// Helper functions for environment variable parsing
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// ForModel returns the model settings in effect for modelID, with its
+// per-model overrides applied over the global model configuration
+func (c *Config) ForModel(modelID string) ModelConfig {
+	settings := c.Model
+	if ms, ok := c.Model.InferenceTimeouts[modelID]; ok {
+		settings.InferenceTimeout = ms
 	}
-	return defaultValue
-}
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
+	overrides, ok := c.Models[modelID]
+	if !ok {
+		return settings
 	}
-	return defaultValue
-}
-
-func getEnvAsInt64(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intValue
+	for _, o := range []struct {
+		value  *int
+		target *int
+	}{
+		{overrides.InferenceTimeout, &settings.InferenceTimeout},
+		{overrides.MaxConcurrentInferences, &settings.MaxConcurrentInferences},
+		{overrides.MaxQueuedInferences, &settings.MaxQueuedInferences},
+		{overrides.QueueTimeout, &settings.QueueTimeout},
+		{overrides.MaxBatchSize, &settings.MaxBatchSize},
+		{overrides.BatchWindow, &settings.BatchWindow},
+	} {
+		if o.value != nil {
+			*o.target = *o.value
 		}
 	}
-	return defaultValue
+	return settings
 }
 
-func getEnvAsFloat64(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatValue
-		}
+// BatchingEnabled reports whether any model batches inference requests
+func (c *Config) BatchingEnabled() bool {
+	if c.Model.MaxBatchSize > 1 {
+		return true
 	}
-	return defaultValue
-}
-
-func getEnvAsBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+	for modelID := range c.Models {
+		if c.ForModel(modelID).MaxBatchSize > 1 {
+			return true
 		}
 	}
-	return defaultValue
-}
-
-func getEnvAsSlice(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
-		return strings.Split(value, ",")
-	}
-	return defaultValue
+	return false
 }
 
 // IsDevelopment returns true if the environment is development
@@ -214,4 +691,4 @@ func (c *Config) IsDevelopment() bool {
 // IsProduction returns true if the environment is production
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
-}
\ No newline at end of file
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestParseLayering(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+server:
+  port: 9000
+  rate_limit: 5
+logging:
+  level: debug
+`)
+
+	// File overrides defaults
+	cfg, err := Parse([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.RateLimit != 5 || cfg.Logging.Level != "debug" {
+		t.Errorf("Expected file values, got port=%d rate=%f level=%s", cfg.Server.Port, cfg.Server.RateLimit, cfg.Logging.Level)
+	}
+	if cfg.Server.RateBurst != 20 {
+		t.Errorf("Expected default rate burst 20, got %d", cfg.Server.RateBurst)
+	}
+
+	// Environment overrides the file, flags override the environment
+	t.Setenv("PORT", "9100")
+	t.Setenv("LOG_LEVEL", "warn")
+	cfg, err = Parse([]string{"-config", path, "-set", "PORT=9200"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Server.Port != 9200 {
+		t.Errorf("Expected flag port 9200, got %d", cfg.Server.Port)
+	}
+	if cfg.Logging.Level != "warn" {
+		t.Errorf("Expected env log level 'warn', got '%s'", cfg.Logging.Level)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[server]
+port = 9300
+
+[models.resnet50]
+inference_timeout_ms = 500
+max_batch_size = 16
+`)
+
+	cfg, err := Parse([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Server.Port != 9300 {
+		t.Errorf("Expected port 9300, got %d", cfg.Server.Port)
+	}
+
+	settings := cfg.ForModel("resnet50")
+	if settings.InferenceTimeout != 500 || settings.MaxBatchSize != 16 {
+		t.Errorf("Expected per-model overrides, got timeout=%d batch=%d", settings.InferenceTimeout, settings.MaxBatchSize)
+	}
+	if settings.MaxConcurrentInferences != cfg.Model.MaxConcurrentInferences {
+		t.Errorf("Expected unset fields to inherit, got concurrency %d", settings.MaxConcurrentInferences)
+	}
+	if other := cfg.ForModel("other"); other.InferenceTimeout != cfg.Model.InferenceTimeout {
+		t.Errorf("Expected models without a section to use the global timeout, got %d", other.InferenceTimeout)
+	}
+}
+
+func TestParseAggregatesErrors(t *testing.T) {
+	t.Setenv("PORT", "80a")
+	t.Setenv("RATE_LIMIT", "fast")
+	t.Setenv("METRICS_ENABLED", "maybe")
+
+	_, err := Parse(nil)
+	if err == nil {
+		t.Fatal("Expected error for malformed values")
+	}
+	for _, key := range []string{"PORT", "RATE_LIMIT", "METRICS_ENABLED"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error to mention %s, got: %v", key, err)
+		}
+	}
+}
+
+func TestParseValidationErrors(t *testing.T) {
+	t.Setenv("PORT", "70000")
+	t.Setenv("JOB_WORKERS", "0")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("MODEL_ROUTING_WEIGHTS", "a=0,b=0")
+
+	_, err := Parse(nil)
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"invalid server port", "invalid job settings", "invalid log level", "routing weights"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  prot: 9000\n")
+	if _, err := Parse([]string{"-config", path}); err == nil {
+		t.Error("Expected error for unknown config file key")
+	}
+
+	if _, err := Parse([]string{"-set", "NOT_A_SETTING=1"}); err == nil {
+		t.Error("Expected error for unknown -set key")
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("MODEL_REGISTRY_TOKEN", "s3cr3t")
+
+	cfg, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Error("Expected secret to be redacted")
+	}
+	if !strings.Contains(out.String(), redactedValue) {
+		t.Errorf("Expected redaction marker in output:\n%s", out.String())
+	}
+	if cfg.Model.RegistryToken != "s3cr3t" {
+		t.Error("Expected Print to leave the configuration unchanged")
+	}
+
+	// Printed output round-trips as a config file
+	path := writeConfigFile(t, "printed.yaml", out.String())
+	if _, err := Parse([]string{"-config", path}); err != nil {
+		t.Errorf("Expected printed config to load, got: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue replaces secret values in printed configuration
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with every field tagged
+// secret:"true" masked
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	return &redacted
+}
+
+// redact masks the non-empty secret string fields of a struct value and of
+// the structs nested in it
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			redact(field)
+		case field.Kind() == reflect.String && t.Field(i).Tag.Get("secret") == "true":
+			if field.String() != "" {
+				field.SetString(redactedValue)
+			}
+		}
+	}
+}
+
+// Print writes the configuration as YAML with secrets redacted. The output
+// is itself a valid config file.
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrRestartRequired is returned when a reload changes settings that only
+// take effect when the server restarts
+var ErrRestartRequired = errors.New("configuration change requires a restart")
+
+// reloadableFields are the settings applied without a restart, as field
+// paths or path prefixes ending in "."
+var reloadableFields = []string{
+	"server.rate_limit",
+	"server.rate_burst",
+	"logging.level",
+	"upload.max_file_size",
+	"upload.allowed_types",
+	"upload.cleanup_after",
+	"upload.upload_retention",
+	"upload.max_disk_usage",
+	"upload.cleanup_dry_run",
+	"cors.",
+	"model.routing_weights.",
+	"model.shadow_models",
+}
+
+// Diff lists the settings that differ between old and new, named by their
+// config file path. Changed secrets are listed too, with their values
+// redacted.
+func Diff(old, new *Config) []models.ConfigChange {
+	before := flatten(old)
+	after := flatten(new)
+	beforeShown := flatten(old.Redacted())
+	afterShown := flatten(new.Redacted())
+
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	var changes []models.ConfigChange
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		if before[field] == after[field] {
+			continue
+		}
+		changes = append(changes, models.ConfigChange{
+			Field:      field,
+			Old:        beforeShown[field],
+			New:        afterShown[field],
+			Reloadable: isReloadable(field),
+		})
+	}
+	return changes
+}
+
+// isReloadable reports whether a field can change without a restart
+func isReloadable(field string) bool {
+	for _, reloadable := range reloadableFields {
+		if field == reloadable || (strings.HasSuffix(reloadable, ".") && strings.HasPrefix(field, reloadable)) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten maps every leaf setting of a configuration to its formatted value
+func flatten(c *Config) map[string]string {
+	values := make(map[string]string)
+	flattenValue(values, "", reflect.ValueOf(*c))
+	return values
+}
+
+func flattenValue(values map[string]string, path string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			flattenValue(values, join(path, name), v.Field(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			flattenValue(values, join(path, fmt.Sprint(key.Interface())), v.MapIndex(key))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			flattenValue(values, path, v.Elem())
+		}
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		values[path] = strings.Join(items, ",")
+	default:
+		values[path] = fmt.Sprint(v.Interface())
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Reloader re-reads the configuration at runtime and hands the hot-reloadable
+// settings to the registered components. A reload that changes any setting
+// requiring a restart is rejected as a whole.
+type Reloader struct {
+	args   []string
+	logger *logrus.Logger
+
+	mu       sync.Mutex
+	current  atomic.Pointer[Config]
+	appliers []reloadApplier
+}
+
+// reloadApplier applies reloaded settings to one component
+type reloadApplier struct {
+	name  string
+	apply func(cfg *Config)
+}
+
+// NewReloader creates a reloader for a configuration loaded from args
+func NewReloader(cfg *Config, args []string, logger *logrus.Logger) *Reloader {
+	r := &Reloader{args: args, logger: logger}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers a component to receive reloaded configuration.
+// Components are applied in registration order.
+func (r *Reloader) OnReload(name string, apply func(cfg *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, reloadApplier{name: name, apply: apply})
+}
+
+// Reload re-reads and validates the configuration, then applies it if every
+// change is hot-reloadable. It returns the changes found; with
+// ErrRestartRequired nothing is applied.
+func (r *Reloader) Reload() ([]models.ConfigChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := Parse(r.args)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Diff(r.current.Load(), next)
+	if len(changes) == 0 {
+		r.logger.Info("Configuration reloaded, nothing changed")
+		return nil, nil
+	}
+
+	var restartOnly []string
+	for _, change := range changes {
+		if !change.Reloadable {
+			restartOnly = append(restartOnly, change.Field)
+		}
+	}
+	if len(restartOnly) > 0 {
+		r.logger.WithField("fields", restartOnly).Warn("Configuration reload rejected, changes require a restart")
+		return changes, fmt.Errorf("%w: %s", ErrRestartRequired, strings.Join(restartOnly, ", "))
+	}
+
+	r.current.Store(next)
+	for _, applier := range r.appliers {
+		applier.apply(next)
+		r.logger.Debugf("Applied reloaded configuration to %s", applier.name)
+	}
+
+	for _, change := range changes {
+		r.logger.WithFields(logrus.Fields{
+			"field": change.Field,
+			"old":   change.Old,
+			"new":   change.New,
+		}).Info("Configuration changed")
+	}
+	return changes, nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestReloadAppliesReloadableChanges(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  rate_limit: 5\n")
+	args := []string{"-config", path}
+
+	cfg, err := Parse(args)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	reloader := NewReloader(cfg, args, logger)
+
+	var applied *Config
+	reloader.OnReload("test", func(cfg *Config) { applied = cfg })
+
+	if err := os.WriteFile(path, []byte("server:\n  rate_limit: 7\ncors:\n  allowed_origins: [https://example.com]\n"), 0600); err != nil {
+		t.Fatalf("Failed to rewrite config file: %v", err)
+	}
+
+	changes, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Expected reload to succeed, got: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "cors.allowed_origins" || changes[1].Field != "server.rate_limit" {
+		t.Errorf("Expected cors and rate limit changes, got: %+v", changes)
+	}
+	if applied == nil || applied.Server.RateLimit != 7 {
+		t.Fatal("Expected the new configuration to be applied")
+	}
+	if reloader.Current() != applied {
+		t.Error("Expected Current to return the reloaded configuration")
+	}
+}
+
+func TestReloadRejectsRestartOnlyChanges(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  rate_limit: 5\n")
+	args := []string{"-config", path}
+
+	cfg, err := Parse(args)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	reloader := NewReloader(cfg, args, logger)
+
+	applied := false
+	reloader.OnReload("test", func(cfg *Config) { applied = true })
+
+	// A reloadable change alongside a restart-only one applies neither
+	if err := os.WriteFile(path, []byte("server:\n  rate_limit: 7\n  port: 9999\n"), 0600); err != nil {
+		t.Fatalf("Failed to rewrite config file: %v", err)
+	}
+
+	changes, err := reloader.Reload()
+	if !errors.Is(err, ErrRestartRequired) {
+		t.Fatalf("Expected ErrRestartRequired, got: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Expected both changes to be reported, got: %+v", changes)
+	}
+	if applied || reloader.Current() != cfg {
+		t.Error("Expected nothing to be applied")
+	}
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	old := defaults()
+	updated := defaults()
+	updated.Server.AdminToken = "s3cr3t"
+
+	changes := Diff(old, updated)
+	if len(changes) != 1 {
+		t.Fatalf("Expected one change, got: %+v", changes)
+	}
+	if changes[0].New != redactedValue {
+		t.Errorf("Expected secret to be redacted, got %q", changes[0].New)
+	}
+	if changes[0].Reloadable {
+		t.Error("Expected admin token change to require a restart")
+	}
+}
+
+func TestReloadRejectsRotatedSecret(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  admin_token: old-token\n")
+	args := []string{"-config", path}
+
+	cfg, err := Parse(args)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	reloader := NewReloader(cfg, args, logger)
+
+	if err := os.WriteFile(path, []byte("server:\n  admin_token: new-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to rewrite config file: %v", err)
+	}
+
+	changes, err := reloader.Reload()
+	if !errors.Is(err, ErrRestartRequired) {
+		t.Fatalf("Expected ErrRestartRequired, got: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Field != "server.admin_token" {
+		t.Fatalf("Expected the admin token change, got: %+v", changes)
+	}
+	if changes[0].Old != redactedValue || changes[0].New != redactedValue {
+		t.Errorf("Expected both values to be redacted, got %q and %q", changes[0].Old, changes[0].New)
+	}
+	if reloader.Current() != cfg {
+		t.Error("Expected the old token to stay in effect")
+	}
+}
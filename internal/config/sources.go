@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// source provides raw configuration values keyed by environment variable name
+type source interface {
+	lookup(key string) (string, bool)
+}
+
+// envSource reads values from the process environment. Empty variables
+// count as unset.
+type envSource struct{}
+
+func (envSource) lookup(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != ""
+}
+
+// flagOverrides holds the -set KEY=VALUE command-line overrides
+type flagOverrides struct {
+	values map[string]string
+	used   map[string]bool
+}
+
+func (f *flagOverrides) lookup(key string) (string, bool) {
+	value, ok := f.values[key]
+	if ok {
+		f.used[key] = true
+	}
+	return value, ok
+}
+
+// unused reports overrides that did not match any configuration key
+func (f *flagOverrides) unused() []error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(f.values)) {
+		if !f.used[key] {
+			errs = append(errs, fmt.Errorf("-set %s: unknown configuration key", key))
+		}
+	}
+	return errs
+}
+
+// flags holds the parsed command-line flags
+type flags struct {
+	configFile string
+	overrides  *flagOverrides
+}
+
+// parseFlags parses the command-line flags in args
+func parseFlags(args []string) (*flags, error) {
+	f := &flags{overrides: &flagOverrides{
+		values: make(map[string]string),
+		used:   make(map[string]bool),
+	}}
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&f.configFile, "config", "", "path to a YAML or TOML config file (default $CONFIG_FILE)")
+	fs.Func("set", "override a setting by environment variable name, e.g. -set PORT=9090 (repeatable)", func(value string) error {
+		key, val, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return fmt.Errorf("expected KEY=VALUE, got %q", value)
+		}
+		f.overrides.values[key] = val
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	return f, nil
+}
+
+// loadFile decodes a YAML or TOML config file over config. Unknown keys
+// are rejected so typos do not silently fall back to defaults.
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// An empty file decodes to io.EOF and leaves the defaults alone
+		if err := decoder.Decode(config); err != nil && len(bytes.TrimSpace(data)) > 0 {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return fmt.Errorf("invalid config file %s: %s", path, strictErr.String())
+			}
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (want .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	return nil
+}
+
+// binder parses values from a source into configuration fields, collecting
+// an error for every malformed value
+type binder struct {
+	src  source
+	errs []error
+}
+
+func (b *binder) fail(key, value, kind string) {
+	b.errs = append(b.errs, fmt.Errorf("%s: %q is not a valid %s", key, value, kind))
+}
+
+func (b *binder) string(key string, target *string) {
+	if value, ok := b.src.lookup(key); ok {
+		*target = value
+	}
+}
+
+func (b *binder) int(key string, target *int) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		b.fail(key, value, "integer")
+		return
+	}
+	*target = intValue
+}
+
+func (b *binder) int64(key string, target *int64) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+	intValue, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		b.fail(key, value, "integer")
+		return
+	}
+	*target = intValue
+}
+
+func (b *binder) float64(key string, target *float64) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+	floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		b.fail(key, value, "number")
+		return
+	}
+	*target = floatValue
+}
+
+func (b *binder) bool(key string, target *bool) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		b.fail(key, value, "boolean")
+		return
+	}
+	*target = boolValue
+}
+
+// slice parses a comma-separated list
+func (b *binder) slice(key string, target *[]string) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*target = items
+}
+
+// intMap parses a comma-separated list of key=value pairs, e.g. "a=100,b=200"
+func (b *binder) intMap(key string, target *map[string]int) {
+	value, ok := b.src.lookup(key)
+	if !ok {
+		return
+	}
+
+	result := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || strings.TrimSpace(k) == "" {
+			b.fail(key, pair, "key=value pair")
+			return
+		}
+		intValue, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			b.fail(key, pair, "key=integer pair")
+			return
+		}
+		result[strings.TrimSpace(k)] = intValue
+	}
+	*target = result
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth guards the admin endpoints with a bearer token. With no token
+// configured the endpoints are not exposed at all.
+func (h *Handler) AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+				"Not found", "admin endpoints are disabled")
+			c.Abort()
+			return
+		}
+
+		provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			h.respondError(c, http.StatusUnauthorized, models.ErrorCodeUnauthorized,
+				"Invalid or missing admin token", "")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminReloadConfig re-reads the configuration and applies the
+// hot-reloadable settings
+func (h *Handler) AdminReloadConfig(c *gin.Context) {
+	changes, err := h.reloader.Reload()
+	if err != nil {
+		if errors.Is(err, config.ErrRestartRequired) {
+			c.JSON(http.StatusConflict, models.ConfigReloadResponse{
+				Changes: changes,
+				Error: models.NewErrorResponse(models.ErrorCodeRestartRequired,
+					"Configuration change requires a restart", err.Error()),
+			})
+			return
+		}
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid configuration", err.Error())
+		return
+	}
+
+	if changes == nil {
+		changes = []models.ConfigChange{}
+	}
+	c.JSON(http.StatusOK, models.ConfigReloadResponse{
+		Applied: true,
+		Changes: changes,
+	})
+}
+
+// AdminStartBackfill starts reprocessing stored uploads with a model
+func (h *Handler) AdminStartBackfill(c *gin.Context) {
+	if h.backfillService == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Backfill is not available", "uploads are not kept in a blob store")
+		return
+	}
+
+	var request models.BackfillRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid request body", err.Error())
+		return
+	}
+
+	run, err := h.backfillService.Start(request)
+	switch {
+	case errors.Is(err, services.ErrBackfillModelNotFound):
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeModelNotFound,
+			"Cannot start backfill", err.Error())
+		return
+	case errors.Is(err, services.ErrInvalidBackfill):
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Cannot start backfill", err.Error())
+		return
+	case err != nil:
+		h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+			"Failed to start backfill", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// AdminGetBackfill returns the progress or summary of a backfill run
+func (h *Handler) AdminGetBackfill(c *gin.Context) {
+	if h.backfillService == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Backfill is not available", "uploads are not kept in a blob store")
+		return
+	}
+
+	run, err := h.backfillService.Get(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Backfill not found", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// AdminShadowReport compares the shadow candidate models with the models
+// serving traffic: top-1 agreement, recent disagreements and latency
+func (h *Handler) AdminShadowReport(c *gin.Context) {
+	if h.shadowRunner == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Shadow inference is not available", "")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.shadowRunner.Report())
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminExportDataset streams stored images with their labels as a tar
+// archive for retraining
+func (h *Handler) AdminExportDataset(c *gin.Context) {
+	if h.exportService == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Export is not available", "uploads are not kept in a blob store")
+		return
+	}
+
+	request, err := exportRequestFromQuery(c)
+	if err == nil {
+		err = services.ValidateExportRequest(&request)
+	}
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid export request", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	items, err := h.exportService.Select(ctx, request)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+			"Failed to select images", err.Error())
+		return
+	}
+
+	// Headers are sent with the first image, so later failures can only
+	// cut the archive short
+	filename := fmt.Sprintf("dataset-%s-%s.tar", request.Format, time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Export-Selected", strconv.Itoa(len(items)))
+	c.Status(http.StatusOK)
+
+	summary, err := h.exportService.WriteArchive(ctx, c.Writer, request.Format, items)
+	if err != nil {
+		h.log(c).WithError(err).Error("Dataset export failed")
+		return
+	}
+	h.log(c).Infof("Exported %d images in %s format (%d missing)", summary.Images, summary.Format, summary.Missing)
+}
+
+// exportRequestFromQuery reads an export request from query parameters;
+// label may be repeated
+func exportRequestFromQuery(c *gin.Context) (models.ExportRequest, error) {
+	request := models.ExportRequest{
+		Format:   c.DefaultQuery("format", models.ExportFormatImageNet),
+		ModelID:  c.Query("model"),
+		Labels:   c.QueryArray("label"),
+		Feedback: c.Query("feedback"),
+	}
+
+	var err error
+	for name, dst := range map[string]*time.Time{"since": &request.Since, "until": &request.Until} {
+		if value := c.Query(name); value != "" {
+			if *dst, err = time.Parse(time.RFC3339, value); err != nil {
+				return request, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	if value := c.Query("min_confidence"); value != "" {
+		if request.MinConfidence, err = strconv.ParseFloat(value, 64); err != nil {
+			return request, fmt.Errorf("invalid min_confidence: %w", err)
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		if request.Limit, err = strconv.Atoi(value); err != nil {
+			return request, fmt.Errorf("invalid limit: %w", err)
+		}
+	}
+	return request, nil
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/francknouama/image-recognition-webapp/web/templates"
+	"github.com/gin-gonic/gin"
+)
+
+// SubmitFeedback records feedback posted from the results page form. HTMX
+// requests get the updated feedback section back.
+func (h *Handler) SubmitFeedback(c *gin.Context) {
+	if !h.rateLimiter.Allow() {
+		h.respondError(c, http.StatusTooManyRequests, models.ErrorCodeRateLimitExceeded,
+			"Rate limit exceeded", "")
+		return
+	}
+
+	request := models.FeedbackRequest{
+		Rating:       c.PostForm("rating"),
+		CorrectLabel: c.PostForm("correct_label"),
+		Comment:      c.PostForm("comment"),
+	}
+
+	result, ok := h.submitFeedback(c, request)
+	if !ok {
+		return
+	}
+
+	if h.isHTMXRequest(c) {
+		c.Header("Content-Type", "text/html")
+		if err := templates.ResultFeedback(*result).Render(c.Request.Context(), c.Writer); err != nil {
+			h.log(c).WithError(err).Error("Failed to render feedback template")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Feedback)
+}
+
+// APISubmitFeedback records feedback on a prediction result
+func (h *Handler) APISubmitFeedback(c *gin.Context) {
+	if !h.rateLimiter.Allow() {
+		h.respondError(c, http.StatusTooManyRequests, models.ErrorCodeRateLimitExceeded,
+			"Rate limit exceeded", "")
+		return
+	}
+
+	var request models.FeedbackRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid request body", err.Error())
+		return
+	}
+
+	result, ok := h.submitFeedback(c, request)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Feedback)
+}
+
+// submitFeedback applies feedback to the result named in the path,
+// responding with an error if it cannot
+func (h *Handler) submitFeedback(c *gin.Context, request models.FeedbackRequest) (*models.PredictionResult, bool) {
+	result, err := h.predictionService.SubmitFeedback(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidFeedback):
+			h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+				"Invalid feedback", err.Error())
+		case errors.Is(err, services.ErrResultNotFound):
+			h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+				"Result not found", err.Error())
+		default:
+			h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+				"Failed to submit feedback", err.Error())
+		}
+		return nil, false
+	}
+	return result, true
+}
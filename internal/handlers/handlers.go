@@ -1,24 +1,51 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/health"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
 	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
+	"github.com/francknouama/image-recognition-webapp/internal/version"
 	"github.com/francknouama/image-recognition-webapp/web/templates"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/time/rate"
 )
 
+// statusClientClosedRequest is the non-standard status logged when the
+// client disconnects before a response could be produced
+const statusClientClosedRequest = 499
+
 // Config holds handler configuration
 type Config struct {
 	ImageService      *services.ImageService
 	PredictionService services.PredictionServiceInterface
 	ModelService      *services.ModelService
-	RateLimiter      *rate.Limiter
+	InferenceLimiter  *services.InferenceLimiter
+	CircuitBreaker    *services.CircuitBreaker
+	Health            *health.Checker
+	JobService        *services.JobService
+	BackfillService   *services.BackfillService
+	LabelSetService   *services.LabelSetService
+	ExportService     *services.ExportService
+	ShadowRunner      *services.ShadowRunner
+	FileManager       *services.FileManager
+	Reloader          *config.Reloader
+	URLSigner         *services.URLSigner
+	RateLimiter       *rate.Limiter
+	Logger            *logrus.Logger
 }
 
 // Handler contains all HTTP handlers
@@ -26,9 +53,20 @@ type Handler struct {
 	imageService      *services.ImageService
 	predictionService services.PredictionServiceInterface
 	modelService      *services.ModelService
-	rateLimiter      *rate.Limiter
-	logger           *logrus.Logger
-	startTime        time.Time
+	inferenceLimiter  *services.InferenceLimiter
+	circuitBreaker    *services.CircuitBreaker
+	health            *health.Checker
+	jobService        *services.JobService
+	backfillService   *services.BackfillService
+	labelSetService   *services.LabelSetService
+	exportService     *services.ExportService
+	shadowRunner      *services.ShadowRunner
+	fileManager       *services.FileManager
+	reloader          *config.Reloader
+	urlSigner         *services.URLSigner
+	rateLimiter       *rate.Limiter
+	logger            *logrus.Logger
+	startTime         time.Time
 }
 
 // New creates a new handler instance
@@ -37,15 +75,26 @@ func New(config *Config) *Handler {
 		imageService:      config.ImageService,
 		predictionService: config.PredictionService,
 		modelService:      config.ModelService,
-		rateLimiter:      config.RateLimiter,
-		logger:           logrus.New(),
-		startTime:        time.Now(),
+		inferenceLimiter:  config.InferenceLimiter,
+		circuitBreaker:    config.CircuitBreaker,
+		health:            config.Health,
+		jobService:        config.JobService,
+		backfillService:   config.BackfillService,
+		labelSetService:   config.LabelSetService,
+		exportService:     config.ExportService,
+		shadowRunner:      config.ShadowRunner,
+		fileManager:       config.FileManager,
+		reloader:          config.Reloader,
+		urlSigner:         config.URLSigner,
+		rateLimiter:       config.RateLimiter,
+		logger:            config.Logger,
+		startTime:         time.Now(),
 	}
 }
 
 // Index serves the main homepage
 func (h *Handler) Index(c *gin.Context) {
-	h.logger.Info("Homepage accessed")
+	h.log(c).Info("Homepage accessed")
 	
 	// Get system stats for display
 	stats := models.ModelStats{
@@ -101,28 +150,69 @@ func (h *Handler) Upload(c *gin.Context) {
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			h.logger.Error("Failed to close file", "error", err)
+			h.log(c).WithError(err).Error("Failed to close file")
 		}
 	}()
 
+	metrics.ObserveUpload(header.Size)
+
+	ctx, span := tracing.StartSpan(c.Request.Context(), "Handler.Upload",
+		attribute.String("image.filename", header.Filename),
+		attribute.Int64("image.size", header.Size),
+	)
+	defer span.End()
+	c.Request = c.Request.WithContext(ctx)
+
+	// Get model ID and prediction options from form (optional)
+	modelID := c.PostForm("model_id")
+	rules, err := formRejectionRules(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid prediction options", err.Error())
+		return
+	}
+	ctx = services.WithRejectionRules(ctx, rules)
+	if raw := c.PostForm("rollup_depth"); raw != "" {
+		depth, err := strconv.Atoi(raw)
+		if err != nil || depth < 0 {
+			h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+				"Invalid prediction options", fmt.Sprintf("invalid rollup_depth: %q", raw))
+			return
+		}
+		ctx = services.WithRollupDepth(ctx, &depth)
+	}
+
+	// Hold an inference slot while decoding so a burst of uploads cannot
+	// decode an unbounded number of full-size images at once. The request
+	// is routed once here so the slot belongs to the variant that serves it.
+	ctx, routedModelID := h.modelService.WithRoute(ctx, modelID)
+	ctx, release, err := h.inferenceLimiter.Acquire(ctx, routedModelID)
+	if err != nil {
+		h.respondPredictionError(c, err)
+		return
+	}
+	defer release()
+
 	// Process image
-	metadata, processedData, err := h.imageService.ProcessImage(file, header)
+	metadata, processedData, err := h.imageService.ProcessImage(ctx, file, header)
+	if errors.Is(err, context.Canceled) {
+		h.respondPredictionError(c, err)
+		return
+	}
 	if err != nil {
 		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidImage,
 			"Failed to process image", err.Error())
 		return
 	}
 
-	// Get model ID from form (optional)
-	modelID := c.PostForm("model_id")
-
 	// Perform prediction
-	result, err := h.predictionService.PredictImage(processedData, metadata, modelID)
+	result, err := h.predictionService.PredictImage(ctx, processedData, metadata, modelID)
 	if err != nil {
-		h.respondError(c, http.StatusInternalServerError, models.ErrorCodePredictionFailed,
-			"Prediction failed", err.Error())
+		tracing.RecordError(span, err)
+		h.respondPredictionError(c, err)
 		return
 	}
+	result = h.localized(c, h.withImageURLs(result))
 
 	// Return HTMX-compatible HTML response
 	if h.isHTMXRequest(c) {
@@ -157,6 +247,22 @@ func (h *Handler) APIPredictImage(c *gin.Context) {
 		return
 	}
 
+	if err := validateRequestOptions(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid prediction options", err.Error())
+		return
+	}
+
+	metrics.ObserveUpload(int64(len(request.ImageData)))
+
+	ctx, span := tracing.StartSpan(c.Request.Context(), "Handler.APIPredictImage",
+		attribute.String("image.filename", request.Filename),
+		attribute.Int("image.size", len(request.ImageData)),
+	)
+	defer span.End()
+	ctx = services.WithRejectionRules(ctx, request.Rejection)
+	ctx = services.WithRollupDepth(ctx, request.RollupDepth)
+
 	// Create metadata
 	metadata := &models.ImageMetadata{
 		Filename:   request.Filename,
@@ -165,12 +271,13 @@ func (h *Handler) APIPredictImage(c *gin.Context) {
 	}
 
 	// Perform prediction
-	result, err := h.predictionService.PredictImage(request.ImageData, metadata, request.ModelID)
+	result, err := h.predictionService.PredictImage(ctx, request.ImageData, metadata, request.ModelID)
 	if err != nil {
-		h.respondError(c, http.StatusInternalServerError, models.ErrorCodePredictionFailed,
-			"Prediction failed", err.Error())
+		tracing.RecordError(span, err)
+		h.respondPredictionError(c, err)
 		return
 	}
+	result = h.localized(c, h.withImageURLs(result))
 
 	c.JSON(http.StatusOK, result)
 }
@@ -190,6 +297,7 @@ func (h *Handler) GetResults(c *gin.Context) {
 			"Result not found", err.Error())
 		return
 	}
+	result = h.localized(c, h.withImageURLs(result))
 
 	// Return HTMX-compatible HTML response
 	if h.isHTMXRequest(c) {
@@ -215,6 +323,7 @@ func (h *Handler) APIGetResults(c *gin.Context) {
 			"Result not found", err.Error())
 		return
 	}
+	result = h.localized(c, h.withImageURLs(result))
 
 	c.JSON(http.StatusOK, result)
 }
@@ -232,7 +341,7 @@ func (h *Handler) APIListModels(c *gin.Context) {
 
 // StatusPage serves the status page
 func (h *Handler) StatusPage(c *gin.Context) {
-	health := h.getHealthStatus()
+	health := h.getHealthStatus(c.Request.Context())
 	template := templates.Status(*health)
 	
 	c.Header("Content-Type", "text/html")
@@ -248,48 +357,56 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 		"status":    "healthy",
 		"timestamp": time.Now(),
 		"uptime":    time.Since(h.startTime).String(),
+		"version":   version.Version,
 	})
 }
 
-// APIHealthCheck provides detailed health check
-func (h *Handler) APIHealthCheck(c *gin.Context) {
-	modelStatus := h.modelService.GetModelStatus()
-	
-	health := &models.HealthCheck{
-		Status:      "healthy",
-		Timestamp:   time.Now(),
-		Uptime:      time.Since(h.startTime).String(),
-		Version:     "1.0.0",
-		Services: map[string]string{
-			"image_service":      "healthy",
-			"prediction_service": "healthy",
-			"model_service":      "healthy",
-		},
-		ModelStatus: modelStatus,
+// Livez reports whether the process is alive. It checks no dependencies so
+// a slow dependency never gets the pod restarted.
+func (h *Handler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.ProbeResponse{Status: health.StatusAlive})
+}
+
+// Readyz reports whether the service can take traffic
+func (h *Handler) Readyz(c *gin.Context) {
+	ready, response := h.health.Readiness(c.Request.Context())
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
 	}
+	c.JSON(http.StatusOK, response)
+}
 
-	// Check if any models are unhealthy
-	for _, modelHealth := range modelStatus.Models {
-		if modelHealth.Status != "healthy" {
-			health.Status = "degraded"
-			health.Services["model_service"] = "degraded"
-			break
-		}
+// Startupz reports whether initialization has finished
+func (h *Handler) Startupz(c *gin.Context) {
+	if !h.health.Started() {
+		c.JSON(http.StatusServiceUnavailable, models.ProbeResponse{Status: health.StatusStarting})
+		return
 	}
+	c.JSON(http.StatusOK, models.ProbeResponse{Status: health.StatusStarted})
+}
 
-	c.JSON(http.StatusOK, health)
+// APIHealthCheck provides detailed health check
+func (h *Handler) APIHealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, h.getHealthStatus(c.Request.Context()))
 }
 
 // Helper methods
 
+// log returns a logger carrying the request-scoped fields of c
+func (h *Handler) log(c *gin.Context) *logrus.Entry {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
 func (h *Handler) isHTMXRequest(c *gin.Context) bool {
 	return c.GetHeader("HX-Request") == "true"
 }
 
 func (h *Handler) respondError(c *gin.Context, statusCode int, errorCode, message, details string) {
 	errorResponse := models.NewErrorResponse(errorCode, message, details)
+	errorResponse.RequestID = logging.RequestIDFromContext(c.Request.Context())
 	
-	h.logger.WithFields(logrus.Fields{
+	h.log(c).WithFields(logrus.Fields{
 		"status_code": statusCode,
 		"error_code":  errorCode,
 		"message":     message,
@@ -300,10 +417,10 @@ func (h *Handler) respondError(c *gin.Context, statusCode int, errorCode, messag
 
 	if h.isHTMXRequest(c) {
 		// Return HTMX-compatible error response using TEMPL
-		template := templates.UploadError(message)
+		template := templates.UploadError(message, errorResponse.RequestID)
 		c.Header("Content-Type", "text/html")
 		if err := template.Render(c.Request.Context(), c.Writer); err != nil {
-			h.logger.Error("Failed to render error template", "error", err)
+			h.log(c).WithError(err).Error("Failed to render error template")
 		}
 		return
 	}
@@ -311,31 +428,74 @@ func (h *Handler) respondError(c *gin.Context, statusCode int, errorCode, messag
 	c.JSON(statusCode, errorResponse)
 }
 
+// respondPredictionError maps prediction failures to HTTP responses
+func (h *Handler) respondPredictionError(c *gin.Context, err error) {
+	switch {
+	case services.IsOverloaded(err):
+		retryAfter := int(math.Ceil(h.inferenceLimiter.RetryAfter(services.OverloadedModel(err)).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		h.respondError(c, http.StatusServiceUnavailable, models.ErrorCodeServiceUnavailable,
+			"Server is busy, please retry later", err.Error())
+	case errors.Is(err, services.ErrCircuitOpen):
+		retryAfter := int(math.Ceil(h.circuitBreaker.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		h.respondError(c, http.StatusServiceUnavailable, models.ErrorCodeServiceUnavailable,
+			"Model is temporarily unavailable, please retry later", err.Error())
+	case errors.Is(err, services.ErrInferenceTimeout):
+		h.respondError(c, http.StatusGatewayTimeout, models.ErrorCodeGatewayTimeout,
+			"Prediction timed out", err.Error())
+	case errors.Is(err, context.Canceled):
+		// Nobody is listening for the response any more
+		h.log(c).WithError(err).Info("Client canceled request")
+		c.AbortWithStatus(statusClientClosedRequest)
+	default:
+		h.respondError(c, http.StatusInternalServerError, models.ErrorCodePredictionFailed,
+			"Prediction failed", err.Error())
+	}
+}
+
 func (h *Handler) renderPredictionResults(c *gin.Context, result *models.PredictionResult) {
+	ctx, span := tracing.StartSpan(c.Request.Context(), "Handler.renderPredictionResults",
+		attribute.String("result.id", result.ID),
+	)
+	defer span.End()
+
 	// Use TEMPL template for results
 	template := templates.UploadResults(*result)
 	
 	c.Header("Content-Type", "text/html")
-	if err := template.Render(c.Request.Context(), c.Writer); err != nil {
-		h.logger.Error("Failed to render results template", "error", err)
+	if err := template.Render(ctx, c.Writer); err != nil {
+		tracing.RecordError(span, err)
+		h.log(c).WithError(err).Error("Failed to render results template")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template"})
 	}
 }
 
-func (h *Handler) getHealthStatus() *models.HealthCheck {
+func (h *Handler) getHealthStatus(ctx context.Context) *models.HealthCheck {
 	modelStatus := h.modelService.GetModelStatus()
 	
 	health := &models.HealthCheck{
 		Status:      "healthy",
 		Timestamp:   time.Now(),
 		Uptime:      time.Since(h.startTime).String(),
-		Version:     "1.0.0",
+		Version:     version.Version,
+		Commit:      version.Commit,
 		Services: map[string]string{
-			"image_service":      "healthy",
-			"prediction_service": "healthy",
-			"model_service":      "healthy",
+			"model_service": "healthy",
 		},
 		ModelStatus: modelStatus,
+		Queues:      h.inferenceLimiter.Status(),
+		Breakers:    h.circuitBreaker.Status(),
+		Variants:    h.modelService.VariantStats(),
+	}
+
+	// Report each readiness dependency
+	ready, readiness := h.health.Readiness(ctx)
+	for name, result := range readiness.Checks {
+		health.Services[name] = "healthy"
+		if result != "ok" {
+			health.Services[name] = "unhealthy"
+		}
 	}
 
 	// Check if any models are unhealthy
@@ -347,5 +507,85 @@ func (h *Handler) getHealthStatus() *models.HealthCheck {
 		}
 	}
 
+	// Report saturated inference queues
+	health.Services["inference_queue"] = "healthy"
+	if saturated := h.inferenceLimiter.SaturatedModels(); len(saturated) > 0 {
+		health.Status = "degraded"
+		health.Services["inference_queue"] = "degraded"
+	}
+
+	// Report models whose primary engine breaker is not closed
+	health.Services["inference_engine"] = "healthy"
+	if open := h.circuitBreaker.OpenModels(); len(open) > 0 {
+		health.Status = "degraded"
+		health.Services["inference_engine"] = "degraded"
+	}
+
+	// Report storage usage as of the last cleanup run
+	if h.fileManager != nil {
+		storage := h.fileManager.Stats()
+		health.Storage = &storage
+		health.Services["storage"] = "healthy"
+		if storage.MaxBytes > 0 && storage.TotalBytes > storage.MaxBytes {
+			health.Status = "degraded"
+			health.Services["storage"] = "degraded"
+		}
+	}
+
+	if !ready {
+		health.Status = "unhealthy"
+	}
+
 	return health
-}
\ No newline at end of file
+}
+
+// validateRequestOptions checks the per-request options of an API
+// prediction
+func validateRequestOptions(request *models.PredictionRequest) error {
+	if request.Rejection != nil {
+		if err := services.ValidateRejectionRules(request.Rejection); err != nil {
+			return fmt.Errorf("invalid rejection rules: %w", err)
+		}
+	}
+	if request.RollupDepth != nil && *request.RollupDepth < 0 {
+		return fmt.Errorf("rollup_depth must not be negative, got %d", *request.RollupDepth)
+	}
+	return nil
+}
+
+// formRejectionRules reads per-request rejection rules from the
+// min_confidence, min_margin and max_entropy form fields, returning nil
+// when none is set
+func formRejectionRules(c *gin.Context) (*models.RejectionRules, error) {
+	var rules models.RejectionRules
+	fields := []struct {
+		name  string
+		value *float64
+	}{
+		{"min_confidence", &rules.MinConfidence},
+		{"min_margin", &rules.MinMargin},
+		{"max_entropy", &rules.MaxEntropy},
+	}
+
+	set := false
+	for _, field := range fields {
+		raw := c.PostForm(field.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q", field.name, raw)
+		}
+		*field.value = value
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+
+	if err := services.ValidateRejectionRules(&rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
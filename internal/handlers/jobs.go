@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APISubmitJob queues an asynchronous prediction and returns the job
+func (h *Handler) APISubmitJob(c *gin.Context) {
+	// Check rate limit
+	if !h.rateLimiter.Allow() {
+		h.respondError(c, http.StatusTooManyRequests, models.ErrorCodeRateLimitExceeded,
+			"Rate limit exceeded", "")
+		return
+	}
+
+	var request models.PredictionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid request body", err.Error())
+		return
+	}
+
+	if err := validateRequestOptions(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid prediction options", err.Error())
+		return
+	}
+
+	metrics.ObserveUpload(int64(len(request.ImageData)))
+
+	job, err := h.jobService.Submit(c.Request.Context(), request)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobQueueFull), errors.Is(err, services.ErrJobServiceClosed):
+			c.Header("Retry-After", "5")
+			h.respondError(c, http.StatusServiceUnavailable, models.ErrorCodeServiceUnavailable,
+				"Job cannot be queued right now, please retry later", err.Error())
+		default:
+			h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+				"Failed to queue job", err.Error())
+		}
+		return
+	}
+
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// APIGetJob returns the status and, once finished, the result of a job
+func (h *Handler) APIGetJob(c *gin.Context) {
+	job, err := h.jobService.Get(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Job not found", err.Error())
+		return
+	}
+	if job.Result != nil {
+		job.Result = h.localized(c, job.Result)
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APICreateLabelSet creates a label set from example images per label
+func (h *Handler) APICreateLabelSet(c *gin.Context) {
+	// Every example is embedded, so creation is rate limited like predictions
+	if !h.rateLimiter.Allow() {
+		h.respondError(c, http.StatusTooManyRequests, models.ErrorCodeRateLimitExceeded,
+			"Rate limit exceeded", "")
+		return
+	}
+
+	var request models.LabelSetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid request body", err.Error())
+		return
+	}
+
+	set, err := h.labelSetService.Create(c.Request.Context(), request)
+	if err != nil {
+		h.respondLabelSetError(c, "Failed to create label set", err)
+		return
+	}
+
+	c.Header("Location", "/api/label-sets/"+set.ID)
+	c.JSON(http.StatusCreated, set)
+}
+
+// APIListLabelSets returns all label sets
+func (h *Handler) APIListLabelSets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"label_sets": h.labelSetService.List(),
+	})
+}
+
+// APIGetLabelSet returns a label set and its labels
+func (h *Handler) APIGetLabelSet(c *gin.Context) {
+	set, err := h.labelSetService.Get(c.Param("id"))
+	if err != nil {
+		h.respondLabelSetError(c, "Failed to get label set", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, set)
+}
+
+// APIUpdateLabelSet adds examples to a label set or removes labels from it
+func (h *Handler) APIUpdateLabelSet(c *gin.Context) {
+	if !h.rateLimiter.Allow() {
+		h.respondError(c, http.StatusTooManyRequests, models.ErrorCodeRateLimitExceeded,
+			"Rate limit exceeded", "")
+		return
+	}
+
+	var request models.LabelSetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid request body", err.Error())
+		return
+	}
+
+	set, err := h.labelSetService.Update(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		h.respondLabelSetError(c, "Failed to update label set", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, set)
+}
+
+// APIDeleteLabelSet deletes a label set and its virtual model
+func (h *Handler) APIDeleteLabelSet(c *gin.Context) {
+	if err := h.labelSetService.Delete(c.Param("id")); err != nil {
+		h.respondLabelSetError(c, "Failed to delete label set", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondLabelSetError maps label set service errors to responses
+func (h *Handler) respondLabelSetError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrLabelSetNotFound):
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Label set not found", err.Error())
+	case errors.Is(err, services.ErrLabelSetExists):
+		h.respondError(c, http.StatusConflict, models.ErrorCodeConflict,
+			"Label set already exists", err.Error())
+	case errors.Is(err, services.ErrInvalidLabelSet):
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Invalid label set", err.Error())
+	case services.IsOverloaded(err):
+		h.respondPredictionError(c, err)
+	default:
+		h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+			message, err.Error())
+	}
+}
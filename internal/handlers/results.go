@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// Stored image variants served for a result
+const (
+	imageVariantOriginal  = "image"
+	imageVariantThumbnail = "thumb"
+)
+
+// withImageURLs returns a copy of result carrying signed links to its
+// stored image and thumbnail. Results without a stored image are returned
+// unchanged.
+func (h *Handler) withImageURLs(result *models.PredictionResult) *models.PredictionResult {
+	if h.urlSigner == nil || result.Metadata.ImageKey == "" {
+		return result
+	}
+
+	signed := *result
+	signed.ImageURL = h.urlSigner.Sign(resultImagePath(result.ID, imageVariantOriginal))
+	if result.Metadata.ThumbnailKey != "" {
+		signed.ThumbnailURL = h.urlSigner.Sign(resultImagePath(result.ID, imageVariantThumbnail))
+	}
+	return &signed
+}
+
+// localized returns a copy of result with display names in the languages
+// the client accepts, announcing the language used in Content-Language
+func (h *Handler) localized(c *gin.Context, result *models.PredictionResult) *models.PredictionResult {
+	c.Writer.Header().Add("Vary", "Accept-Language")
+
+	languages := acceptedLanguages(c.GetHeader("Accept-Language"))
+	if len(languages) == 0 {
+		return result
+	}
+
+	localized, language := h.modelService.LocalizeResult(result, languages)
+	if language != "" {
+		c.Header("Content-Language", language)
+	}
+	return localized
+}
+
+// acceptedLanguages returns the tags of an Accept-Language header, most
+// preferred first
+func acceptedLanguages(header string) []string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+
+	languages := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag != language.Und {
+			languages = append(languages, tag.String())
+		}
+	}
+	return languages
+}
+
+func resultImagePath(resultID, variant string) string {
+	return "/results/" + resultID + "/" + variant
+}
+
+// ResultImage serves the original image of a result through a signed URL
+func (h *Handler) ResultImage(c *gin.Context) {
+	h.serveResultImage(c, imageVariantOriginal)
+}
+
+// ResultThumbnail serves the thumbnail of a result through a signed URL
+func (h *Handler) ResultThumbnail(c *gin.Context) {
+	h.serveResultImage(c, imageVariantThumbnail)
+}
+
+// serveResultImage verifies the URL signature and streams the stored blob.
+// Blobs are content-addressed and never change, so responses are cacheable
+// until the URL expires and revalidate by ETag.
+func (h *Handler) serveResultImage(c *gin.Context, variant string) {
+	resultID := c.Param("id")
+	if h.urlSigner == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Image links are not enabled", "")
+		return
+	}
+
+	expiry, err := h.urlSigner.Verify(resultImagePath(resultID, variant), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		h.respondError(c, http.StatusForbidden, models.ErrorCodeForbidden,
+			"Invalid or expired image link", err.Error())
+		return
+	}
+
+	result, err := h.predictionService.GetResult(resultID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Result not found", err.Error())
+		return
+	}
+
+	key := result.Metadata.ImageKey
+	if variant == imageVariantThumbnail {
+		key = result.Metadata.ThumbnailKey
+	}
+	store := h.imageService.BlobStore()
+	if key == "" || store == nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"No stored image for this result", "")
+		return
+	}
+
+	// The key's content hash identifies the bytes exactly
+	etag := `"` + strings.TrimSuffix(path.Base(key), path.Ext(key)) + `"`
+	maxAge := int(time.Until(expiry).Seconds())
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", maxAge))
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := store.Get(c.Request.Context(), key)
+	if errors.Is(err, services.ErrBlobNotFound) {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Stored image is no longer available", err.Error())
+		return
+	}
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+			"Failed to read stored image", err.Error())
+		return
+	}
+
+	// ServeContent sets the content type from the key's extension and
+	// handles range and conditional requests
+	http.ServeContent(c.Writer, c.Request, path.Base(key), result.Metadata.UploadedAt, bytes.NewReader(data))
+}
+
+// DownloadResult serves a result as a JSON or CSV file attachment
+func (h *Handler) DownloadResult(c *gin.Context) {
+	result, err := h.predictionService.GetResult(c.Param("id"))
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, models.ErrorCodeNotFound,
+			"Result not found", err.Error())
+		return
+	}
+	result = h.localized(c, result)
+
+	format := c.DefaultQuery("format", "json")
+	switch format {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, result.ID))
+		c.IndentedJSON(http.StatusOK, result)
+	case "csv":
+		data, err := resultCSV(result)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, models.ErrorCodeInternalError,
+				"Failed to export result", err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, result.ID))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	default:
+		h.respondError(c, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			"Unsupported download format", fmt.Sprintf("format %q is not json or csv", format))
+	}
+}
+
+// resultCSV renders one row per prediction, ranked by confidence
+func resultCSV(result *models.PredictionResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"result_id", "filename", "model_id", "model_version", "rank",
+		"class_name", "label", "confidence", "probability"})
+	for i, pred := range result.Predictions {
+		w.Write([]string{
+			services.CSVSafe(result.ID),
+			services.CSVSafe(result.Metadata.Filename),
+			services.CSVSafe(result.ModelInfo.ID),
+			services.CSVSafe(result.ModelInfo.Version),
+			strconv.Itoa(i + 1),
+			services.CSVSafe(pred.ClassName),
+			services.CSVSafe(pred.Label),
+			strconv.FormatFloat(pred.Confidence, 'f', 6, 64),
+			strconv.FormatFloat(pred.Probability, 'f', 6, 64),
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// routingCookieMaxAge keeps a browser on its variant for the length of a rollout
+const routingCookieMaxAge = 90 * 24 * time.Hour
+
+// ModelRouting attaches the routing hints of a request for the model
+// router: a hash of the API key, or else of a routing cookie that is issued
+// while traffic is split, and the override header.
+func (h *Handler) ModelRouting(cfg config.ModelConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hints := services.RoutingHints{}
+		if cfg.RoutingOverrideHeader != "" {
+			hints.Override = c.GetHeader(cfg.RoutingOverrideHeader)
+		}
+
+		if apiKey := headerValue(c, cfg.RoutingKeyHeader); apiKey != "" {
+			// Only a digest of the key is kept, e.g. in persisted jobs
+			sum := sha256.Sum256([]byte(apiKey))
+			hints.Key = hex.EncodeToString(sum[:])
+		} else if cfg.RoutingCookie != "" {
+			if cookie, err := c.Cookie(cfg.RoutingCookie); err == nil && cookie != "" {
+				hints.Key = cookie
+			} else if h.modelService.HasSplit() {
+				hints.Key = newRoutingID()
+				http.SetCookie(c.Writer, &http.Cookie{
+					Name:     cfg.RoutingCookie,
+					Value:    hints.Key,
+					Path:     "/",
+					MaxAge:   int(routingCookieMaxAge.Seconds()),
+					HttpOnly: true,
+					Secure:   c.Request.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+		}
+
+		c.Request = c.Request.WithContext(services.WithRoutingHints(c.Request.Context(), hints))
+		c.Next()
+	}
+}
+
+// headerValue returns a request header, or "" when name is not configured
+func headerValue(c *gin.Context, name string) string {
+	if name == "" {
+		return ""
+	}
+	return c.GetHeader(name)
+}
+
+// newRoutingID generates a random routing cookie value
+func newRoutingID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
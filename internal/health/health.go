@@ -0,0 +1,123 @@
+// Package health implements the liveness, readiness and startup probes.
+//
+// Readiness is the sum of registered dependency checks, so each subsystem
+// can contribute its own check without the handlers knowing about it.
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// Probe statuses
+const (
+	StatusAlive    = "alive"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusStarted  = "started"
+	StatusStarting = "starting"
+)
+
+// checkTimeout bounds each readiness check
+const checkTimeout = 2 * time.Second
+
+// CheckFunc reports a dependency problem as a non-nil error
+type CheckFunc func(ctx context.Context) error
+
+// Checker holds the startup state and the readiness checks
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]CheckFunc
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+// New creates a checker with no readiness checks
+func New() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+// AddReadinessCheck registers a named dependency check, replacing any
+// previous check with the same name
+func (c *Checker) AddReadinessCheck(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// MarkStarted records that initialization has finished
+func (c *Checker) MarkStarted() {
+	c.started.Store(true)
+}
+
+// Started reports whether initialization has finished
+func (c *Checker) Started() bool {
+	return c.started.Load()
+}
+
+// SetDraining marks the service as shutting down so readiness fails and
+// load balancers stop sending new traffic
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Readiness runs every readiness check. The service is ready only once
+// started, while not draining and when all checks pass.
+func (c *Checker) Readiness(ctx context.Context) (bool, models.ProbeResponse) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	ready := c.Started()
+	results := make(map[string]string, len(names)+1)
+	if c.draining.Load() {
+		ready = false
+		results["shutdown"] = "draining"
+	}
+	for _, name := range names {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := checks[name](checkCtx)
+		cancel()
+
+		if err != nil {
+			ready = false
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	status := StatusReady
+	if !ready {
+		status = StatusNotReady
+	}
+	return ready, models.ProbeResponse{Status: status, Checks: results}
+}
+
+// WritableDir returns a check that verifies a file can be created in dir
+func WritableDir(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", dir, err)
+		}
+		name := file.Name()
+		file.Close()
+		return os.Remove(name)
+	}
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	checker := New()
+	checker.AddReadinessCheck("ok", func(ctx context.Context) error { return nil })
+
+	// Not ready until startup has finished
+	if ready, response := checker.Readiness(context.Background()); ready || response.Status != StatusNotReady {
+		t.Errorf("Expected not ready before startup, got ready=%t status=%s", ready, response.Status)
+	}
+
+	checker.MarkStarted()
+	ready, response := checker.Readiness(context.Background())
+	if !ready || response.Status != StatusReady {
+		t.Errorf("Expected ready after startup, got ready=%t status=%s", ready, response.Status)
+	}
+	if response.Checks["ok"] != "ok" {
+		t.Errorf("Expected check result 'ok', got '%s'", response.Checks["ok"])
+	}
+
+	// A failing dependency makes the service unready and is reported
+	checker.AddReadinessCheck("broken", func(ctx context.Context) error { return errors.New("boom") })
+	ready, response = checker.Readiness(context.Background())
+	if ready {
+		t.Error("Expected not ready with a failing check")
+	}
+	if response.Checks["broken"] != "boom" {
+		t.Errorf("Expected failing check to report its error, got '%s'", response.Checks["broken"])
+	}
+}
+
+func TestReadinessDraining(t *testing.T) {
+	checker := New()
+	checker.MarkStarted()
+
+	checker.SetDraining()
+	ready, response := checker.Readiness(context.Background())
+	if ready || response.Checks["shutdown"] != "draining" {
+		t.Errorf("Expected draining service to be unready, got ready=%t checks=%v", ready, response.Checks)
+	}
+}
+
+func TestWritableDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := WritableDir(dir)(context.Background()); err != nil {
+		t.Errorf("Expected temp dir to be writable, got: %v", err)
+	}
+
+	if err := WritableDir(filepath.Join(dir, "missing"))(context.Background()); err == nil {
+		t.Error("Expected missing dir to fail the check")
+	}
+}
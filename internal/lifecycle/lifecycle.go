@@ -0,0 +1,75 @@
+// Package lifecycle coordinates graceful shutdown of the application's
+// components in a fixed order under a single deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StopFunc stops a component, returning early if ctx expires
+type StopFunc func(ctx context.Context) error
+
+// stage is a named shutdown step
+type stage struct {
+	name string
+	stop StopFunc
+}
+
+// Manager runs registered shutdown stages in registration order
+type Manager struct {
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	stages []stage
+	once   sync.Once
+}
+
+// New creates a lifecycle manager
+func New(logger *logrus.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// OnShutdown registers a stage to run on shutdown. Stages run in the order
+// they were registered, so register them from the outside in: stop taking
+// traffic first and close engines last.
+func (m *Manager) OnShutdown(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stages = append(m.stages, stage{name: name, stop: stop})
+}
+
+// Shutdown runs every stage under the deadline of ctx. A failing or slow
+// stage does not prevent later stages from running; their errors are
+// returned together. Shutdown only runs once.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	var errs []error
+	m.once.Do(func() {
+		m.mu.Lock()
+		stages := append([]stage(nil), m.stages...)
+		m.mu.Unlock()
+
+		for _, s := range stages {
+			start := time.Now()
+			err := s.stop(ctx)
+
+			entry := m.logger.WithFields(logrus.Fields{
+				"stage":       s.name,
+				"duration_ms": time.Since(start).Milliseconds(),
+			})
+			if err != nil {
+				entry.WithError(err).Error("Shutdown stage failed")
+				errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+				continue
+			}
+			entry.Info("Shutdown stage completed")
+		}
+	})
+
+	return errors.Join(errs...)
+}
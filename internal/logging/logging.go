@@ -0,0 +1,176 @@
+// Package logging provides the application logger and request-scoped
+// log fields carried through context.Context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header used to read and return request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	fieldsKey
+)
+
+// New creates the application logger from the logging configuration.
+// This logger is shared by every service so format and level apply globally.
+func New(cfg config.LoggingConfig) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	SetLevel(logger, cfg.Level)
+
+	if cfg.Output == "file" && cfg.File != "" {
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			logger.Warn("Failed to open log file, using stdout")
+		} else {
+			logger.SetOutput(file)
+		}
+	}
+
+	return logger
+}
+
+// SetLevel changes the logger's level, falling back to info for an
+// unknown level name
+func SetLevel(logger *logrus.Logger, name string) {
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+}
+
+// WithRequestID returns a context carrying the given request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithFields returns a context carrying additional request-scoped log fields
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := logrus.Fields{}
+	if existing, ok := ctx.Value(fieldsKey).(logrus.Fields); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey, merged)
+}
+
+// FromContext returns a log entry annotated with the request ID, trace ID
+// and any fields attached to ctx
+func FromContext(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	entry := logrus.NewEntry(logger)
+	if ctx == nil {
+		return entry
+	}
+
+	if fields, ok := ctx.Value(fieldsKey).(logrus.Fields); ok {
+		entry = entry.WithFields(fields)
+	}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		entry = entry.WithField("request_id", requestID)
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		entry = entry.WithField("trace_id", spanCtx.TraceID().String())
+	}
+
+	return entry
+}
+
+// RequestIDMiddleware assigns each request an ID, honoring a well-formed
+// X-Request-ID from the client, and returns it in the response headers
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, requestID)
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware writes one structured log line per request
+func AccessLogMiddleware(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		entry := FromContext(c.Request.Context(), logger).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+			"bytes_out":  c.Writer.Size(),
+		})
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("Request completed")
+		case status >= 400:
+			entry.Warn("Request completed")
+		default:
+			entry.Info("Request completed")
+		}
+	}
+}
+
+// validRequestID accepts short IDs made of printable, non-space ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		seen = RequestIDFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	// Client-supplied ID is honored
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "client-id-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if seen != "client-id-123" {
+		t.Errorf("Expected request ID 'client-id-123' in context, got '%s'", seen)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "client-id-123" {
+		t.Errorf("Expected response header 'client-id-123', got '%s'", got)
+	}
+
+	// Malformed ID is replaced with a generated one
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if seen == "" || strings.Contains(seen, " ") {
+		t.Errorf("Expected generated request ID, got '%s'", seen)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != seen {
+		t.Errorf("Expected response header to match context ID '%s', got '%s'", seen, got)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	logger := logrus.New()
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithFields(ctx, logrus.Fields{"model_id": "dummy"})
+
+	entry := FromContext(ctx, logger)
+	if entry.Data["request_id"] != "req-1" {
+		t.Errorf("Expected request_id field 'req-1', got '%v'", entry.Data["request_id"])
+	}
+	if entry.Data["model_id"] != "dummy" {
+		t.Errorf("Expected model_id field 'dummy', got '%v'", entry.Data["model_id"])
+	}
+}
@@ -0,0 +1,343 @@
+// Package metrics exposes application telemetry in Prometheus format.
+//
+// Collectors are package-level so that any service can record a
+// measurement without having the metrics plumbing threaded through its
+// constructor, which is the usual pattern for Prometheus instrumentation.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "imagerec"
+
+// Engine label values used for inference metrics
+const (
+	EngineTensorFlow = "tensorflow"
+	EngineSimulated  = "simulated"
+	EngineEnsemble   = "ensemble"
+	EnginePrototype  = "prototype"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	inferenceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "inference_duration_seconds",
+		Help:      "Model inference latency by model and engine.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"model", "engine"})
+
+	preprocessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "preprocessing_duration_seconds",
+		Help:      "Image preprocessing latency by stage.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"stage"})
+
+	inferenceQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inference_queue_depth",
+		Help:      "Number of inference requests waiting for a slot per model.",
+	}, []string{"model"})
+
+	inferenceInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inference_in_flight",
+		Help:      "Number of inferences currently running per model.",
+	}, []string{"model"})
+
+	inferenceRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "inference_rejections_total",
+		Help:      "Inference requests shed by the concurrency limiter by model and reason.",
+	}, []string{"model", "reason"})
+
+	inferenceBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "inference_batch_size",
+		Help:      "Number of requests run together in one inference batch per model.",
+		Buckets:   []float64{1, 2, 4, 8, 16, 32, 64},
+	}, []string{"model"})
+
+	inferenceBatchWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "inference_batch_wait_seconds",
+		Help:      "Time the oldest request in a batch waited for the batch to be flushed.",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+	}, []string{"model"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Primary engine circuit breaker state per model (0 closed, 1 half-open, 2 open).",
+	}, []string{"model"})
+
+	engineFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "engine_fallbacks_total",
+		Help:      "Predictions served by the fallback policy instead of the primary engine by model and policy.",
+	}, []string{"model", "policy"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build version and commit of the running binary; always 1.",
+	}, []string{"version", "commit"})
+
+	uploadBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes",
+		Help:      "Size of uploaded images in bytes.",
+		Buckets:   prometheus.ExponentialBuckets(16*1024, 2, 10), // 16KB .. 8MB
+	})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache name and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	modelLoadEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_load_events_total",
+		Help:      "Model lifecycle events by model, engine and event (loaded, failed, unloaded).",
+	}, []string{"model", "engine", "event"})
+
+	storageUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_usage_bytes",
+		Help:      "Bytes stored per managed directory after the last cleanup run.",
+	}, []string{"directory"})
+
+	storageFilesRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_files_removed_total",
+		Help:      "Files removed by cleanup per directory and reason (expired or evicted).",
+	}, []string{"directory", "reason"})
+
+	blobWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blob_writes_total",
+		Help:      "Blob store writes by backend, kind (original or thumbnail) and result (stored, deduplicated or error).",
+	}, []string{"backend", "kind", "result"})
+
+	modelRoutes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_routes_total",
+		Help:      "Predictions without a requested model by routed variant and reason (default, split or override).",
+	}, []string{"model", "reason"})
+
+	shadowComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_comparisons_total",
+		Help:      "Shadow inferences by candidate model and result (agree, disagree, error or skipped).",
+	}, []string{"model", "result"})
+
+	unknownPredictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unknown_predictions_total",
+		Help:      "Predictions rejected as unknown by model and reason (low_confidence, low_margin or high_entropy).",
+	}, []string{"model", "reason"})
+
+	predictionFeedback = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prediction_feedback_total",
+		Help:      "User feedback on predictions by model and rating (up or down).",
+	}, []string{"model", "rating"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		httpRequestsInFlight,
+		inferenceDuration,
+		preprocessingDuration,
+		inferenceQueueDepth,
+		inferenceInFlight,
+		inferenceRejections,
+		inferenceBatchSize,
+		inferenceBatchWait,
+		breakerState,
+		engineFallbacks,
+		buildInfo,
+		uploadBytes,
+		cacheRequests,
+		modelLoadEvents,
+		storageUsage,
+		storageFilesRemoved,
+		blobWrites,
+		modelRoutes,
+		shadowComparisons,
+		unknownPredictions,
+		predictionFeedback,
+	)
+}
+
+// Registry returns the registry holding all application collectors
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// Handler returns an HTTP handler serving the metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Middleware records request latency and in-flight requests for every route
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		c.Next()
+
+		// Use the route template rather than the raw path to keep cardinality bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequestDuration.WithLabelValues(
+			route,
+			c.Request.Method,
+			strconv.Itoa(c.Writer.Status()),
+		).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveInference records the duration of a single inference call
+func ObserveInference(modelID, engine string, duration time.Duration) {
+	inferenceDuration.WithLabelValues(modelID, engine).Observe(duration.Seconds())
+}
+
+// ObservePreprocessing records the duration of a preprocessing stage
+func ObservePreprocessing(stage string, duration time.Duration) {
+	preprocessingDuration.WithLabelValues(stage).Observe(duration.Seconds())
+}
+
+// SetQueueDepth records how many requests are waiting for a model's inference slots
+func SetQueueDepth(modelID string, depth int) {
+	inferenceQueueDepth.WithLabelValues(modelID).Set(float64(depth))
+}
+
+// SetInferenceInFlight records how many inferences are running for a model
+func SetInferenceInFlight(modelID string, running int) {
+	inferenceInFlight.WithLabelValues(modelID).Set(float64(running))
+}
+
+// InferenceRejected records a request shed by the concurrency limiter
+func InferenceRejected(modelID, reason string) {
+	inferenceRejections.WithLabelValues(modelID, reason).Inc()
+}
+
+// ObserveBatch records the size of an inference batch and how long its
+// oldest request waited for the batch to be flushed
+func ObserveBatch(modelID string, size int, wait time.Duration) {
+	inferenceBatchSize.WithLabelValues(modelID).Observe(float64(size))
+	inferenceBatchWait.WithLabelValues(modelID).Observe(wait.Seconds())
+}
+
+// SetBreakerState records a model's circuit breaker state ("closed", "half-open" or "open")
+func SetBreakerState(modelID, state string) {
+	value := 0.0
+	switch state {
+	case "half-open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	breakerState.WithLabelValues(modelID).Set(value)
+}
+
+// EngineFallback records a prediction served by the fallback policy
+func EngineFallback(modelID, policy string) {
+	engineFallbacks.WithLabelValues(modelID, policy).Inc()
+}
+
+// SetBuildInfo exports the version and commit of the running binary
+func SetBuildInfo(version, commit string) {
+	buildInfo.WithLabelValues(version, commit).Set(1)
+}
+
+// ObserveUpload records the size of an uploaded image
+func ObserveUpload(size int64) {
+	uploadBytes.Observe(float64(size))
+}
+
+// CacheHit records a successful cache lookup
+func CacheHit(cache string) {
+	cacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+// CacheMiss records a failed cache lookup
+func CacheMiss(cache string) {
+	cacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+// ModelLoadEvent records a model lifecycle event such as "loaded", "failed" or "unloaded"
+func ModelLoadEvent(modelID, engine, event string) {
+	modelLoadEvents.WithLabelValues(modelID, engine, event).Inc()
+}
+
+// SetStorageUsage records the bytes stored in a managed directory
+func SetStorageUsage(directory string, bytes int64) {
+	storageUsage.WithLabelValues(directory).Set(float64(bytes))
+}
+
+// FilesRemoved records files deleted by cleanup for the given reason
+func FilesRemoved(directory, reason string, count int) {
+	storageFilesRemoved.WithLabelValues(directory, reason).Add(float64(count))
+}
+
+// BlobWrite records a blob store write; result is "stored", "deduplicated"
+// when the content was already present, or "error"
+func BlobWrite(backend, kind, result string) {
+	blobWrites.WithLabelValues(backend, kind, result).Inc()
+}
+
+// ModelRouted records the variant chosen for a request without a model_id
+func ModelRouted(modelID, reason string) {
+	modelRoutes.WithLabelValues(modelID, reason).Inc()
+}
+
+// ShadowComparison records the outcome of a shadow inference; result is
+// "agree" or "disagree" with the primary top-1 class, "error", or "skipped"
+// when the shadow capacity was exhausted
+func ShadowComparison(modelID, result string) {
+	shadowComparisons.WithLabelValues(modelID, result).Inc()
+}
+
+// UnknownPrediction records a prediction rejected as unknown
+func UnknownPrediction(modelID, reason string) {
+	unknownPredictions.WithLabelValues(modelID, reason).Inc()
+}
+
+// PredictionFeedback records user feedback on a prediction
+func PredictionFeedback(modelID, rating string) {
+	predictionFeedback.WithLabelValues(modelID, rating).Inc()
+}
@@ -9,6 +9,11 @@ type PredictionRequest struct {
 	ImageData []byte `json:"image_data"`
 	Filename  string `json:"filename"`
 	ModelID   string `json:"model_id,omitempty"`
+	// Rejection replaces the model's rejection rules for this request
+	Rejection *RejectionRules `json:"rejection,omitempty"`
+	// RollupDepth reports predictions as their ancestors at this depth of
+	// the model's taxonomy, where 0 is the root
+	RollupDepth *int `json:"rollup_depth,omitempty"`
 }
 
 // PredictionResult represents the result of an image prediction
@@ -19,6 +24,129 @@ type PredictionResult struct {
 	ProcessedAt time.Time              `json:"processed_at"`
 	ProcessTime float64                `json:"process_time_ms"`
 	ModelInfo   ModelInfo              `json:"model_info"`
+	RequestID   string                 `json:"request_id,omitempty"`
+	Engine      string                 `json:"engine"`
+	Fallback    bool                   `json:"fallback,omitempty"`
+	// Calibration is the calibration method applied to the confidences
+	Calibration string `json:"calibration,omitempty"`
+	// Outcome is unknown when the rejection rules found the predictions
+	// not decisive enough, with the reason in Rejection
+	Outcome   string     `json:"outcome"`
+	Rejection *Rejection `json:"rejection,omitempty"`
+	// RollupDepth is the taxonomy depth the predictions were rolled up to
+	RollupDepth *int `json:"rollup_depth,omitempty"`
+	// Members breaks an ensemble prediction down by member model
+	Members []MemberPrediction `json:"members,omitempty"`
+	// Routing records how the model was chosen when none was requested
+	Routing *RoutingInfo `json:"routing,omitempty"`
+	// Shadow holds the predictions of candidate models run on the same
+	// image; they are added in the background after the response
+	Shadow []ShadowPrediction `json:"shadow,omitempty"`
+	// Feedback is the latest user feedback on the prediction
+	Feedback *Feedback `json:"feedback,omitempty"`
+	// ImageURL and ThumbnailURL are signed, expiring links to the stored
+	// image, filled in when a result is served
+	ImageURL     string `json:"image_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// Feedback ratings
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// FeedbackRequest tells whether a prediction was right. A correct label
+// other than the top prediction implies a thumbs down, so either the
+// rating or the correct label is enough.
+type FeedbackRequest struct {
+	Rating       string `json:"rating,omitempty"`
+	CorrectLabel string `json:"correct_label,omitempty"`
+	Comment      string `json:"comment,omitempty"`
+}
+
+// Feedback is user feedback on the top prediction of a result
+type Feedback struct {
+	Rating         string    `json:"rating"`
+	PredictedClass string    `json:"predicted_class"`
+	CorrectLabel   string    `json:"correct_label,omitempty"`
+	Comment        string    `json:"comment,omitempty"`
+	SubmittedAt    time.Time `json:"submitted_at"`
+}
+
+// FeedbackAccuracy estimates how often predictions are right from the
+// feedback on them, with a 95% Wilson score interval
+type FeedbackAccuracy struct {
+	Ratings  int64   `json:"ratings"`
+	Correct  int64   `json:"correct"`
+	Accuracy float64 `json:"accuracy"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// Routing reasons for the model chosen for a request without a model_id
+const (
+	RouteDefault  = "default"
+	RouteSplit    = "split"
+	RouteOverride = "override"
+)
+
+// RoutingInfo records which variant served a request and why
+type RoutingInfo struct {
+	Variant string `json:"variant"`
+	Reason  string `json:"reason"`
+}
+
+// VariantStats compares the traffic and results of one routed variant
+type VariantStats struct {
+	ModelID        string  `json:"model_id"`
+	Weight         int     `json:"weight"`
+	Requests       int64   `json:"requests"`
+	Errors         int64   `json:"errors"`
+	AvgTime        float64 `json:"avg_time_ms"`
+	MeanConfidence float64 `json:"mean_confidence"`
+}
+
+// ShadowPrediction is the output of a candidate model run on live traffic
+type ShadowPrediction struct {
+	ModelID     string                 `json:"model_id"`
+	Engine      string                 `json:"engine"`
+	Predictions []ClassificationResult `json:"predictions"`
+	ProcessTime float64                `json:"process_time_ms"`
+	Agrees      bool                   `json:"agrees"`
+}
+
+// ShadowReport compares each candidate model with the models serving traffic
+type ShadowReport struct {
+	Models     []string          `json:"models"`
+	Candidates []ShadowCandidate `json:"candidates"`
+}
+
+// ShadowCandidate summarizes how a candidate model compares on live traffic.
+// Latencies are engine times in milliseconds; the delta is candidate minus
+// primary, so a positive delta means the candidate is slower.
+type ShadowCandidate struct {
+	ModelID            string               `json:"model_id"`
+	Compared           int64                `json:"compared"`
+	Agreements         int64                `json:"agreements"`
+	AgreementRate      float64              `json:"agreement_rate"`
+	Failures           int64                `json:"failures"`
+	Skipped            int64                `json:"skipped"`
+	MeanPrimaryLatency float64              `json:"mean_primary_latency_ms"`
+	MeanShadowLatency  float64              `json:"mean_shadow_latency_ms"`
+	MeanLatencyDelta   float64              `json:"mean_latency_delta_ms"`
+	Disagreements      []ShadowDisagreement `json:"disagreements"`
+}
+
+// ShadowDisagreement is a result whose top-1 class differs from a candidate's
+type ShadowDisagreement struct {
+	ResultID          string    `json:"result_id"`
+	PrimaryModel      string    `json:"primary_model"`
+	PrimaryClass      string    `json:"primary_class"`
+	PrimaryConfidence float64   `json:"primary_confidence"`
+	ShadowClass       string    `json:"shadow_class"`
+	ShadowConfidence  float64   `json:"shadow_confidence"`
+	At                time.Time `json:"at"`
 }
 
 // ClassificationResult represents a single classification prediction
@@ -28,6 +156,24 @@ type ClassificationResult struct {
 	Description string  `json:"description"`
 	Confidence  float64 `json:"confidence"`
 	Probability float64 `json:"probability"`
+	// RawConfidence is the model's score before calibration; Confidence
+	// and Probability are calibrated when the model has calibration
+	RawConfidence float64 `json:"raw_confidence"`
+	// Path lists the labels from the root of the model's taxonomy down to
+	// ClassName, when the model has a taxonomy
+	Path        []string          `json:"path,omitempty"`
+	Synonyms    []string          `json:"synonyms,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// ClassInfo describes a class in a model's labels file
+type ClassInfo struct {
+	DisplayName string `json:"display_name,omitempty"`
+	// DisplayNames holds localized display names keyed by language tag
+	DisplayNames map[string]string `json:"display_names,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Synonyms     []string          `json:"synonyms,omitempty"`
+	ExternalIDs  map[string]string `json:"external_ids,omitempty"`
 }
 
 // ImageMetadata contains metadata about the uploaded image
@@ -39,6 +185,13 @@ type ImageMetadata struct {
 	Format      string `json:"format"`
 	ContentType string `json:"content_type"`
 	UploadedAt  time.Time `json:"uploaded_at"`
+	// ImageKey and ThumbnailKey locate the stored original and its
+	// thumbnail in the blob store; empty when uploads are not kept
+	ImageKey     string `json:"image_key,omitempty"`
+	ThumbnailKey string `json:"thumbnail_key,omitempty"`
+	// SourceResultID links a result reprocessed by a backfill to the
+	// historical result it was compared with
+	SourceResultID string `json:"source_result_id,omitempty"`
 }
 
 // ModelInfo contains information about the model used for prediction
@@ -52,6 +205,144 @@ type ModelInfo struct {
 	Classes      []string          `json:"classes"`
 	LoadedAt     time.Time         `json:"loaded_at"`
 	Metadata     map[string]string `json:"metadata"`
+	// Ensemble makes the model a combination of other loaded models
+	Ensemble *EnsembleSpec `json:"ensemble,omitempty"`
+	// Calibration maps the model's raw scores to calibrated confidences
+	Calibration *Calibration `json:"calibration,omitempty"`
+	// Rejection turns indecisive predictions into an unknown outcome
+	Rejection *RejectionRules `json:"rejection,omitempty"`
+	// Embedding reports that the model exposes image embeddings, which
+	// label sets are built on
+	Embedding bool `json:"embedding,omitempty"`
+	// BaseModel is the model whose embeddings a label set classifies
+	BaseModel string `json:"base_model,omitempty"`
+}
+
+// Prediction outcomes
+const (
+	OutcomeClassified = "classified"
+	OutcomeUnknown    = "unknown"
+)
+
+// Rejection reasons
+const (
+	RejectLowConfidence = "low_confidence"
+	RejectLowMargin     = "low_margin"
+	RejectHighEntropy   = "high_entropy"
+)
+
+// RejectionRules reject a prediction as unknown when the top confidence is
+// below MinConfidence, the gap between the top two confidences is below
+// MinMargin, or the normalized entropy of the predictions is above
+// MaxEntropy. A zero threshold disables its rule.
+type RejectionRules struct {
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	MinMargin     float64 `json:"min_margin,omitempty"`
+	MaxEntropy    float64 `json:"max_entropy,omitempty"`
+}
+
+// Rejection records the rule that rejected a prediction
+type Rejection struct {
+	Reason    string  `json:"reason"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Calibration methods
+const (
+	// CalibrationTemperature divides the logits of every class by a single
+	// temperature before the softmax
+	CalibrationTemperature = "temperature"
+	// CalibrationPlatt maps each class's score through a sigmoid fitted
+	// for that class
+	CalibrationPlatt = "platt"
+)
+
+// Calibration holds the parameters fitted for a model on a labeled
+// validation set
+type Calibration struct {
+	Method      string                 `json:"method"`
+	Temperature float64                `json:"temperature,omitempty"`
+	Platt       map[string]PlattParams `json:"platt,omitempty"`
+	Samples     int                    `json:"samples,omitempty"`
+	FittedAt    *time.Time             `json:"fitted_at,omitempty"`
+}
+
+// PlattParams maps a raw probability p to sigmoid(A*logit(p) + B)
+type PlattParams struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// Ensemble combination strategies
+const (
+	// EnsembleMeanProbability ranks classes by the weighted mean of the
+	// members' probabilities
+	EnsembleMeanProbability = "mean_probability"
+	// EnsembleWeightedVote ranks classes by the weight of the members
+	// whose top-1 class they are
+	EnsembleWeightedVote = "weighted_vote"
+	// EnsembleMax ranks classes by their highest probability in any member
+	EnsembleMax = "max"
+)
+
+// EnsembleSpec defines an ensemble by its members and how their
+// predictions are combined
+type EnsembleSpec struct {
+	Strategy string           `json:"strategy"`
+	Members  []EnsembleMember `json:"members"`
+}
+
+// EnsembleMember references a member model; a zero weight counts as 1
+type EnsembleMember struct {
+	ModelID string  `json:"model_id"`
+	Weight  float64 `json:"weight,omitempty"`
+}
+
+// MemberPrediction is one member's share of an ensemble prediction
+type MemberPrediction struct {
+	ModelID     string                 `json:"model_id"`
+	Weight      float64                `json:"weight"`
+	Engine      string                 `json:"engine,omitempty"`
+	Predictions []ClassificationResult `json:"predictions,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// ModelTypeLabelSet is the metadata type of the virtual models serving
+// label sets
+const ModelTypeLabelSet = "label_set"
+
+// LabelSet classifies images into custom labels by the nearest prototype
+// embedding of a base model. Each label set is served as a virtual model
+// with the same ID.
+type LabelSet struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	BaseModel   string          `json:"base_model"`
+	Labels      []LabelSetLabel `json:"labels"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// LabelSetLabel is one label of a label set. Its prototype is the mean
+// embedding of its example images.
+type LabelSetLabel struct {
+	Label     string    `json:"label"`
+	Examples  int       `json:"examples"`
+	Prototype []float64 `json:"prototype,omitempty"`
+}
+
+// LabelSetRequest creates or updates a label set. Examples are images per
+// label; on update they are added to the label's existing examples, and
+// RemoveLabels drops labels with all their examples.
+type LabelSetRequest struct {
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	BaseModel    string              `json:"base_model"`
+	Examples     map[string][][]byte `json:"examples"`
+	RemoveLabels []string            `json:"remove_labels,omitempty"`
 }
 
 // UploadResponse represents the response after uploading an image
@@ -65,19 +356,47 @@ type UploadResponse struct {
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // HealthCheck represents the health status of the service
 type HealthCheck struct {
-	Status      string            `json:"status"`
-	Timestamp   time.Time         `json:"timestamp"`
-	Uptime      string            `json:"uptime"`
-	Version     string            `json:"version"`
-	Services    map[string]string `json:"services"`
-	ModelStatus ModelStatus       `json:"model_status"`
+	Status      string                   `json:"status"`
+	Timestamp   time.Time                `json:"timestamp"`
+	Uptime      string                   `json:"uptime"`
+	Version     string                   `json:"version"`
+	Commit      string                   `json:"commit,omitempty"`
+	Services    map[string]string        `json:"services"`
+	ModelStatus ModelStatus              `json:"model_status"`
+	Queues      map[string]QueueStatus   `json:"queues,omitempty"`
+	Breakers    map[string]BreakerStatus `json:"breakers,omitempty"`
+	Storage     *StorageStats            `json:"storage,omitempty"`
+	Variants    []VariantStats           `json:"variants,omitempty"`
+}
+
+// ProbeResponse represents the result of a liveness, readiness or startup probe
+type ProbeResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// BreakerStatus represents the engine circuit breaker state of a model
+type BreakerStatus struct {
+	State       string  `json:"state"`
+	Requests    int     `json:"requests"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// QueueStatus represents the inference queue state of a model
+type QueueStatus struct {
+	Running       int  `json:"running"`
+	Waiting       int  `json:"waiting"`
+	MaxConcurrent int  `json:"max_concurrent"`
+	MaxQueue      int  `json:"max_queue"`
+	Saturated     bool `json:"saturated"`
 }
 
 // ModelStatus represents the status of loaded models
@@ -94,6 +413,11 @@ type ModelHealth struct {
 	Predictions int64     `json:"predictions"`
 	AvgTime     float64   `json:"avg_time_ms"`
 	Errors      int64     `json:"errors"`
+	Unknown     int64     `json:"unknown"`
+	// Feedback estimates the model's accuracy from user feedback, overall
+	// and by predicted class
+	Feedback      *FeedbackAccuracy           `json:"feedback,omitempty"`
+	ClassFeedback map[string]FeedbackAccuracy `json:"class_feedback,omitempty"`
 }
 
 // ModelStats represents statistics about the models and system
@@ -153,17 +477,22 @@ const (
 
 // Error codes for different types of errors
 const (
-	ErrorCodeInvalidImage      = "INVALID_IMAGE"
-	ErrorCodeUnsupportedFormat = "UNSUPPORTED_FORMAT"
-	ErrorCodeFileTooLarge      = "FILE_TOO_LARGE"
-	ErrorCodeModelNotFound     = "MODEL_NOT_FOUND"
-	ErrorCodeModelLoadFailed   = "MODEL_LOAD_FAILED"
-	ErrorCodePredictionFailed  = "PREDICTION_FAILED"
-	ErrorCodeInternalError     = "INTERNAL_ERROR"
-	ErrorCodeRateLimitExceeded = "RATE_LIMIT_EXCEEDED"
-	ErrorCodeInvalidRequest    = "INVALID_REQUEST"
-	ErrorCodeNotFound          = "NOT_FOUND"
+	ErrorCodeInvalidImage       = "INVALID_IMAGE"
+	ErrorCodeUnsupportedFormat  = "UNSUPPORTED_FORMAT"
+	ErrorCodeFileTooLarge       = "FILE_TOO_LARGE"
+	ErrorCodeModelNotFound      = "MODEL_NOT_FOUND"
+	ErrorCodeModelLoadFailed    = "MODEL_LOAD_FAILED"
+	ErrorCodePredictionFailed   = "PREDICTION_FAILED"
+	ErrorCodeInternalError      = "INTERNAL_ERROR"
+	ErrorCodeRateLimitExceeded  = "RATE_LIMIT_EXCEEDED"
+	ErrorCodeInvalidRequest     = "INVALID_REQUEST"
+	ErrorCodeNotFound           = "NOT_FOUND"
 	ErrorCodeServiceUnavailable = "SERVICE_UNAVAILABLE"
+	ErrorCodeGatewayTimeout     = "GATEWAY_TIMEOUT"
+	ErrorCodeUnauthorized       = "UNAUTHORIZED"
+	ErrorCodeRestartRequired    = "RESTART_REQUIRED"
+	ErrorCodeForbidden          = "FORBIDDEN"
+	ErrorCodeConflict           = "CONFLICT"
 )
 
 // PredictionStatus represents the status of a prediction job
@@ -187,6 +516,179 @@ type Job struct {
 	Progress  float64          `json:"progress"`
 }
 
+// StorageStats reports managed storage usage and the last cleanup run
+type StorageStats struct {
+	Directories []DirectoryUsage `json:"directories"`
+	TotalBytes  int64            `json:"total_bytes"`
+	MaxBytes    int64            `json:"max_bytes,omitempty"`
+	DryRun      bool             `json:"dry_run"`
+	LastCleanup *CleanupRun      `json:"last_cleanup,omitempty"`
+}
+
+// DirectoryUsage is the usage and retention policy of a managed directory
+type DirectoryUsage struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Retention string `json:"retention"`
+}
+
+// CleanupRun summarizes a single cleanup pass. In dry-run mode the counts
+// are what would have been removed.
+type CleanupRun struct {
+	StartedAt    time.Time `json:"started_at"`
+	DurationMs   float64   `json:"duration_ms"`
+	ExpiredFiles int       `json:"expired_files"`
+	ExpiredBytes int64     `json:"expired_bytes"`
+	EvictedFiles int       `json:"evicted_files"`
+	EvictedBytes int64     `json:"evicted_bytes"`
+	Errors       int       `json:"errors"`
+}
+
+// ConfigChange is a single setting changed by a configuration reload
+type ConfigChange struct {
+	Field      string `json:"field"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// ConfigReloadResponse reports the outcome of a configuration reload
+type ConfigReloadResponse struct {
+	Applied bool           `json:"applied"`
+	Changes []ConfigChange `json:"changes"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+// BackfillRequest asks for stored uploads to be reprocessed with a model
+type BackfillRequest struct {
+	ModelID string `json:"model_id" binding:"required"`
+	// Limit bounds how many historical results are reprocessed (0 for all)
+	Limit int `json:"limit,omitempty"`
+	// Since skips historical results processed before this time
+	Since time.Time `json:"since,omitempty"`
+}
+
+// BackfillRun tracks the reprocessing of stored uploads with a model
+type BackfillRun struct {
+	ID        string           `json:"id"`
+	ModelID   string           `json:"model_id"`
+	Status    PredictionStatus `json:"status"`
+	Total     int              `json:"total"`
+	Processed int              `json:"processed"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Summary   *BackfillSummary `json:"summary,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// BackfillSummary compares the reprocessed results with the historical ones
+type BackfillSummary struct {
+	Compared     int `json:"compared"`
+	Failed       int `json:"failed"`
+	LabelChanges int `json:"label_changes"`
+	// MeanConfidenceShift is the mean change in confidence of the
+	// historical top class
+	MeanConfidenceShift float64        `json:"mean_confidence_shift"`
+	Classes             []ClassShift   `json:"classes"`
+	Items               []BackfillItem `json:"items"`
+}
+
+// ClassShift summarizes how results whose historical top class was Class
+// changed when reprocessed
+type ClassShift struct {
+	Class               string         `json:"class"`
+	Images              int            `json:"images"`
+	LabelChanges        int            `json:"label_changes"`
+	ChangedTo           map[string]int `json:"changed_to,omitempty"`
+	MeanConfidenceShift float64        `json:"mean_confidence_shift"`
+}
+
+// BackfillItem pairs a historical result with its reprocessed result
+type BackfillItem struct {
+	SourceResultID string  `json:"source_result_id"`
+	ResultID       string  `json:"result_id,omitempty"`
+	ImageKey       string  `json:"image_key"`
+	OldClass       string  `json:"old_class"`
+	NewClass       string  `json:"new_class,omitempty"`
+	OldConfidence  float64 `json:"old_confidence"`
+	// NewConfidence is the reprocessed confidence of the historical top class
+	NewConfidence float64 `json:"new_confidence"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Dataset export formats
+const (
+	ExportFormatImageNet = "imagenet"
+	ExportFormatCSV      = "csv"
+	ExportFormatJSONL    = "jsonl"
+	ExportFormatCOCO     = "coco"
+)
+
+// Sources of exported labels
+const (
+	LabelSourceCorrected = "corrected"
+	LabelSourceConfirmed = "confirmed"
+	LabelSourcePredicted = "predicted"
+)
+
+// Feedback filters of a dataset export
+const (
+	ExportFeedbackAny        = "any"
+	ExportFeedbackReviewed   = "reviewed"
+	ExportFeedbackCorrected  = "corrected"
+	ExportFeedbackConfirmed  = "confirmed"
+	ExportFeedbackUnreviewed = "unreviewed"
+)
+
+// ExportRequest selects stored images and their labels for a training
+// dataset. Images are labeled by feedback when they have any, otherwise
+// by their top prediction if it is at least MinConfidence.
+type ExportRequest struct {
+	Format string `json:"format"`
+	// ModelID keeps only results of this model
+	ModelID string `json:"model_id,omitempty"`
+	// Labels keeps only images with one of these labels
+	Labels []string `json:"labels,omitempty"`
+	// Since and Until bound when the results were processed
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+	// MinConfidence is the confidence a prediction needs to be exported
+	// without feedback; zero uses the default
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	// Feedback keeps any labeled image, only reviewed (corrected or
+	// confirmed) ones, or only unreviewed ones
+	Feedback string `json:"feedback,omitempty"`
+	// Limit bounds the number of exported images (0 for all)
+	Limit int `json:"limit,omitempty"`
+}
+
+// ExportItem is one image of a dataset export
+type ExportItem struct {
+	ResultID    string `json:"result_id"`
+	ImageKey    string `json:"image_key"`
+	Path        string `json:"path"`
+	Label       string `json:"label"`
+	LabelSource string `json:"label_source"`
+	// PredictedClass and Confidence are the result's top prediction
+	PredictedClass string    `json:"predicted_class"`
+	Confidence     float64   `json:"confidence"`
+	ModelID        string    `json:"model_id"`
+	Width          int       `json:"width,omitempty"`
+	Height         int       `json:"height,omitempty"`
+	ProcessedAt    time.Time `json:"processed_at"`
+}
+
+// ExportSummary reports what an export wrote
+type ExportSummary struct {
+	Format string         `json:"format"`
+	Images int            `json:"images"`
+	Labels map[string]int `json:"labels"`
+	// Missing counts selected images no longer in the blob store
+	Missing int `json:"missing"`
+}
+
 // NewErrorResponse creates a new error response
 func NewErrorResponse(code, message, details string) *ErrorResponse {
 	return &ErrorResponse{
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// backfillPollInterval is how often job status and queue space are checked
+const backfillPollInterval = 50 * time.Millisecond
+
+var (
+	// ErrInvalidBackfill is returned for backfill requests that cannot be run
+	ErrInvalidBackfill = errors.New("invalid backfill")
+
+	// ErrBackfillModelNotFound is returned when the target model is not loaded
+	ErrBackfillModelNotFound = errors.New("backfill model not found")
+
+	// ErrBackfillNotFound is returned for unknown backfill run IDs
+	ErrBackfillNotFound = errors.New("backfill not found")
+)
+
+// BackfillService reprocesses stored uploads with another model through
+// the job service and compares the new results with the historical ones.
+// Each stored image is reprocessed once, against its earliest result from
+// a different model. The new results link to the same stored blobs.
+type BackfillService struct {
+	jobs         *JobService
+	modelService *ModelService
+	store        BlobStore
+	logger       *logrus.Logger
+	pollInterval time.Duration
+
+	mu   sync.RWMutex
+	runs map[string]*models.BackfillRun
+}
+
+// NewBackfillService creates a backfill service reading history from store
+func NewBackfillService(jobs *JobService, modelService *ModelService, store BlobStore, logger *logrus.Logger) *BackfillService {
+	return &BackfillService{
+		jobs:         jobs,
+		modelService: modelService,
+		store:        store,
+		logger:       logger,
+		pollInterval: backfillPollInterval,
+		runs:         make(map[string]*models.BackfillRun),
+	}
+}
+
+// Start validates the request and reprocesses in the background. Progress
+// is available through Get.
+func (s *BackfillService) Start(req models.BackfillRequest) (*models.BackfillRun, error) {
+	run, err := s.newRun(req)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.execute(context.Background(), run, req)
+
+	return s.Get(run.ID)
+}
+
+// Run reprocesses synchronously and returns the finished run
+func (s *BackfillService) Run(ctx context.Context, req models.BackfillRequest) (*models.BackfillRun, error) {
+	run, err := s.newRun(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.execute(ctx, run, req)
+
+	return s.Get(run.ID)
+}
+
+// Get returns a snapshot of a backfill run
+func (s *BackfillService) Get(runID string) (*models.BackfillRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, exists := s.runs[runID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrBackfillNotFound, runID)
+	}
+
+	snapshot := *run
+	return &snapshot, nil
+}
+
+// newRun checks the request and target model and registers a pending run
+func (s *BackfillService) newRun(req models.BackfillRequest) (*models.BackfillRun, error) {
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidBackfill)
+	}
+	if _, err := s.modelService.GetModel(req.ModelID); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBackfillModelNotFound, req.ModelID)
+	}
+
+	now := time.Now()
+	run := &models.BackfillRun{
+		ID:        newBackfillID(),
+		ModelID:   req.ModelID,
+		Status:    models.StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	s.runs[run.ID] = run
+	s.mu.Unlock()
+
+	return run, nil
+}
+
+// execute reprocesses the selected history and records the summary
+func (s *BackfillService) execute(ctx context.Context, run *models.BackfillRun, req models.BackfillRequest) {
+	log := s.logger.WithFields(logrus.Fields{"backfill_id": run.ID, "model_id": req.ModelID})
+
+	sources, err := s.history(ctx, req)
+	if err != nil {
+		s.finish(run, nil, err)
+		log.Errorf("Backfill failed: %v", err)
+		return
+	}
+
+	s.update(run, func(run *models.BackfillRun) {
+		run.Status = models.StatusProcessing
+		run.Total = len(sources)
+	})
+	log.Infof("Backfill started for %d stored images", len(sources))
+
+	// Keep a bounded number of images in flight so a long history is not
+	// held in memory all at once
+	items := make([]models.BackfillItem, len(sources))
+	window := make(chan struct{}, max(s.jobs.workers*2, 1))
+	var wg sync.WaitGroup
+
+submit:
+	for i, source := range sources {
+		select {
+		case window <- struct{}{}:
+		case <-ctx.Done():
+			break submit
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-window }()
+
+			items[i] = s.reprocess(ctx, source, req.ModelID)
+			s.update(run, func(run *models.BackfillRun) {
+				run.Processed++
+			})
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		s.finish(run, nil, fmt.Errorf("backfill interrupted: %w", err))
+		log.Warn("Backfill interrupted")
+		return
+	}
+
+	summary := summarizeBackfill(items)
+	s.finish(run, summary, nil)
+	log.WithFields(logrus.Fields{
+		"compared":      summary.Compared,
+		"failed":        summary.Failed,
+		"label_changes": summary.LabelChanges,
+	}).Info("Backfill completed")
+}
+
+// history returns the earliest archived result of each stored image that
+// was not produced by the target model, oldest first. Results are loaded
+// in creation order, so results from before req.Since are skipped without
+// loading them and the walk stops once req.Limit images are found.
+func (s *BackfillService) history(ctx context.Context, req models.BackfillRequest) ([]*models.PredictionResult, error) {
+	keys, err := s.store.List(ctx, resultsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keys = sortResultKeys(keys)
+
+	earliest := make(map[string]*models.PredictionResult)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		created, timed := resultKeyTime(key)
+		if timed && created.Before(req.Since) {
+			continue
+		}
+		// Every later result is newer than the images found so far, so
+		// it could only fall beyond the limit
+		if timed && req.Limit > 0 && len(earliest) >= req.Limit {
+			break
+		}
+
+		result, err := loadResult(ctx, s.store, key)
+		if err != nil {
+			s.logger.Warnf("Skipping unreadable result %s: %v", key, err)
+			continue
+		}
+		if result.Metadata.ImageKey == "" || len(result.Predictions) == 0 ||
+			result.ModelInfo.ID == req.ModelID || result.ProcessedAt.Before(req.Since) {
+			continue
+		}
+		if current, ok := earliest[result.Metadata.ImageKey]; !ok || result.ProcessedAt.Before(current.ProcessedAt) {
+			earliest[result.Metadata.ImageKey] = result
+		}
+	}
+
+	sources := make([]*models.PredictionResult, 0, len(earliest))
+	for _, result := range earliest {
+		sources = append(sources, result)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].ProcessedAt.Before(sources[j].ProcessedAt)
+	})
+
+	if req.Limit > 0 && len(sources) > req.Limit {
+		sources = sources[:req.Limit]
+	}
+	return sources, nil
+}
+
+// resultKeyTime returns when an archived result was created from the
+// timestamp in its "pred_<unix nanoseconds>" ID
+func resultKeyTime(key string) (time.Time, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(key, resultsPrefix), ".json")
+	digits, ok := strings.CutPrefix(id, "pred_")
+	if !ok {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// sortResultKeys orders result keys by creation time, after any keys
+// whose ID carries no timestamp
+func sortResultKeys(keys []string) []string {
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, aTimed := resultKeyTime(keys[i])
+		b, bTimed := resultKeyTime(keys[j])
+		if aTimed != bTimed {
+			return bTimed
+		}
+		return aTimed && a.Before(b)
+	})
+	return keys
+}
+
+// reprocess runs one stored image through the target model as a job
+func (s *BackfillService) reprocess(ctx context.Context, source *models.PredictionResult, modelID string) models.BackfillItem {
+	top := source.Predictions[0]
+	item := models.BackfillItem{
+		SourceResultID: source.ID,
+		ImageKey:       source.Metadata.ImageKey,
+		OldClass:       top.ClassName,
+		OldConfidence:  top.Confidence,
+	}
+
+	data, err := s.store.Get(ctx, source.Metadata.ImageKey)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+
+	request := models.PredictionRequest{
+		ImageData: data,
+		Filename:  source.Metadata.Filename,
+		ModelID:   modelID,
+	}
+	metadata := source.Metadata
+	metadata.SourceResultID = source.ID
+	job, err := s.submit(ctx, request, metadata)
+	if err == nil {
+		job, err = s.await(ctx, job.ID)
+	}
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	if job.Status == models.StatusFailed {
+		item.Error = job.Error.Details
+		return item
+	}
+
+	item.ResultID = job.Result.ID
+	if len(job.Result.Predictions) > 0 {
+		item.NewClass = job.Result.Predictions[0].ClassName
+	}
+	for _, pred := range job.Result.Predictions {
+		if pred.ClassName == item.OldClass {
+			item.NewConfidence = pred.Confidence
+			break
+		}
+	}
+	return item
+}
+
+// submit queues a job, waiting for space while the queue is full
+func (s *BackfillService) submit(ctx context.Context, request models.PredictionRequest, metadata models.ImageMetadata) (*models.Job, error) {
+	for {
+		job, err := s.jobs.SubmitStored(ctx, request, metadata)
+		if !errors.Is(err, ErrJobQueueFull) {
+			return job, err
+		}
+		select {
+		case <-time.After(s.pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// await polls a job until it completes or fails
+func (s *BackfillService) await(ctx context.Context, jobID string) (*models.Job, error) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.jobs.Get(jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == models.StatusCompleted || job.Status == models.StatusFailed {
+			return job, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.jobs.runCtx.Done():
+			return nil, ErrJobServiceClosed
+		}
+	}
+}
+
+// update applies fn to a run under the lock
+func (s *BackfillService) update(run *models.BackfillRun, fn func(run *models.BackfillRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(run)
+	run.UpdatedAt = time.Now()
+}
+
+// finish marks a run completed with its summary, or failed with err
+func (s *BackfillService) finish(run *models.BackfillRun, summary *models.BackfillSummary, err error) {
+	s.update(run, func(run *models.BackfillRun) {
+		if err != nil {
+			run.Status = models.StatusFailed
+			run.Error = err.Error()
+			return
+		}
+		run.Status = models.StatusCompleted
+		run.Summary = summary
+	})
+}
+
+// summarizeBackfill aggregates label changes and confidence shifts per
+// historical top class
+func summarizeBackfill(items []models.BackfillItem) *models.BackfillSummary {
+	summary := &models.BackfillSummary{
+		Classes: []models.ClassShift{},
+		Items:   items,
+	}
+
+	classes := make(map[string]*models.ClassShift)
+	for _, item := range items {
+		if item.Error != "" {
+			summary.Failed++
+			continue
+		}
+
+		shift := item.NewConfidence - item.OldConfidence
+		summary.Compared++
+		summary.MeanConfidenceShift += shift
+
+		class, ok := classes[item.OldClass]
+		if !ok {
+			class = &models.ClassShift{Class: item.OldClass}
+			classes[item.OldClass] = class
+		}
+		class.Images++
+		class.MeanConfidenceShift += shift
+
+		if item.NewClass != item.OldClass {
+			summary.LabelChanges++
+			class.LabelChanges++
+			if class.ChangedTo == nil {
+				class.ChangedTo = make(map[string]int)
+			}
+			class.ChangedTo[item.NewClass]++
+		}
+	}
+
+	if summary.Compared > 0 {
+		summary.MeanConfidenceShift /= float64(summary.Compared)
+	}
+	for _, class := range classes {
+		class.MeanConfidenceShift /= float64(class.Images)
+		summary.Classes = append(summary.Classes, *class)
+	}
+	sort.Slice(summary.Classes, func(i, j int) bool {
+		a, b := summary.Classes[i], summary.Classes[j]
+		if a.Images != b.Images {
+			return a.Images > b.Images
+		}
+		return a.Class < b.Class
+	})
+
+	return summary
+}
+
+// newBackfillID generates a random backfill run ID
+func newBackfillID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("backfill_%d", time.Now().UnixNano())
+	}
+	return "backfill_" + hex.EncodeToString(b)
+}
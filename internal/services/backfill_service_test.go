@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// labelPredictor predicts the label mapped to the image data and records
+// which historical result each prediction was made for
+type labelPredictor struct {
+	labels map[string]models.ClassificationResult
+
+	mu      sync.Mutex
+	sources map[string]string
+}
+
+func (p *labelPredictor) PredictImage(ctx context.Context, imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error) {
+	p.mu.Lock()
+	if p.sources == nil {
+		p.sources = make(map[string]string)
+	}
+	p.sources[string(imageData)] = metadata.SourceResultID
+	p.mu.Unlock()
+
+	return &models.PredictionResult{
+		ID:          "pred_" + string(imageData),
+		Predictions: []models.ClassificationResult{p.labels[string(imageData)]},
+		ModelInfo:   models.ModelInfo{ID: modelID},
+		Metadata:    *metadata,
+	}, nil
+}
+
+func (p *labelPredictor) GetResult(resultID string) (*models.PredictionResult, error) {
+	return nil, nil
+}
+
+func (p *labelPredictor) SubmitFeedback(ctx context.Context, resultID string, request models.FeedbackRequest) (*models.PredictionResult, error) {
+	return nil, nil
+}
+
+func (p *labelPredictor) ListModels() []models.ModelInfo {
+	return nil
+}
+
+func TestBackfillServiceComparesWithHistory(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	// Without a model directory the model service provides the "dummy" model
+	modelService := NewModelService(&config.Config{Model: config.ModelConfig{Path: filepath.Join(t.TempDir(), "none")}}, logger)
+
+	start := time.Now().Add(-time.Hour)
+	archive := func(id, image, modelID, class string, confidence float64, age time.Duration) {
+		key := ContentKey("originals", []byte(image), ".png")
+		if err := store.Put(ctx, key, []byte(image), "image/png"); err != nil {
+			t.Fatalf("Failed to store image: %v", err)
+		}
+		data, _ := json.Marshal(&models.PredictionResult{
+			ID:          id,
+			Predictions: []models.ClassificationResult{{ClassName: class, Confidence: confidence}},
+			ModelInfo:   models.ModelInfo{ID: modelID},
+			Metadata:    models.ImageMetadata{Filename: image + ".png", ImageKey: key},
+			ProcessedAt: start.Add(age),
+		})
+		if err := store.Put(ctx, ResultKey(id), data, "application/json"); err != nil {
+			t.Fatalf("Failed to archive result: %v", err)
+		}
+	}
+	archive("pred_a1", "a", "old", "cat", 0.9, 0)
+	archive("pred_a2", "a", "old", "dog", 0.5, time.Minute) // later result of the same image
+	archive("pred_b1", "b", "old", "cat", 0.6, 2*time.Minute)
+	archive("pred_c1", "c", "dummy", "cat", 0.7, 3*time.Minute) // already from the target model
+
+	predictor := &labelPredictor{labels: map[string]models.ClassificationResult{
+		"a": {ClassName: "cat", Confidence: 0.8},
+		"b": {ClassName: "lynx", Confidence: 0.7},
+	}}
+	jobs := newTestJobService(t, filepath.Join(t.TempDir(), "jobs.json"), predictor)
+	defer jobs.Shutdown(ctx)
+
+	service := NewBackfillService(jobs, modelService, store, logger)
+	service.pollInterval = time.Millisecond
+
+	if _, err := service.Run(ctx, models.BackfillRequest{ModelID: "missing"}); !errors.Is(err, ErrBackfillModelNotFound) {
+		t.Errorf("Expected ErrBackfillModelNotFound, got: %v", err)
+	}
+	if _, err := service.Run(ctx, models.BackfillRequest{ModelID: "dummy", Limit: -1}); !errors.Is(err, ErrInvalidBackfill) {
+		t.Errorf("Expected ErrInvalidBackfill, got: %v", err)
+	}
+
+	run, err := service.Run(ctx, models.BackfillRequest{ModelID: "dummy"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if run.Status != models.StatusCompleted || run.Total != 2 || run.Processed != 2 {
+		t.Fatalf("Expected completed run over 2 images, got %+v", run)
+	}
+
+	summary := run.Summary
+	if summary.Compared != 2 || summary.Failed != 0 || summary.LabelChanges != 1 {
+		t.Errorf("Expected 2 compared with 1 label change, got %+v", summary)
+	}
+	if len(summary.Classes) != 1 || summary.Classes[0].Class != "cat" || summary.Classes[0].ChangedTo["lynx"] != 1 {
+		t.Errorf("Expected cat images with one changed to lynx, got %+v", summary.Classes)
+	}
+
+	first := summary.Items[0]
+	if first.SourceResultID != "pred_a1" || first.ResultID != "pred_a" || first.NewClass != "cat" {
+		t.Errorf("Expected earliest result of image a to be compared, got %+v", first)
+	}
+	if first.ImageKey != ContentKey("originals", []byte("a"), ".png") {
+		t.Errorf("Expected new result to link the stored image, got %s", first.ImageKey)
+	}
+	if source := predictor.sources["a"]; source != "pred_a1" {
+		t.Errorf("Expected new result to record its source result, got %q", source)
+	}
+
+	// The old class has no confidence in the new result, which counts as 0
+	second := summary.Items[1]
+	if second.NewConfidence != 0 || second.OldConfidence != 0.6 {
+		t.Errorf("Expected old class confidence dropped to 0, got %+v", second)
+	}
+}
+
+// countingStore counts the blobs read from a store
+type countingStore struct {
+	BlobStore
+	mu    sync.Mutex
+	reads int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	s.reads++
+	s.mu.Unlock()
+	return s.BlobStore.Get(ctx, key)
+}
+
+func TestBackfillHistoryLoadsOnlyNeededResults(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	store := &countingStore{BlobStore: local}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	service := NewBackfillService(nil, nil, store, logger)
+
+	start := time.Now().Add(-time.Hour)
+	var ids []string
+	for i := 0; i < 10; i++ {
+		created := start.Add(time.Duration(i) * time.Minute)
+		id := fmt.Sprintf("pred_%d", created.UnixNano())
+		ids = append(ids, id)
+		data, _ := json.Marshal(&models.PredictionResult{
+			ID:          id,
+			Predictions: []models.ClassificationResult{{ClassName: "cat", Confidence: 0.9}},
+			ModelInfo:   models.ModelInfo{ID: "old"},
+			Metadata:    models.ImageMetadata{ImageKey: fmt.Sprintf("originals/%d.png", i)},
+			ProcessedAt: created.Add(time.Millisecond),
+		})
+		if err := local.Put(ctx, ResultKey(id), data, "application/json"); err != nil {
+			t.Fatalf("Failed to archive result: %v", err)
+		}
+	}
+
+	sources, err := service.history(ctx, models.BackfillRequest{ModelID: "new", Since: start.Add(4 * time.Minute), Limit: 3})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(sources) != 3 || sources[0].ID != ids[4] || sources[2].ID != ids[6] {
+		t.Errorf("Expected the 3 results from the 5th on, got %d", len(sources))
+	}
+	if store.reads != 3 {
+		t.Errorf("Expected only the 3 needed results to be loaded, got %d reads", store.reads)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchScheduler collects concurrent single-image requests for the same
+// model and runs them through the engine as one batch. A batch is flushed
+// when it reaches the maximum size or when the collection window expires.
+type BatchScheduler struct {
+	processor *ImageProcessor
+	engine    *MockTensorFlowService
+	logger    *logrus.Logger
+	config    *config.Config
+
+	mu      sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+// pendingBatch is a batch still collecting requests for one model
+type pendingBatch struct {
+	requests []*batchRequest
+	maxBatch int
+	timer    *time.Timer
+}
+
+// batchRequest is a single caller waiting for its slice of a batch
+type batchRequest struct {
+	ctx      context.Context
+	img      image.Image
+	enqueued time.Time
+	done     chan batchResponse
+}
+
+// batchResponse carries one caller's raw model output
+type batchResponse struct {
+	output []float32
+	err    error
+}
+
+// NewBatchScheduler creates a batch scheduler in front of the given engine
+func NewBatchScheduler(cfg *config.Config, engine *MockTensorFlowService, logger *logrus.Logger) *BatchScheduler {
+	return &BatchScheduler{
+		processor: NewImageProcessor(),
+		engine:    engine,
+		logger:    logger,
+		config:    cfg,
+		pending:   make(map[string]*pendingBatch),
+	}
+}
+
+// Submit queues an image for the next batch of modelID and waits for its
+// raw predictions. The caller stops waiting when ctx is done; the rest of
+// the batch is unaffected.
+func (s *BatchScheduler) Submit(ctx context.Context, modelID string, img image.Image) ([]float32, error) {
+	req := &batchRequest{
+		ctx:      ctx,
+		img:      img,
+		enqueued: time.Now(),
+		done:     make(chan batchResponse, 1),
+	}
+
+	s.mu.Lock()
+	batch, exists := s.pending[modelID]
+	if !exists {
+		settings := s.config.ForModel(modelID)
+		batch = &pendingBatch{maxBatch: max(settings.MaxBatchSize, 1)}
+		s.pending[modelID] = batch
+		window := time.Duration(settings.BatchWindow) * time.Millisecond
+		if batch.maxBatch > 1 && window > 0 {
+			batch.timer = time.AfterFunc(window, func() { s.flush(modelID, batch) })
+		}
+	}
+	batch.requests = append(batch.requests, req)
+
+	full := len(batch.requests) >= batch.maxBatch || batch.timer == nil
+	if full {
+		delete(s.pending, modelID)
+		if batch.timer != nil {
+			batch.timer.Stop()
+		}
+	}
+	s.mu.Unlock()
+
+	if full {
+		go s.run(modelID, batch.requests)
+	}
+
+	select {
+	case resp := <-req.done:
+		return resp.output, resp.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush runs a batch whose collection window expired, unless it was
+// already sent because it filled up
+func (s *BatchScheduler) flush(modelID string, batch *pendingBatch) {
+	s.mu.Lock()
+	if s.pending[modelID] != batch {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, modelID)
+	s.mu.Unlock()
+
+	s.run(modelID, batch.requests)
+}
+
+// run preprocesses and infers a batch, then fans the results back out
+func (s *BatchScheduler) run(modelID string, requests []*batchRequest) {
+	// Skip callers that gave up while the batch was collecting
+	live := requests[:0:0]
+	for _, req := range requests {
+		if err := req.ctx.Err(); err != nil {
+			req.done <- batchResponse{err: err}
+			continue
+		}
+		live = append(live, req)
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	ctx, cancel := s.batchContext(live)
+	defer cancel()
+
+	links := make([]trace.Link, 0, len(live))
+	for _, req := range live {
+		links = append(links, trace.Link{SpanContext: trace.SpanContextFromContext(req.ctx)})
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "BatchScheduler.RunBatch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("model.id", modelID),
+			attribute.Int("batch.size", len(live)),
+		),
+	)
+	defer span.End()
+
+	metrics.ObserveBatch(modelID, len(live), time.Since(live[0].enqueued))
+
+	outputs, err := s.predictBatch(ctx, modelID, live)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logging.FromContext(ctx, s.logger).WithField("batch_size", len(live)).
+			Warnf("Batch inference failed for model %s: %v", modelID, err)
+	}
+
+	for i, req := range live {
+		if err != nil {
+			req.done <- batchResponse{err: err}
+			continue
+		}
+		req.done <- batchResponse{output: outputs[i]}
+	}
+}
+
+// predictBatch stacks the batch into one tensor and runs the engine
+func (s *BatchScheduler) predictBatch(ctx context.Context, modelID string, requests []*batchRequest) ([][]float32, error) {
+	images := make([]image.Image, len(requests))
+	for i, req := range requests {
+		images[i] = req.img
+	}
+
+	tensors, err := s.processor.ProcessImageForBatch(ctx, images)
+	if err != nil {
+		return nil, fmt.Errorf("image preprocessing failed: %w", err)
+	}
+
+	batch := make([][]float32, len(tensors))
+	for i, tensor := range tensors {
+		batch[i] = tensor[0]
+	}
+
+	inferenceStart := time.Now()
+	outputs, err := s.engine.PredictBatch(ctx, modelID, batch)
+	metrics.ObserveInference(modelID, metrics.EngineTensorFlow, time.Since(inferenceStart))
+	if err != nil {
+		return nil, fmt.Errorf("TensorFlow prediction failed: %w", err)
+	}
+	if len(outputs) != len(requests) {
+		return nil, fmt.Errorf("engine returned %d outputs for a batch of %d", len(outputs), len(requests))
+	}
+
+	return outputs, nil
+}
+
+// batchContext derives the context a batch runs under. It keeps the first
+// caller's trace and request ID and lives until the latest caller deadline,
+// so one caller timing out does not fail the rest of the batch.
+func (s *BatchScheduler) batchContext(requests []*batchRequest) (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(requests[0].ctx)
+
+	var latest time.Time
+	for _, req := range requests {
+		deadline, ok := req.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(ctx)
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+
+	return context.WithDeadline(ctx, latest)
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestBatchScheduler(t *testing.T, maxBatch, windowMs int) *BatchScheduler {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			MaxBatchSize: maxBatch,
+			BatchWindow:  windowMs,
+		},
+	}
+
+	engine := NewTensorFlowService(cfg, logrus.New())
+	if err := engine.LoadModel("./testdata/models", "test_model"); err != nil {
+		t.Fatalf("Failed to load mock model: %v", err)
+	}
+
+	return NewBatchScheduler(cfg, engine, logrus.New())
+}
+
+func TestBatchSchedulerFlushesFullBatch(t *testing.T) {
+	// A long window means the batch can only complete by filling up
+	scheduler := newTestBatchScheduler(t, 3, 10000)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := scheduler.Submit(context.Background(), "test_model", image.NewRGBA(image.Rect(0, 0, 32, 32)))
+			if err == nil && len(output) == 0 {
+				err = errors.New("empty output")
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected batched prediction to succeed, got: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected full batch to flush immediately, took %v", elapsed)
+	}
+}
+
+func TestBatchSchedulerFlushesAfterWindow(t *testing.T) {
+	scheduler := newTestBatchScheduler(t, 8, 20)
+
+	output, err := scheduler.Submit(context.Background(), "test_model", image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	if err != nil {
+		t.Fatalf("Expected prediction after window to succeed, got: %v", err)
+	}
+
+	if len(output) == 0 {
+		t.Error("Expected predictions to be returned")
+	}
+}
+
+func TestBatchSchedulerCallerCancellation(t *testing.T) {
+	scheduler := newTestBatchScheduler(t, 8, 10000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := scheduler.Submit(ctx, "test_model", image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected caller deadline to end the wait, got: %v", err)
+	}
+}
+
+func TestBatchSchedulerUnknownModel(t *testing.T) {
+	scheduler := newTestBatchScheduler(t, 1, 0)
+
+	_, err := scheduler.Submit(context.Background(), "missing", image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	if err == nil {
+		t.Error("Expected error for unknown model")
+	}
+}
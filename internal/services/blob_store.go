@@ -0,0 +1,488 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// BlobStore keeps binary objects under string keys. Keys are
+// slash-separated paths such as "originals/<sha256>.png".
+type BlobStore interface {
+	// Put stores data under key, replacing any existing blob
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Get returns the blob stored under key or ErrBlobNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Exists reports whether a blob is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// Delete removes the blob stored under key. Deleting a missing key is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Backend names the implementation for logs and metrics
+	Backend() string
+}
+
+// NewBlobStore creates the blob store selected by the configuration. It
+// returns nil when uploads are not kept.
+func NewBlobStore(cfg *config.Config) (BlobStore, error) {
+	switch cfg.Blob.Backend {
+	case config.BlobBackendLocal:
+		return NewLocalBlobStore(cfg.Blob.Dir)
+	case config.BlobBackendS3:
+		return NewS3BlobStore(cfg.Blob)
+	case config.BlobBackendNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend: %s", cfg.Blob.Backend)
+	}
+}
+
+// ContentKey returns the content-addressed key for data: the prefix, the
+// SHA-256 of data and ext. Identical uploads share one key.
+func ContentKey(prefix string, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return prefix + "/" + hex.EncodeToString(sum[:]) + ext
+}
+
+// resultsPrefix is where prediction results of stored images are archived
+const resultsPrefix = "results/"
+
+// ResultKey returns the key under which a prediction result is archived
+func ResultKey(resultID string) string {
+	return resultsPrefix + resultID + ".json"
+}
+
+// loadResult reads an archived prediction result
+func loadResult(ctx context.Context, store BlobStore, key string) (*models.PredictionResult, error) {
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var result models.PredictionResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode result %s: %w", key, err)
+	}
+	return &result, nil
+}
+
+// validBlobKey rejects keys that could escape the store's namespace
+func validBlobKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+// LocalBlobStore keeps blobs as files below a root directory
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore creates a blob store rooted at dir
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &LocalBlobStore{root: dir}, nil
+}
+
+// Backend returns "local"
+func (s *LocalBlobStore) Backend() string {
+	return config.BlobBackendLocal
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if err := validBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place so
+// readers never see a partial blob
+func (s *LocalBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// Get reads a blob from disk
+func (s *LocalBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+// Exists reports whether the blob file exists
+func (s *LocalBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat blob: %w", err)
+	}
+	return true, nil
+}
+
+// Delete removes the blob file
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// List walks the directory tree below the deepest directory in prefix
+func (s *LocalBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	start := filepath.Join(s.root, filepath.FromSlash(prefix[:strings.LastIndex(prefix, "/")+1]))
+	if _, err := os.Stat(start); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var keys []string
+	err := filepath.WalkDir(start, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// s3ReadyTimeout bounds the readiness probe of the bucket, well below the
+// client timeout used for uploads
+const s3ReadyTimeout = 2 * time.Second
+
+// S3BlobStore keeps blobs in a bucket of an S3-compatible service such as
+// AWS S3 or MinIO. Requests use path-style addressing and are signed with
+// AWS Signature Version 4.
+type S3BlobStore struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3BlobStore creates a blob store for the configured bucket
+func NewS3BlobStore(cfg config.BlobConfig) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.S3Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.S3Endpoint)
+	}
+	return &S3BlobStore{
+		endpoint:  endpoint,
+		bucket:    cfg.S3Bucket,
+		region:    cfg.S3Region,
+		accessKey: cfg.S3AccessKey,
+		secretKey: cfg.S3SecretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		now:       time.Now,
+	}, nil
+}
+
+// Backend returns "s3"
+func (s *S3BlobStore) Backend() string {
+	return config.BlobBackendS3
+}
+
+// Put uploads the blob with PutObject
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError("put", key, resp)
+	}
+	return nil
+}
+
+// Get downloads the blob with GetObject
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob: %w", err)
+		}
+		return data, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, key)
+	default:
+		return nil, s.responseError("get", key, resp)
+	}
+}
+
+// Exists checks for the blob with HeadObject
+func (s *S3BlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, "")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s.responseError("head", key, resp)
+	}
+}
+
+// Delete removes the blob with DeleteObject
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusNotFound {
+		return s.responseError("delete", key, resp)
+	}
+	return nil
+}
+
+// List pages through ListObjectsV2
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+
+	for {
+		resp, err := s.send(ctx, http.MethodGet, "/"+s.bucket, query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s.responseError("list", prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode S3 listing: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// CheckReady verifies the bucket is reachable with the configured
+// credentials with a HeadBucket request
+func (s *S3BlobStore) CheckReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s3ReadyTimeout)
+	defer cancel()
+
+	resp, err := s.send(ctx, http.MethodHead, "/"+s.bucket, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError("head bucket", s.bucket, resp)
+	}
+	return nil
+}
+
+// do sends a signed request for key
+func (s *S3BlobStore) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, err
+	}
+	return s.send(ctx, method, "/"+s.bucket+"/"+key, nil, body, contentType)
+}
+
+// send sends a signed request for a path below the endpoint
+func (s *S3BlobStore) send(ctx context.Context, method, path string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path += path
+	// Encode spaces as %20, as the signature's canonical query requires
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s %s failed: %w", method, path, err)
+	}
+	return resp, nil
+}
+
+// responseError describes an unexpected S3 response
+func (s *S3BlobStore) responseError(op, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 %s %s: unexpected status %d: %s", op, key, resp.StatusCode, strings.TrimSpace(string(detail)))
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *S3BlobStore) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeS3 is an in-memory stand-in for an S3-compatible service that checks
+// requests are signed and their payload hash matches the body
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	fake := &fakeS3{t: t, objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-key/") || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "missing signature", http.StatusForbidden)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r.URL.Path, r.URL.Query().Get("prefix"))
+		return
+	}
+
+	// HeadBucket for the only bucket there is
+	if r.Method == http.MethodHead && strings.Count(r.URL.Path, "/") == 1 {
+		if r.URL.Path != "/uploads" {
+			http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		}
+		return
+	}
+
+	data, ok := f.objects[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list answers a ListObjectsV2 request for the bucket at path
+func (f *fakeS3) list(w http.ResponseWriter, path, prefix string) {
+	var result struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+	}
+	for objectPath := range f.objects {
+		key, ok := strings.CutPrefix(objectPath, path+"/")
+		if ok && strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{key})
+		}
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *S3BlobStore {
+	t.Helper()
+	store, err := NewS3BlobStore(config.BlobConfig{
+		S3Endpoint:  endpoint,
+		S3Bucket:    "uploads",
+		S3Region:    "us-east-1",
+		S3AccessKey: "test-key",
+		S3SecretKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create S3 store: %v", err)
+	}
+	return store
+}
+
+func TestBlobStoreRoundTrip(t *testing.T) {
+	local, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	_, server := newFakeS3(t)
+
+	for _, store := range []BlobStore{local, newTestS3Store(t, server.URL)} {
+		t.Run(store.Backend(), func(t *testing.T) {
+			ctx := context.Background()
+			key := "originals/abc.png"
+
+			if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("Expected ErrBlobNotFound, got: %v", err)
+			}
+
+			if err := store.Put(ctx, key, []byte("image"), "image/png"); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if ok, err := store.Exists(ctx, key); err != nil || !ok {
+				t.Errorf("Expected blob to exist, got %v (err %v)", ok, err)
+			}
+			if err := store.Put(ctx, "thumbnails/abc_256.jpg", []byte("thumb"), "image/jpeg"); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			keys, err := store.List(ctx, "originals/")
+			if err != nil || len(keys) != 1 || keys[0] != key {
+				t.Errorf("Expected only %s listed, got %v (err %v)", key, keys, err)
+			}
+			data, err := store.Get(ctx, key)
+			if err != nil || string(data) != "image" {
+				t.Errorf("Expected stored data, got %q (err %v)", data, err)
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if ok, _ := store.Exists(ctx, key); ok {
+				t.Error("Expected blob to be deleted")
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Errorf("Expected deleting a missing blob to succeed, got: %v", err)
+			}
+
+			if err := store.Put(ctx, "../escape", []byte("x"), ""); err == nil {
+				t.Error("Expected error for key outside the store")
+			}
+		})
+	}
+}
+
+func TestS3BlobStoreRejectsUnsignedCredentials(t *testing.T) {
+	_, server := newFakeS3(t)
+	store := newTestS3Store(t, server.URL)
+	store.accessKey = "other-key"
+
+	if err := store.Put(context.Background(), "originals/abc.png", []byte("image"), "image/png"); err == nil {
+		t.Error("Expected error when the service rejects the request")
+	}
+}
+
+func TestS3BlobStoreCheckReady(t *testing.T) {
+	_, server := newFakeS3(t)
+	ctx := context.Background()
+
+	store := newTestS3Store(t, server.URL)
+	if err := store.CheckReady(ctx); err != nil {
+		t.Errorf("Expected reachable bucket to be ready, got: %v", err)
+	}
+
+	store.bucket = "missing"
+	if err := store.CheckReady(ctx); err == nil {
+		t.Error("Expected missing bucket to fail readiness")
+	}
+
+	store = newTestS3Store(t, server.URL)
+	store.accessKey = "other-key"
+	if err := store.CheckReady(ctx); err == nil {
+		t.Error("Expected rejected credentials to fail readiness")
+	}
+
+	server.Close()
+	if err := newTestS3Store(t, server.URL).CheckReady(ctx); err == nil {
+		t.Error("Expected unreachable service to fail readiness")
+	}
+}
+
+func TestImageServiceStoresOriginalAndThumbnail(t *testing.T) {
+	fake, server := newFakeS3(t)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	service := NewImageService(&config.Config{Blob: config.BlobConfig{ThumbnailSize: 32}}, logger)
+	service.SetBlobStore(newTestS3Store(t, server.URL))
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	img.Set(10, 10, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+
+	metadata := &models.ImageMetadata{Filename: "test.png"}
+	if err := service.StoreImage(context.Background(), buf.Bytes(), metadata); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if metadata.ImageKey != ContentKey("originals", buf.Bytes(), ".png") {
+		t.Errorf("Expected content-addressed image key, got %s", metadata.ImageKey)
+	}
+	if !strings.HasPrefix(metadata.ThumbnailKey, "thumbnails/") {
+		t.Errorf("Expected thumbnail key, got %s", metadata.ThumbnailKey)
+	}
+	if metadata.Width != 100 || metadata.Height != 50 || metadata.Format != "png" {
+		t.Errorf("Expected dimensions filled in, got %dx%d %s", metadata.Width, metadata.Height, metadata.Format)
+	}
+
+	thumbnail, ok := fake.objects["/uploads/"+metadata.ThumbnailKey]
+	if !ok {
+		t.Fatal("Expected thumbnail to be stored")
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("Failed to decode thumbnail: %v", err)
+	}
+	if decoded.Bounds().Dx() > 32 || decoded.Bounds().Dy() > 32 {
+		t.Errorf("Expected thumbnail within 32px, got %v", decoded.Bounds())
+	}
+
+	// Storing the same content again reuses the existing blobs
+	again := &models.ImageMetadata{Filename: "copy.png"}
+	if err := service.StoreImage(context.Background(), buf.Bytes(), again); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if again.ImageKey != metadata.ImageKey || len(fake.objects) != 2 {
+		t.Errorf("Expected identical uploads to share blobs, got %d objects", len(fake.objects))
+	}
+}
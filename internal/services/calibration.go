@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+const (
+	// calibrationEpsilon keeps probabilities away from 0 and 1 before
+	// taking logs
+	calibrationEpsilon = 1e-7
+	// calibrationBins is the number of confidence bins used for the
+	// expected calibration error
+	calibrationBins = 10
+)
+
+// CalibrationSample is one labeled validation image: the model's raw
+// probabilities for every class and the index of the true class
+type CalibrationSample struct {
+	Probabilities []float64
+	Label         int
+}
+
+// validateCalibration checks calibration parameters loaded from metadata
+func validateCalibration(c *models.Calibration) error {
+	switch c.Method {
+	case models.CalibrationTemperature:
+		if c.Temperature <= 0 {
+			return fmt.Errorf("temperature must be positive, got %g", c.Temperature)
+		}
+	case models.CalibrationPlatt:
+		if len(c.Platt) == 0 {
+			return errors.New("platt calibration has no classes")
+		}
+	default:
+		return fmt.Errorf("unknown calibration method: %q", c.Method)
+	}
+	return nil
+}
+
+// calibrate applies c to the raw probabilities of classes. Temperature
+// scaling softmax(z/T) equals p^(1/T) renormalized, so it works on
+// probabilities as well as on logits. Classes without Platt parameters keep
+// their raw probability.
+func calibrate(c *models.Calibration, classes []string, probs []float64) []float64 {
+	if c == nil {
+		return append([]float64(nil), probs...)
+	}
+
+	switch c.Method {
+	case models.CalibrationTemperature:
+		return temperatureScale(probs, c.Temperature)
+	case models.CalibrationPlatt:
+		calibrated := make([]float64, len(probs))
+		for i, p := range probs {
+			params, ok := c.Platt[classes[i]]
+			if !ok {
+				calibrated[i] = p
+				continue
+			}
+			calibrated[i] = sigmoid(params.A*logit(p) + params.B)
+		}
+		return calibrated
+	default:
+		return append([]float64(nil), probs...)
+	}
+}
+
+// temperatureScale sharpens (T < 1) or softens (T > 1) a distribution
+func temperatureScale(probs []float64, temperature float64) []float64 {
+	scaled := make([]float64, len(probs))
+	maxLog := math.Inf(-1)
+	for i, p := range probs {
+		scaled[i] = math.Log(clampProbability(p)) / temperature
+		maxLog = max(maxLog, scaled[i])
+	}
+
+	var sum float64
+	for i := range scaled {
+		scaled[i] = math.Exp(scaled[i] - maxLog)
+		sum += scaled[i]
+	}
+	for i := range scaled {
+		scaled[i] /= sum
+	}
+	return scaled
+}
+
+// FitCalibration fits calibration parameters of method to labeled samples.
+// Temperature scaling minimizes the negative log likelihood of the true
+// classes; Platt scaling fits a sigmoid per class that has at least one
+// sample.
+func FitCalibration(method string, classes []string, samples []CalibrationSample) (*models.Calibration, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no calibration samples")
+	}
+	for _, sample := range samples {
+		if len(sample.Probabilities) != len(classes) || sample.Label < 0 || sample.Label >= len(classes) {
+			return nil, fmt.Errorf("sample has %d probabilities and label %d for %d classes",
+				len(sample.Probabilities), sample.Label, len(classes))
+		}
+	}
+
+	now := time.Now().UTC()
+	calibration := &models.Calibration{Method: method, Samples: len(samples), FittedAt: &now}
+
+	switch method {
+	case models.CalibrationTemperature:
+		calibration.Temperature = fitTemperature(samples)
+	case models.CalibrationPlatt:
+		calibration.Platt = make(map[string]models.PlattParams)
+		scores := make([]float64, len(samples))
+		labels := make([]bool, len(samples))
+		for class, name := range classes {
+			positives := 0
+			for i, sample := range samples {
+				scores[i] = logit(sample.Probabilities[class])
+				labels[i] = sample.Label == class
+				if labels[i] {
+					positives++
+				}
+			}
+			if positives == 0 {
+				continue
+			}
+			calibration.Platt[name] = fitPlatt(scores, labels)
+		}
+	default:
+		return nil, fmt.Errorf("unknown calibration method: %q", method)
+	}
+
+	return calibration, nil
+}
+
+// fitTemperature finds the temperature minimizing the mean negative log
+// likelihood with a golden-section search over log T
+func fitTemperature(samples []CalibrationSample) float64 {
+	nll := func(logT float64) float64 {
+		temperature := math.Exp(logT)
+		var total float64
+		for _, sample := range samples {
+			scaled := temperatureScale(sample.Probabilities, temperature)
+			total -= math.Log(clampProbability(scaled[sample.Label]))
+		}
+		return total / float64(len(samples))
+	}
+
+	ratio := (math.Sqrt(5) - 1) / 2
+	lo, hi := math.Log(0.05), math.Log(20)
+	x1, x2 := hi-ratio*(hi-lo), lo+ratio*(hi-lo)
+	f1, f2 := nll(x1), nll(x2)
+	for hi-lo > 1e-4 {
+		if f1 < f2 {
+			hi, x2, f2 = x2, x1, f1
+			x1 = hi - ratio*(hi-lo)
+			f1 = nll(x1)
+		} else {
+			lo, x1, f1 = x1, x2, f2
+			x2 = lo + ratio*(hi-lo)
+			f2 = nll(x2)
+		}
+	}
+	return math.Exp((lo + hi) / 2)
+}
+
+// fitPlatt fits sigmoid(A*score + B) to labels with Newton's method and
+// Platt's smoothed targets, which keep the fit finite on separable data
+func fitPlatt(scores []float64, labels []bool) models.PlattParams {
+	var positives, negatives float64
+	for _, label := range labels {
+		if label {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	targets := make([]float64, len(labels))
+	for i, label := range labels {
+		if label {
+			targets[i] = (positives + 1) / (positives + 2)
+		} else {
+			targets[i] = 1 / (negatives + 2)
+		}
+	}
+
+	loss := func(a, b float64) float64 {
+		var total float64
+		for i, score := range scores {
+			f := a*score + b
+			total += targets[i]*softplus(-f) + (1-targets[i])*softplus(f)
+		}
+		return total
+	}
+
+	// Start from the identity mapping, sigmoid(logit(p)) = p
+	a, b := 1.0, 0.0
+	current := loss(a, b)
+	for iteration := 0; iteration < 100; iteration++ {
+		var gradA, gradB float64
+		hessAA, hessBB, hessAB := 1e-12, 1e-12, 0.0
+		for i, score := range scores {
+			q := sigmoid(a*score + b)
+			d1 := q - targets[i]
+			d2 := q * (1 - q)
+			gradA += score * d1
+			gradB += d1
+			hessAA += score * score * d2
+			hessBB += d2
+			hessAB += score * d2
+		}
+		if math.Abs(gradA) < 1e-6 && math.Abs(gradB) < 1e-6 {
+			break
+		}
+
+		det := hessAA*hessBB - hessAB*hessAB
+		stepA := -(hessBB*gradA - hessAB*gradB) / det
+		stepB := -(hessAA*gradB - hessAB*gradA) / det
+		descent := gradA*stepA + gradB*stepB
+
+		// Backtrack until the step decreases the loss enough
+		step := 1.0
+		for ; step >= 1e-10; step /= 2 {
+			nextA, nextB := a+step*stepA, b+step*stepB
+			if next := loss(nextA, nextB); next < current+1e-4*step*descent {
+				a, b, current = nextA, nextB, next
+				break
+			}
+		}
+		if step < 1e-10 {
+			break
+		}
+	}
+
+	return models.PlattParams{A: a, B: b}
+}
+
+// ExpectedCalibrationError measures how far the top-1 confidence after
+// applying c is from the top-1 accuracy, averaged over confidence bins and
+// weighted by the samples in each bin
+func ExpectedCalibrationError(c *models.Calibration, classes []string, samples []CalibrationSample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	var counts, confidences, correct [calibrationBins]float64
+	for _, sample := range samples {
+		probs := calibrate(c, classes, sample.Probabilities)
+		top := 0
+		for i, p := range probs {
+			if p > probs[top] {
+				top = i
+			}
+		}
+
+		bin := min(int(probs[top]*calibrationBins), calibrationBins-1)
+		counts[bin]++
+		confidences[bin] += probs[top]
+		if top == sample.Label {
+			correct[bin]++
+		}
+	}
+
+	var ece float64
+	for bin := range counts {
+		if counts[bin] > 0 {
+			ece += math.Abs(confidences[bin]-correct[bin]) / float64(len(samples))
+		}
+	}
+	return ece
+}
+
+func clampProbability(p float64) float64 {
+	return min(max(p, calibrationEpsilon), 1-calibrationEpsilon)
+}
+
+func logit(p float64) float64 {
+	p = clampProbability(p)
+	return math.Log(p / (1 - p))
+}
+
+func sigmoid(x float64) float64 {
+	if x >= 0 {
+		return 1 / (1 + math.Exp(-x))
+	}
+	e := math.Exp(x)
+	return e / (1 + e)
+}
+
+// softplus computes log(1 + e^x) without overflowing
+func softplus(x float64) float64 {
+	return max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// overconfidentSamples draws labels from softmax(z) while reporting
+// softmax(z*sharpness), as an overconfident model would
+func overconfidentSamples(n int, sharpness float64) []CalibrationSample {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]CalibrationSample, n)
+	for i := range samples {
+		logits := []float32{float32(rng.NormFloat64()), float32(rng.NormFloat64()), float32(rng.NormFloat64())}
+		truth := applySoftmax(logits)
+
+		label, draw := len(truth)-1, rng.Float32()
+		for class, p := range truth {
+			if draw < p {
+				label = class
+				break
+			}
+			draw -= p
+		}
+
+		sharpened := make([]float32, len(logits))
+		for class, logit := range logits {
+			sharpened[class] = logit * float32(sharpness)
+		}
+		probs := make([]float64, len(logits))
+		for class, p := range applySoftmax(sharpened) {
+			probs[class] = float64(p)
+		}
+		samples[i] = CalibrationSample{Probabilities: probs, Label: label}
+	}
+	return samples
+}
+
+func TestFitCalibration(t *testing.T) {
+	classes := []string{"cat", "dog", "bird"}
+	samples := overconfidentSamples(3000, 2)
+	raw := ExpectedCalibrationError(nil, classes, samples)
+
+	temperature, err := FitCalibration(models.CalibrationTemperature, classes, samples)
+	if err != nil {
+		t.Fatalf("Failed to fit temperature: %v", err)
+	}
+	if temperature.Temperature < 1.7 || temperature.Temperature > 2.3 {
+		t.Errorf("Expected a temperature near 2, got %.3f", temperature.Temperature)
+	}
+	if ece := ExpectedCalibrationError(temperature, classes, samples); ece >= raw/2 {
+		t.Errorf("Expected temperature scaling to reduce the calibration error from %.4f, got %.4f", raw, ece)
+	}
+
+	platt, err := FitCalibration(models.CalibrationPlatt, classes, samples)
+	if err != nil {
+		t.Fatalf("Failed to fit Platt scaling: %v", err)
+	}
+	if len(platt.Platt) != len(classes) {
+		t.Fatalf("Expected parameters for every class, got %+v", platt.Platt)
+	}
+	for class, params := range platt.Platt {
+		// Undoing a sharpness of 2 roughly halves the logit
+		if params.A < 0.3 || params.A > 0.8 {
+			t.Errorf("Expected class %s slope near 0.5, got %+v", class, params)
+		}
+	}
+
+	if _, err := FitCalibration("isotonic", classes, samples); err == nil {
+		t.Error("Expected an unknown method to fail")
+	}
+	if _, err := FitCalibration(models.CalibrationTemperature, classes, nil); err == nil {
+		t.Error("Expected fitting without samples to fail")
+	}
+}
+
+func TestPostprocessPredictionsCalibrated(t *testing.T) {
+	processor := NewImageProcessor()
+	logits := []float32{1.0, 2.0, 3.0}
+	classNames := []string{"cat", "dog", "bird"}
+	calibration := &models.Calibration{Method: models.CalibrationTemperature, Temperature: 2}
+
+	results, err := processor.PostprocessPredictions(context.Background(), logits, classNames, 3, calibration)
+	if err != nil {
+		t.Fatalf("Failed to postprocess predictions: %v", err)
+	}
+
+	raw := applySoftmax(logits)
+	softened := applySoftmax([]float32{0.5, 1.0, 1.5})
+	for _, result := range results {
+		if math.Abs(float64(result.RawConfidence-raw[result.ClassIndex])) > 1e-5 {
+			t.Errorf("Expected raw confidence %.4f for %s, got %.4f", raw[result.ClassIndex], result.ClassName, result.RawConfidence)
+		}
+		if math.Abs(float64(result.Confidence-softened[result.ClassIndex])) > 1e-5 {
+			t.Errorf("Expected calibrated confidence %.4f for %s, got %.4f", softened[result.ClassIndex], result.ClassName, result.Confidence)
+		}
+	}
+	if results[0].ClassName != "bird" || results[0].Confidence >= results[0].RawConfidence {
+		t.Errorf("Expected a softened top prediction for bird, got %+v", results[0])
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// ErrCircuitOpen is returned when a model's engine breaker is rejecting calls
+var ErrCircuitOpen = errors.New("engine circuit breaker is open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker tracks primary engine errors per model. A model's breaker
+// opens when the error rate over its recent calls crosses the threshold,
+// rejects calls until the open timeout passes, then lets a few probe calls
+// through (half-open) and closes again once they all succeed.
+type CircuitBreaker struct {
+	failureRate    float64
+	minRequests    int
+	window         int
+	openTimeout    time.Duration
+	halfOpenProbes int
+
+	mu     sync.Mutex
+	models map[string]*modelBreaker
+}
+
+// modelBreaker is the breaker state for a single model
+type modelBreaker struct {
+	state    string
+	outcomes []bool // ring buffer of recent results, true meaning failure
+	next     int
+	count    int
+	failures int
+	openedAt time.Time
+
+	// Half-open bookkeeping
+	probes    int
+	successes int
+}
+
+// NewCircuitBreaker creates a circuit breaker from the model configuration
+func NewCircuitBreaker(cfg *config.Config) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureRate:    cfg.Model.BreakerFailureRate,
+		minRequests:    cfg.Model.BreakerMinRequests,
+		window:         max(cfg.Model.BreakerWindow, 1),
+		openTimeout:    time.Duration(cfg.Model.BreakerOpenTimeout) * time.Millisecond,
+		halfOpenProbes: max(cfg.Model.BreakerHalfOpenProbes, 1),
+		models:         make(map[string]*modelBreaker),
+	}
+}
+
+// Allow reports whether a call to modelID's primary engine may proceed. On
+// success the returned done function must be called with the call's error
+// so the outcome is recorded.
+func (b *CircuitBreaker) Allow(modelID string) (func(error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	mb := b.modelBreaker(modelID)
+	switch mb.state {
+	case BreakerOpen:
+		if time.Since(mb.openedAt) < b.openTimeout {
+			return nil, ErrCircuitOpen
+		}
+		b.setState(modelID, mb, BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if mb.probes >= b.halfOpenProbes {
+			return nil, ErrCircuitOpen
+		}
+		mb.probes++
+	}
+
+	admitted := mb.state
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(modelID, admitted, err) })
+	}, nil
+}
+
+// record updates a model's breaker with the outcome of an engine call
+// admitted in the given state
+func (b *CircuitBreaker) record(modelID, admitted string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Outcomes of calls admitted before the last state change are stale
+	mb := b.modelBreaker(modelID)
+	if mb.state != admitted {
+		return
+	}
+
+	// A caller giving up says nothing about the engine's health
+	if errors.Is(err, context.Canceled) {
+		if mb.state == BreakerHalfOpen && mb.probes > 0 {
+			mb.probes--
+		}
+		return
+	}
+
+	failed := err != nil
+	switch mb.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.trip(modelID, mb)
+			return
+		}
+		mb.successes++
+		if mb.successes >= b.halfOpenProbes {
+			mb.reset(b.window)
+			b.setState(modelID, mb, BreakerClosed)
+		}
+	case BreakerClosed:
+		if mb.count == len(mb.outcomes) && mb.outcomes[mb.next] {
+			mb.failures--
+		}
+		mb.outcomes[mb.next] = failed
+		mb.next = (mb.next + 1) % len(mb.outcomes)
+		if mb.count < len(mb.outcomes) {
+			mb.count++
+		}
+		if failed {
+			mb.failures++
+		}
+
+		if mb.count >= b.minRequests && mb.rate() >= b.failureRate {
+			b.trip(modelID, mb)
+		}
+	}
+}
+
+// RetryAfter suggests how long a rejected client should wait before retrying
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	if b == nil || b.openTimeout < time.Second {
+		return time.Second
+	}
+	return b.openTimeout
+}
+
+// State returns the breaker state of a model
+func (b *CircuitBreaker) State(modelID string) string {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if mb, exists := b.models[modelID]; exists {
+		return mb.state
+	}
+	return BreakerClosed
+}
+
+// Status returns the breaker state of every model that has seen traffic
+func (b *CircuitBreaker) Status() map[string]models.BreakerStatus {
+	status := make(map[string]models.BreakerStatus)
+	if b == nil {
+		return status
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for modelID, mb := range b.models {
+		status[modelID] = models.BreakerStatus{
+			State:       mb.state,
+			Requests:    mb.count,
+			FailureRate: mb.rate(),
+		}
+	}
+
+	return status
+}
+
+// OpenModels returns the IDs of models whose breaker is not closed
+func (b *CircuitBreaker) OpenModels() []string {
+	var open []string
+	for modelID, breaker := range b.Status() {
+		if breaker.State != BreakerClosed {
+			open = append(open, modelID)
+		}
+	}
+	sort.Strings(open)
+	return open
+}
+
+// trip opens a model's breaker
+func (b *CircuitBreaker) trip(modelID string, mb *modelBreaker) {
+	mb.reset(b.window)
+	mb.openedAt = time.Now()
+	b.setState(modelID, mb, BreakerOpen)
+}
+
+// setState moves a model's breaker to a new state and exports it
+func (b *CircuitBreaker) setState(modelID string, mb *modelBreaker, state string) {
+	mb.state = state
+	mb.probes = 0
+	mb.successes = 0
+	metrics.SetBreakerState(modelID, state)
+}
+
+// modelBreaker returns the breaker for a model, creating it on first use.
+// The caller must hold b.mu.
+func (b *CircuitBreaker) modelBreaker(modelID string) *modelBreaker {
+	mb, exists := b.models[modelID]
+	if !exists {
+		mb = &modelBreaker{state: BreakerClosed}
+		mb.reset(b.window)
+		b.models[modelID] = mb
+		metrics.SetBreakerState(modelID, BreakerClosed)
+	}
+	return mb
+}
+
+// reset clears the recorded outcomes
+func (mb *modelBreaker) reset(window int) {
+	mb.outcomes = make([]bool, window)
+	mb.next = 0
+	mb.count = 0
+	mb.failures = 0
+}
+
+// rate returns the failure rate over the recorded outcomes
+func (mb *modelBreaker) rate() float64 {
+	if mb.count == 0 {
+		return 0
+	}
+	return float64(mb.failures) / float64(mb.count)
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+)
+
+func newTestCircuitBreaker(openTimeoutMs int) *CircuitBreaker {
+	return NewCircuitBreaker(&config.Config{
+		Model: config.ModelConfig{
+			BreakerFailureRate:    0.5,
+			BreakerMinRequests:    4,
+			BreakerWindow:         4,
+			BreakerOpenTimeout:    openTimeoutMs,
+			BreakerHalfOpenProbes: 2,
+		},
+	})
+}
+
+func callBreaker(t *testing.T, breaker *CircuitBreaker, err error) {
+	t.Helper()
+	done, allowErr := breaker.Allow("model")
+	if allowErr != nil {
+		t.Fatalf("Expected call to be allowed, got: %v", allowErr)
+	}
+	done(err)
+}
+
+func TestCircuitBreakerOpensOnErrorRate(t *testing.T) {
+	breaker := newTestCircuitBreaker(60000)
+	engineErr := errors.New("engine failure")
+
+	// Below the minimum request count the breaker stays closed
+	callBreaker(t, breaker, engineErr)
+	callBreaker(t, breaker, engineErr)
+	callBreaker(t, breaker, nil)
+	if state := breaker.State("model"); state != BreakerClosed {
+		t.Fatalf("Expected closed breaker, got %s", state)
+	}
+
+	// 2 failures out of 4 reaches the 50% threshold
+	callBreaker(t, breaker, nil)
+	if state := breaker.State("model"); state != BreakerOpen {
+		t.Fatalf("Expected open breaker, got %s", state)
+	}
+
+	if _, err := breaker.Allow("model"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got: %v", err)
+	}
+
+	// Other models are unaffected
+	if _, err := breaker.Allow("other"); err != nil {
+		t.Errorf("Expected other model to be allowed, got: %v", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breaker := newTestCircuitBreaker(10)
+	engineErr := errors.New("engine failure")
+
+	for i := 0; i < 4; i++ {
+		callBreaker(t, breaker, engineErr)
+	}
+	if state := breaker.State("model"); state != BreakerOpen {
+		t.Fatalf("Expected open breaker, got %s", state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Only the configured number of probes is let through
+	probe1, err := breaker.Allow("model")
+	if err != nil {
+		t.Fatalf("Expected first probe to be allowed, got: %v", err)
+	}
+	probe2, err := breaker.Allow("model")
+	if err != nil {
+		t.Fatalf("Expected second probe to be allowed, got: %v", err)
+	}
+	if _, err := breaker.Allow("model"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected extra call to be rejected while half-open, got: %v", err)
+	}
+
+	// A canceled probe does not count and frees its slot
+	probe1(context.Canceled)
+	if state := breaker.State("model"); state != BreakerHalfOpen {
+		t.Fatalf("Expected half-open breaker, got %s", state)
+	}
+	probe3, err := breaker.Allow("model")
+	if err != nil {
+		t.Fatalf("Expected probe slot to be freed, got: %v", err)
+	}
+
+	probe2(nil)
+	probe3(nil)
+	if state := breaker.State("model"); state != BreakerClosed {
+		t.Errorf("Expected breaker to close after successful probes, got %s", state)
+	}
+}
+
+func TestCircuitBreakerReopensOnFailedProbe(t *testing.T) {
+	breaker := newTestCircuitBreaker(10)
+	engineErr := errors.New("engine failure")
+
+	for i := 0; i < 4; i++ {
+		callBreaker(t, breaker, engineErr)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	callBreaker(t, breaker, engineErr)
+	if state := breaker.State("model"); state != BreakerOpen {
+		t.Errorf("Expected failed probe to reopen the breaker, got %s", state)
+	}
+}
@@ -1,14 +1,26 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"math"
 	"os"
-	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EnhancedPredictionService handles ML predictions with both TensorFlow and fallback simulation
@@ -19,38 +31,107 @@ type EnhancedPredictionService struct {
 	imageProcessor  *ImageProcessor
 	logger          *logrus.Logger
 	results         map[string]*models.PredictionResult
-	useTensorFlow   bool
+	resultsMutex    sync.RWMutex
+	feedbackMutex   sync.Mutex
+	limiter         *InferenceLimiter
+	batcher         *BatchScheduler
+	breaker         *CircuitBreaker
+	fallbackPolicy  string
+	fallbackModel   string
+	shadow          *ShadowRunner
+	inflight        atomic.Int64
 }
 
 // NewEnhancedPredictionService creates a new enhanced prediction service
-func NewEnhancedPredictionService(modelService *ModelService, imageService *ImageService, tfService *MockTensorFlowService) *EnhancedPredictionService {
+func NewEnhancedPredictionService(modelService *ModelService, imageService *ImageService, tfService *MockTensorFlowService, logger *logrus.Logger) *EnhancedPredictionService {
 	service := &EnhancedPredictionService{
 		modelService:   modelService,
 		imageService:   imageService,
 		tfService:      tfService,
 		imageProcessor: NewImageProcessor(),
-		logger:         logrus.New(),
+		logger:         logger,
 		results:        make(map[string]*models.PredictionResult),
-		useTensorFlow:  false,
+		fallbackPolicy: config.FallbackPolicyFail,
 	}
-	
-	// Check TensorFlow availability after initialization
-	service.useTensorFlow = service.checkTensorFlowAvailability()
-	
+
 	return service
 }
 
-// checkTensorFlowAvailability checks if TensorFlow models are available
-func (s *EnhancedPredictionService) checkTensorFlowAvailability() bool {
-	// Check if there are any TensorFlow models loaded
-	tfModels := s.tfService.ListModels()
-	return len(tfModels) > 0
+// SetInferenceLimiter bounds concurrent inferences per model. Without a
+// limiter inference is unbounded.
+func (s *EnhancedPredictionService) SetInferenceLimiter(limiter *InferenceLimiter) {
+	s.limiter = limiter
+}
+
+// SetBatchScheduler routes TensorFlow inference through a micro-batching
+// scheduler so concurrent requests for a model share one engine call
+func (s *EnhancedPredictionService) SetBatchScheduler(batcher *BatchScheduler) {
+	s.batcher = batcher
+}
+
+// SetCircuitBreaker guards each model's primary engine with a circuit breaker
+func (s *EnhancedPredictionService) SetCircuitBreaker(breaker *CircuitBreaker) {
+	s.breaker = breaker
+}
+
+// SetFallbackPolicy sets what happens when a model's primary engine fails or
+// its breaker is open: fail the request, serve fallbackModel instead, or
+// serve simulated predictions. The default is to fail.
+func (s *EnhancedPredictionService) SetFallbackPolicy(policy, fallbackModel string) {
+	s.fallbackPolicy = policy
+	s.fallbackModel = fallbackModel
+}
+
+// SetShadowRunner runs the runner's candidate models in the background on
+// each served request and compares them with the primary result
+func (s *EnhancedPredictionService) SetShadowRunner(runner *ShadowRunner) {
+	s.shadow = runner
+}
+
+// Drain waits until no prediction is in flight or ctx expires
+func (s *EnhancedPredictionService) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.inflight.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d predictions still in flight: %w", s.inflight.Load(), ctx.Err())
+		}
+	}
+	return nil
+}
+
+// hasTensorFlowModel reports whether a model is backed by the TensorFlow engine
+func (s *EnhancedPredictionService) hasTensorFlowModel(modelID string) bool {
+	_, err := s.tfService.GetModel(modelID)
+	return err == nil
 }
 
 // PredictImage performs image classification using TensorFlow or simulation
-func (s *EnhancedPredictionService) PredictImage(imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error) {
+func (s *EnhancedPredictionService) PredictImage(ctx context.Context, imageData []byte, metadata *models.ImageMetadata, modelID string) (_ *models.PredictionResult, err error) {
+	ctx, span := tracing.StartSpan(ctx, "EnhancedPredictionService.PredictImage",
+		attribute.String("model.requested_id", modelID),
+		attribute.Int("image.bytes", len(imageData)),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+
 	startTime := time.Now()
 	resultID := s.generateResultID()
+	log := logging.FromContext(ctx, s.logger).WithField("result_id", resultID)
+
+	// Requests without a model are routed between the configured variants
+	modelID, routing := s.modelService.Route(ctx, modelID)
+	if routing != nil {
+		span.SetAttributes(attribute.String("model.routing_reason", routing.Reason))
+	}
 
 	// Get model information
 	model, err := s.modelService.GetModel(modelID)
@@ -58,70 +139,290 @@ func (s *EnhancedPredictionService) PredictImage(imageData []byte, metadata *mod
 		return nil, fmt.Errorf("failed to get model: %w", err)
 	}
 
-	var predictions []models.ClassificationResult
-	
-	// Try TensorFlow prediction first
-	if s.useTensorFlow {
-		predictions, err = s.performTensorFlowInference(imageData, modelID)
-		if err != nil {
-			s.logger.Warnf("TensorFlow inference failed, falling back to simulation: %v", err)
-			predictions, err = s.performSimulatedInference(imageData, model)
-		}
-	} else {
-		// Use simulated inference
-		predictions, err = s.performSimulatedInference(imageData, model)
+	// Wait for an inference slot, shedding load if the queue is saturated
+	ctx, release, err := s.limiter.Acquire(ctx, model.Info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire inference slot: %w", err)
+	}
+	defer release()
+
+	// Bound preprocessing and inference by the model's deadline
+	requestCtx := ctx
+	timeout := s.modelService.InferenceTimeout(model.Info.ID)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	input := &inferenceInput{data: imageData}
+	engineStart := time.Now()
+	outcome, err := s.runPrimaryEngine(ctx, input, model)
+	if err != nil && ctx.Err() == nil {
+		log.Warnf("Primary engine unavailable for model %s, applying %q fallback policy: %v",
+			model.Info.ID, s.fallbackPolicy, err)
+		span.AddEvent("primary engine unavailable", trace.WithAttributes(
+			attribute.String("fallback.policy", s.fallbackPolicy),
+		))
+		outcome, err = s.runFallback(ctx, input, model, err)
 	}
+	engineTime := time.Since(engineStart).Seconds() * 1000
 
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		s.modelService.UpdateModelStats(model.Info.ID, time.Since(startTime).Seconds()*1000, false)
+		s.modelService.RecordRoute(routing, 0, 0, false)
+		if ctx.Err() != nil {
+			return nil, inferenceError(ctx, model.Info.ID, timeout, err)
+		}
 		return nil, fmt.Errorf("inference failed: %w", err)
 	}
 
 	processingTime := time.Since(startTime).Seconds() * 1000
+	span.SetAttributes(
+		attribute.String("model.id", outcome.model.Info.ID),
+		attribute.String("inference.engine", outcome.engine),
+		attribute.Bool("inference.fallback", outcome.fallback),
+	)
+
+	// Keep images that did not arrive through ProcessImage, such as API and
+	// job requests; a storage failure does not fail the prediction
+	if metadata.ImageKey == "" {
+		if err := s.imageService.StoreImage(requestCtx, imageData, metadata); err != nil {
+			log.Errorf("Failed to store image: %v", err)
+		}
+	}
 
 	// Create result
 	result := &models.PredictionResult{
 		ID:          resultID,
-		Predictions: predictions,
+		Predictions: outcome.predictions,
 		Metadata:    *metadata,
 		ProcessedAt: time.Now(),
 		ProcessTime: processingTime,
-		ModelInfo:   model.Info,
+		ModelInfo:   outcome.model.Info,
+		RequestID:   logging.RequestIDFromContext(ctx),
+		Engine:      outcome.engine,
+		Fallback:    outcome.fallback,
+		Calibration: calibrationMethod(outcome),
+		Outcome:     models.OutcomeClassified,
+		Members:     outcome.members,
+		Routing:     routing,
+	}
+
+	if depth, ok := rollupDepthFromContext(ctx); ok && (outcome.model.Taxonomy != nil || outcome.members != nil) {
+		result.RollupDepth = &depth
+	}
+
+	// Reject indecisive predictions with the request's rules, falling back
+	// to those of the model that produced them
+	rules := outcome.model.Info.Rejection
+	if requested, ok := rejectionRulesFromContext(ctx); ok {
+		rules = requested
+	}
+	if rejection := evaluateRejection(rules, outcome.predictions); rejection != nil {
+		result.Outcome = models.OutcomeUnknown
+		result.Rejection = rejection
+		s.modelService.RecordUnknown(model.Info.ID)
+		metrics.UnknownPrediction(model.Info.ID, rejection.Reason)
 	}
 
 	// Update model statistics
-	s.modelService.UpdateModelStats(model.Info.ID, processingTime, err == nil)
+	s.modelService.UpdateModelStats(model.Info.ID, processingTime, true)
+	var topConfidence float64
+	if len(outcome.predictions) > 0 {
+		topConfidence = outcome.predictions[0].Confidence
+	}
+	s.modelService.RecordRoute(routing, processingTime, topConfidence, true)
 
 	// Store result
+	s.resultsMutex.Lock()
 	s.results[resultID] = result
+	s.resultsMutex.Unlock()
+
+	// Archive results of stored images so history survives restarts and
+	// can be reprocessed with other models
+	if metadata.ImageKey != "" {
+		s.archiveResult(requestCtx, result)
+	}
 
-	s.logger.Infof("Prediction completed: %s (%.2fms, model: %s, method: %s)", 
-		resultID, processingTime, model.Info.Name, s.getInferenceMethod())
+	// Candidates are compared with the model itself, not with a fallback
+	if !outcome.fallback {
+		s.runShadows(requestCtx, input, result, engineTime)
+	}
+
+	log.Infof("Prediction completed: %s (%.2fms, model: %s, engine: %s, fallback: %t, outcome: %s)",
+		resultID, processingTime, outcome.model.Info.Name, outcome.engine, outcome.fallback, result.Outcome)
 
 	return result, nil
 }
 
+// inferenceInput is the image of one request. It is preprocessed at most
+// once and the tensor is shared by the primary and shadow models.
+type inferenceInput struct {
+	data   []byte
+	once   sync.Once
+	tensor [][]float32
+	err    error
+}
+
+// preprocess returns the input tensor, computing it on first use
+func (in *inferenceInput) preprocess(ctx context.Context, processor *ImageProcessor) ([][]float32, error) {
+	in.once.Do(func() {
+		in.tensor, in.err = processor.ProcessImageBytes(ctx, in.data)
+	})
+	return in.tensor, in.err
+}
+
+// inferenceOutcome is the output of one engine run
+type inferenceOutcome struct {
+	predictions []models.ClassificationResult
+	model       *LoadedModel
+	engine      string
+	fallback    bool
+	members     []models.MemberPrediction
+}
+
+// runPrimaryEngine runs a model on its own engine. Ensembles run their
+// members; label sets embed the input with their base model; models backed
+// by TensorFlow go through the model's circuit breaker; models without a
+// TensorFlow backing are served by the simulated engine.
+func (s *EnhancedPredictionService) runPrimaryEngine(ctx context.Context, input *inferenceInput, model *LoadedModel) (*inferenceOutcome, error) {
+	if model.Info.Ensemble != nil {
+		return s.runEnsemble(ctx, input, model)
+	}
+	if model.LabelSet != nil {
+		return s.runLabelSet(ctx, input, model)
+	}
+
+	outcome := &inferenceOutcome{model: model, engine: metrics.EngineSimulated}
+
+	if !s.hasTensorFlowModel(model.Info.ID) {
+		predictions, err := s.performSimulatedInference(ctx, input.data, model)
+		if err != nil {
+			return nil, err
+		}
+		outcome.predictions = predictions
+		return outcome, nil
+	}
+
+	done, err := s.breaker.Allow(model.Info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", model.Info.ID, err)
+	}
+
+	predictions, err := s.performTensorFlowInference(ctx, input, model)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome.predictions = predictions
+	outcome.engine = metrics.EngineTensorFlow
+	return outcome, nil
+}
+
+// runFallback applies the fallback policy after the primary engine failed
+// with primaryErr
+func (s *EnhancedPredictionService) runFallback(ctx context.Context, input *inferenceInput, model *LoadedModel, primaryErr error) (*inferenceOutcome, error) {
+	var outcome *inferenceOutcome
+
+	switch s.fallbackPolicy {
+	case config.FallbackPolicyModel:
+		fallbackModel, err := s.modelService.GetModel(s.fallbackModel)
+		if err != nil || fallbackModel.Info.ID == model.Info.ID {
+			return nil, primaryErr
+		}
+		// The fallback takes over every request that trips the breaker, so
+		// it is held to its own concurrency limit and queue
+		fallbackCtx, release, err := s.limiter.Acquire(ctx, fallbackModel.Info.ID)
+		if err != nil {
+			return nil, fmt.Errorf("fallback model %s: %w (primary: %v)", fallbackModel.Info.ID, err, primaryErr)
+		}
+		defer release()
+		outcome, err = s.runPrimaryEngine(fallbackCtx, input, fallbackModel)
+		if err != nil {
+			return nil, fmt.Errorf("fallback model %s failed: %w (primary: %v)", fallbackModel.Info.ID, err, primaryErr)
+		}
+	case config.FallbackPolicySimulated:
+		predictions, err := s.performSimulatedInference(ctx, input.data, model)
+		if err != nil {
+			return nil, err
+		}
+		outcome = &inferenceOutcome{predictions: predictions, model: model, engine: metrics.EngineSimulated}
+	default:
+		return nil, primaryErr
+	}
+
+	metrics.EngineFallback(model.Info.ID, s.fallbackPolicy)
+	outcome.fallback = true
+	return outcome, nil
+}
+
+// calibrationMethod returns the calibration applied to an outcome's
+// predictions; ensembles are calibrated through their members
+func calibrationMethod(outcome *inferenceOutcome) string {
+	if outcome.members != nil || outcome.model.Info.Calibration == nil {
+		return ""
+	}
+	return outcome.model.Info.Calibration.Method
+}
+
 // performTensorFlowInference runs actual TensorFlow inference
-func (s *EnhancedPredictionService) performTensorFlowInference(imageData []byte, modelID string) ([]models.ClassificationResult, error) {
+func (s *EnhancedPredictionService) performTensorFlowInference(ctx context.Context, input *inferenceInput, model *LoadedModel) ([]models.ClassificationResult, error) {
+	modelID := model.Info.ID
+
 	// Get TensorFlow model
 	tfModel, err := s.tfService.GetModel(modelID)
 	if err != nil {
 		return nil, fmt.Errorf("TensorFlow model not found: %w", err)
 	}
 
-	// Preprocess image
-	tensorData, err := s.imageProcessor.ProcessImageBytes(imageData)
-	if err != nil {
-		return nil, fmt.Errorf("image preprocessing failed: %w", err)
-	}
+	var rawPredictions []float32
+	if s.batcher != nil {
+		// Decode here and let the scheduler preprocess and infer the whole batch
+		img, _, err := image.Decode(bytes.NewReader(input.data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
 
-	// Run inference
-	rawPredictions, err := s.tfService.Predict(modelID, tensorData)
-	if err != nil {
-		return nil, fmt.Errorf("TensorFlow prediction failed: %w", err)
+		rawPredictions, err = s.batcher.Submit(ctx, modelID, img)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Preprocess image
+		tensorData, err := input.preprocess(ctx, s.imageProcessor)
+		if err != nil {
+			return nil, fmt.Errorf("image preprocessing failed: %w", err)
+		}
+
+		// Run inference
+		inferenceStart := time.Now()
+		rawPredictions, err = s.tfService.Predict(ctx, modelID, tensorData)
+		metrics.ObserveInference(modelID, metrics.EngineTensorFlow, time.Since(inferenceStart))
+		if err != nil {
+			return nil, fmt.Errorf("TensorFlow prediction failed: %w", err)
+		}
 	}
 
-	// Postprocess predictions
-	classificationPreds, err := s.imageProcessor.PostprocessPredictions(rawPredictions, tfModel.Info.Classes, 5)
+	return s.postprocess(ctx, rawPredictions, tfModel.Info.Classes, model)
+}
+
+// postprocess converts raw engine scores to the top calibrated predictions
+// of a model, rolled up in its taxonomy when the request asks for it
+func (s *EnhancedPredictionService) postprocess(ctx context.Context, rawPredictions []float32, classes []string, model *LoadedModel) ([]models.ClassificationResult, error) {
+	depth, rollUp := rollupDepthFromContext(ctx)
+	rollUp = rollUp && model.Taxonomy != nil
+
+	// Rolling up sums over every class, not only the top ones
+	topK := 5
+	if rollUp {
+		topK = len(classes)
+	}
+	classificationPreds, err := s.imageProcessor.PostprocessPredictions(ctx, rawPredictions, classes, topK, model.Info.Calibration)
 	if err != nil {
 		return nil, fmt.Errorf("postprocessing failed: %w", err)
 	}
@@ -130,64 +431,344 @@ func (s *EnhancedPredictionService) performTensorFlowInference(imageData []byte,
 	var predictions []models.ClassificationResult
 	for _, pred := range classificationPreds {
 		predictions = append(predictions, models.ClassificationResult{
-			ClassName:   pred.ClassName,
-			Label:       pred.ClassName,
-			Description: s.getClassDescription(pred.ClassName),
-			Confidence:  float64(pred.Confidence),
-			Probability: float64(pred.Probability),
+			ClassName:     pred.ClassName,
+			Confidence:    float64(pred.Confidence),
+			Probability:   float64(pred.Probability),
+			RawConfidence: float64(pred.RawConfidence),
 		})
+		model.Labels.describe(&predictions[len(predictions)-1])
+		if model.Taxonomy != nil {
+			predictions[len(predictions)-1].Path = model.Taxonomy.Path(pred.ClassName)
+		}
+	}
+
+	if rollUp {
+		predictions = model.Taxonomy.rollUp(predictions, depth, model.Labels)
+		if len(predictions) > 5 {
+			predictions = predictions[:5]
+		}
 	}
 
 	return predictions, nil
 }
 
+// runShadows runs the shadow candidates on the request's input in the
+// background and attaches their predictions to the stored result once all
+// have finished. Shadows never delay or change the response.
+func (s *EnhancedPredictionService) runShadows(ctx context.Context, input *inferenceInput, result *models.PredictionResult, primaryTime float64) {
+	if s.shadow == nil || len(result.Predictions) == 0 {
+		return
+	}
+
+	var candidates []*LoadedModel
+	for _, modelID := range s.shadow.Models() {
+		if modelID == result.ModelInfo.ID {
+			continue
+		}
+		model, err := s.modelService.GetModel(modelID)
+		if err != nil {
+			s.shadow.recordFailure(modelID)
+			continue
+		}
+		if s.shadow.acquire(modelID) {
+			candidates = append(candidates, model)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	log := logging.FromContext(ctx, s.logger).WithField("result_id", result.ID)
+
+	go func() {
+		shadows := make([]*models.ShadowPrediction, len(candidates))
+		var wg sync.WaitGroup
+		for i, model := range candidates {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.shadow.release()
+
+				shadow, err := s.runShadow(ctx, input, model)
+				if err != nil {
+					s.shadow.recordFailure(model.Info.ID)
+					log.Warnf("Shadow inference with model %s failed: %v", model.Info.ID, err)
+					return
+				}
+				shadow.Agrees = s.shadow.record(result, *shadow, primaryTime)
+				shadows[i] = shadow
+			}()
+		}
+		wg.Wait()
+
+		s.attachShadows(ctx, result.ID, shadows)
+	}()
+}
+
+// runShadow runs one candidate model on the shared input. Shadows bypass
+// the batcher, inference limiter and circuit breaker so they cannot affect
+// primary traffic; they are bounded by the shadow runner instead. Ensemble
+// and label set candidates run as usual.
+func (s *EnhancedPredictionService) runShadow(ctx context.Context, input *inferenceInput, model *LoadedModel) (*models.ShadowPrediction, error) {
+	if timeout := s.modelService.InferenceTimeout(model.Info.ID); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	shadow := &models.ShadowPrediction{ModelID: model.Info.ID, Engine: metrics.EngineSimulated}
+
+	if model.Info.Ensemble != nil {
+		outcome, err := s.runEnsemble(ctx, input, model)
+		if err != nil {
+			return nil, err
+		}
+		shadow.Engine = outcome.engine
+		shadow.Predictions = outcome.predictions
+		shadow.ProcessTime = time.Since(start).Seconds() * 1000
+		return shadow, nil
+	}
+
+	if model.LabelSet != nil {
+		outcome, err := s.runLabelSet(ctx, input, model)
+		if err != nil {
+			return nil, err
+		}
+		shadow.Engine = outcome.engine
+		shadow.Predictions = outcome.predictions
+		shadow.ProcessTime = time.Since(start).Seconds() * 1000
+		return shadow, nil
+	}
+
+	if !s.hasTensorFlowModel(model.Info.ID) {
+		predictions, err := s.performSimulatedInference(ctx, input.data, model)
+		if err != nil {
+			return nil, err
+		}
+		shadow.Predictions = predictions
+		shadow.ProcessTime = time.Since(start).Seconds() * 1000
+		return shadow, nil
+	}
+
+	tfModel, err := s.tfService.GetModel(model.Info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("TensorFlow model not found: %w", err)
+	}
+	tensorData, err := input.preprocess(ctx, s.imageProcessor)
+	if err != nil {
+		return nil, fmt.Errorf("image preprocessing failed: %w", err)
+	}
+	rawPredictions, err := s.tfService.Predict(ctx, model.Info.ID, tensorData)
+	if err != nil {
+		return nil, fmt.Errorf("TensorFlow prediction failed: %w", err)
+	}
+	shadow.Predictions, err = s.postprocess(ctx, rawPredictions, tfModel.Info.Classes, model)
+	if err != nil {
+		return nil, err
+	}
+
+	shadow.Engine = metrics.EngineTensorFlow
+	shadow.ProcessTime = time.Since(start).Seconds() * 1000
+	return shadow, nil
+}
+
+// attachShadows adds the finished shadow predictions to a stored result.
+// The stored result is replaced by a copy because the original may still
+// be serialized by the response.
+func (s *EnhancedPredictionService) attachShadows(ctx context.Context, resultID string, shadows []*models.ShadowPrediction) {
+	s.resultsMutex.Lock()
+	stored, ok := s.results[resultID]
+	if !ok {
+		s.resultsMutex.Unlock()
+		return
+	}
+	updated := *stored
+	updated.Shadow = append([]models.ShadowPrediction{}, stored.Shadow...)
+	for _, shadow := range shadows {
+		if shadow != nil {
+			updated.Shadow = append(updated.Shadow, *shadow)
+		}
+	}
+	s.results[resultID] = &updated
+	s.resultsMutex.Unlock()
+
+	if updated.Metadata.ImageKey != "" {
+		s.archiveResult(ctx, &updated)
+	}
+}
+
 // performSimulatedInference runs simulated inference (fallback)
-func (s *EnhancedPredictionService) performSimulatedInference(imageData []byte, model *LoadedModel) ([]models.ClassificationResult, error) {
-	// Simulate processing time
-	time.Sleep(time.Millisecond * 100)
+func (s *EnhancedPredictionService) performSimulatedInference(ctx context.Context, imageData []byte, model *LoadedModel) ([]models.ClassificationResult, error) {
+	scores, classes, err := s.simulatedScores(ctx, imageData, model)
+	if err != nil {
+		return nil, err
+	}
+	return s.postprocess(ctx, scores, classes, model)
+}
+
+// simulatedScores generates logits for a model's first classes. The scores
+// are log-weights, so the softmax in postprocessing normalizes them.
+func (s *EnhancedPredictionService) simulatedScores(ctx context.Context, imageData []byte, model *LoadedModel) ([]float32, []string, error) {
+	inferenceStart := time.Now()
+	_, span := tracing.StartSpan(ctx, "SimulatedEngine.Predict",
+		attribute.String("model.id", model.Info.ID),
+		attribute.String("inference.engine", metrics.EngineSimulated),
+	)
+	defer func() {
+		span.End()
+		metrics.ObserveInference(model.Info.ID, metrics.EngineSimulated, time.Since(inferenceStart))
+	}()
+
+	// Simulate processing time, giving up early if the request is canceled
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	var scores []float32
+	var classes []string
 
-	// Generate simulated predictions
-	predictions := make([]models.ClassificationResult, 0, 5)
-	
 	// Use deterministic randomness based on image data for consistent results
 	seed := int64(len(imageData))
 	for i, class := range model.Info.Classes {
 		if i >= 10 { // Limit to top 10 classes for simulation
 			break
 		}
-		
+
 		// Generate pseudo-random confidence based on class index and image data
 		confidence := s.generateConfidence(seed, int64(i))
-		
+
 		if confidence > 0.01 { // Only include predictions with >1% confidence
-			predictions = append(predictions, models.ClassificationResult{
-				ClassName:   class,
-				Label:       class,
-				Description: s.getClassDescription(class),
-				Confidence:  confidence,
-				Probability: confidence, // For now, confidence and probability are the same
-			})
+			scores = append(scores, float32(math.Log(confidence)))
+			classes = append(classes, class)
 		}
 	}
 
-	// Sort by confidence (descending)
-	sort.Slice(predictions, func(i, j int) bool {
-		return predictions[i].Confidence > predictions[j].Confidence
-	})
+	if len(scores) == 0 {
+		return nil, nil, fmt.Errorf("no valid predictions generated")
+	}
+
+	return scores, classes, nil
+}
+
+// RawScores runs a model on an image and returns its uncalibrated
+// probabilities for every class, for fitting calibration. It bypasses the
+// inference limiter, batcher and circuit breaker.
+func (s *EnhancedPredictionService) RawScores(ctx context.Context, imageData []byte, modelID string) ([]string, []float64, error) {
+	model, err := s.modelService.GetModel(modelID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("model not found: %w", err)
+	}
+	if model.Info.Ensemble != nil {
+		return nil, nil, fmt.Errorf("model %s is an ensemble; calibrate its members instead", modelID)
+	}
+	if model.LabelSet != nil {
+		return nil, nil, fmt.Errorf("model %s is a label set and cannot be calibrated", modelID)
+	}
 
-	// Normalize probabilities to sum to 1.0
-	s.normalizeProbabilities(predictions)
+	if !s.hasTensorFlowModel(modelID) {
+		scores, classes, err := s.simulatedScores(ctx, imageData, model)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Classes the simulation left out have no probability
+		simulated := make(map[string]float64, len(classes))
+		for i, prob := range applySoftmax(scores) {
+			simulated[classes[i]] = float64(prob)
+		}
+		probs := make([]float64, len(model.Info.Classes))
+		for i, class := range model.Info.Classes {
+			probs[i] = simulated[class]
+		}
+		return model.Info.Classes, probs, nil
+	}
 
-	// Return top 5 predictions
-	if len(predictions) > 5 {
-		predictions = predictions[:5]
+	tfModel, err := s.tfService.GetModel(modelID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("TensorFlow model not found: %w", err)
+	}
+	input := &inferenceInput{data: imageData}
+	tensorData, err := input.preprocess(ctx, s.imageProcessor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("image preprocessing failed: %w", err)
+	}
+	rawPredictions, err := s.tfService.Predict(ctx, modelID, tensorData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("TensorFlow prediction failed: %w", err)
+	}
+	if len(rawPredictions) != len(tfModel.Info.Classes) {
+		return nil, nil, fmt.Errorf("model returned %d scores for %d classes", len(rawPredictions), len(tfModel.Info.Classes))
 	}
 
-	if len(predictions) == 0 {
-		return nil, fmt.Errorf("no valid predictions generated")
+	probs := make([]float64, len(rawPredictions))
+	for i, prob := range applySoftmax(rawPredictions) {
+		probs[i] = float64(prob)
 	}
+	return tfModel.Info.Classes, probs, nil
+}
 
-	return predictions, nil
+// Embed returns the embedding of an image under an embedding-capable
+// model, for building label set prototypes. It waits for an inference slot
+// like a prediction, but like RawScores it bypasses the batcher and circuit
+// breaker.
+func (s *EnhancedPredictionService) Embed(ctx context.Context, imageData []byte, modelID string) ([]float64, error) {
+	model, err := s.modelService.GetModel(modelID)
+	if err != nil {
+		return nil, fmt.Errorf("model not found: %w", err)
+	}
+
+	// Embedding costs as much as a prediction, so it waits for a slot too
+	ctx, release, err := s.limiter.Acquire(ctx, model.Info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire inference slot: %w", err)
+	}
+	defer release()
+
+	return s.embed(ctx, &inferenceInput{data: imageData}, model)
+}
+
+// embed runs a model's embedding layer on the input. Models without a
+// TensorFlow backing pool the preprocessed tensor the way the mock engine
+// does.
+func (s *EnhancedPredictionService) embed(ctx context.Context, input *inferenceInput, model *LoadedModel) ([]float64, error) {
+	if !s.embeds(model) {
+		return nil, fmt.Errorf("model %s does not expose embeddings", model.Info.ID)
+	}
+
+	tensorData, err := input.preprocess(ctx, s.imageProcessor)
+	if err != nil {
+		return nil, fmt.Errorf("image preprocessing failed: %w", err)
+	}
+
+	var embedding []float32
+	if s.hasTensorFlowModel(model.Info.ID) {
+		embedding, err = s.tfService.Embed(ctx, model.Info.ID, tensorData)
+	} else {
+		shape := s.imageProcessor.GetInputShape()
+		embedding, err = poolEmbedding(tensorData[0], shape[1], shape[2], shape[3])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+
+	values := make([]float64, len(embedding))
+	for i, value := range embedding {
+		values[i] = float64(value)
+	}
+	return values, nil
+}
+
+// embeds reports whether a model exposes embeddings, as declared by its
+// TensorFlow backing or, for simulated models, by its metadata
+func (s *EnhancedPredictionService) embeds(model *LoadedModel) bool {
+	if tfModel, err := s.tfService.GetModel(model.Info.ID); err == nil {
+		return tfModel.Info.Embedding
+	}
+	return model.Info.Embedding
 }
 
 // LoadTensorFlowModel loads a TensorFlow model from disk
@@ -201,30 +782,95 @@ func (s *EnhancedPredictionService) LoadTensorFlowModel(modelPath string, modelI
 		return fmt.Errorf("failed to load TensorFlow model: %w", err)
 	}
 
-	// Update availability status
-	s.useTensorFlow = s.checkTensorFlowAvailability()
-	
 	s.logger.Infof("Successfully loaded TensorFlow model: %s", modelID)
 	return nil
 }
 
-// GetInferenceMethod returns the current inference method being used
-func (s *EnhancedPredictionService) getInferenceMethod() string {
-	if s.useTensorFlow {
-		return "tensorflow"
-	}
-	return "simulated"
-}
-
-// GetResult retrieves a prediction result by ID
+// GetResult retrieves a prediction result by ID, falling back to the
+// results archived in the blob store
 func (s *EnhancedPredictionService) GetResult(resultID string) (*models.PredictionResult, error) {
+	s.resultsMutex.RLock()
 	result, exists := s.results[resultID]
-	if !exists {
-		return nil, fmt.Errorf("result not found: %s", resultID)
+	s.resultsMutex.RUnlock()
+	if exists {
+		metrics.CacheHit("results")
+		return result, nil
+	}
+	metrics.CacheMiss("results")
+
+	store := s.imageService.BlobStore()
+	if store == nil {
+		return nil, fmt.Errorf("%w: %s", ErrResultNotFound, resultID)
+	}
+	result, err := loadResult(context.Background(), store, ResultKey(resultID))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrResultNotFound, resultID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load result %s: %w", resultID, err)
 	}
+
+	s.resultsMutex.Lock()
+	s.results[resultID] = result
+	s.resultsMutex.Unlock()
 	return result, nil
 }
 
+// SubmitFeedback records user feedback on a result, replacing earlier
+// feedback. Feedback is stored with the result and archived with it.
+// Submissions are serialized, so each replaces the counts of the one before
+// and the archive ends up with the latest.
+func (s *EnhancedPredictionService) SubmitFeedback(ctx context.Context, resultID string, request models.FeedbackRequest) (*models.PredictionResult, error) {
+	s.feedbackMutex.Lock()
+	defer s.feedbackMutex.Unlock()
+
+	result, err := s.GetResult(resultID)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := newFeedback(result, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the stored result with a copy, as attachShadows does
+	s.resultsMutex.Lock()
+	if stored, ok := s.results[resultID]; ok {
+		result = stored
+	}
+	previous := result.Feedback
+	updated := *result
+	updated.Feedback = feedback
+	s.results[resultID] = &updated
+	s.resultsMutex.Unlock()
+
+	s.modelService.RecordFeedback(updated.ModelInfo.ID, previous, feedback)
+	metrics.PredictionFeedback(updated.ModelInfo.ID, feedback.Rating)
+	if updated.Metadata.ImageKey != "" {
+		s.archiveResult(ctx, &updated)
+	}
+
+	logging.FromContext(ctx, s.logger).Infof("Feedback on result %s: %s (predicted %s, correct label %q)",
+		resultID, feedback.Rating, feedback.PredictedClass, feedback.CorrectLabel)
+	return &updated, nil
+}
+
+// archiveResult writes a result to the blob store next to its image
+func (s *EnhancedPredictionService) archiveResult(ctx context.Context, result *models.PredictionResult) {
+	store := s.imageService.BlobStore()
+	if store == nil {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err == nil {
+		err = store.Put(ctx, ResultKey(result.ID), data, "application/json")
+	}
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Errorf("Failed to archive result %s: %v", result.ID, err)
+	}
+}
+
 // ListModels returns available models (both regular and TensorFlow)
 func (s *EnhancedPredictionService) ListModels() []models.ModelInfo {
 	var allModels []models.ModelInfo
@@ -268,57 +914,4 @@ func (s *EnhancedPredictionService) generateConfidence(seed, index int64) float6
 	}
 	
 	return confidence
-}
-
-func (s *EnhancedPredictionService) normalizeProbabilities(predictions []models.ClassificationResult) {
-	var total float64
-	for _, pred := range predictions {
-		total += pred.Probability
-	}
-	
-	if total > 0 {
-		for i := range predictions {
-			predictions[i].Probability /= total
-		}
-	}
-}
-
-func (s *EnhancedPredictionService) getClassDescription(className string) string {
-	descriptions := map[string]string{
-		"cat":        "A small domestic feline mammal",
-		"dog":        "A domestic canine companion animal",
-		"bird":       "A feathered, winged, bipedal animal",
-		"car":        "A four-wheeled motor vehicle",
-		"truck":      "A large motor vehicle for transporting goods",
-		"airplane":   "A powered flying vehicle with wings",
-		"boat":       "A watercraft designed for travel on water",
-		"train":      "A connected series of railway cars",
-		"bicycle":    "A two-wheeled vehicle powered by pedaling",
-		"motorcycle": "A two-wheeled motor vehicle",
-		"person":     "A human being",
-		"horse":      "A large domesticated ungulate mammal",
-		"sheep":      "A woolly ruminant mammal",
-		"cow":        "A large domesticated bovine animal",
-		"elephant":   "A large mammal with a trunk",
-		"bear":       "A large omnivorous mammal",
-		"zebra":      "A black and white striped equine",
-		"giraffe":    "A tall African mammal with a long neck",
-		// ImageNet classes
-		"tench":      "A European freshwater fish",
-		"goldfish":   "A small golden-colored fish",
-		"great_white_shark": "A large predatory shark",
-		"tiger_shark": "A large shark with distinctive markings",
-		"hammerhead": "A shark with a flattened head",
-		"electric_ray": "A cartilaginous fish that can produce electric discharge",
-		"stingray":   "A cartilaginous fish with a long tail",
-		"cock":       "A male domestic fowl",
-		"hen":        "A female domestic fowl",
-		"ostrich":    "A large flightless bird",
-	}
-	
-	if desc, exists := descriptions[className]; exists {
-		return desc
-	}
-	
-	return fmt.Sprintf("A %s object or entity", className)
 }
\ No newline at end of file
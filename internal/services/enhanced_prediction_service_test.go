@@ -0,0 +1,641 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestEnhancedPredictionService(cfg *config.Config) *EnhancedPredictionService {
+	logger := logrus.New()
+	modelService := NewModelService(cfg, logger)
+	imageService := NewImageService(cfg, logger)
+	tfService := NewTensorFlowService(cfg, logger)
+	return NewEnhancedPredictionService(modelService, imageService, tfService, logger)
+}
+
+func TestEnhancedPredictImage(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	metadata := &models.ImageMetadata{Filename: "test.jpg"}
+
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+
+	if len(result.Predictions) == 0 {
+		t.Error("Expected at least one prediction")
+	}
+
+	if result.Engine != metrics.EngineSimulated || result.Fallback {
+		t.Errorf("Expected dummy model to be served by its own simulated engine, got engine=%s fallback=%t",
+			result.Engine, result.Fallback)
+	}
+
+	stored, err := service.GetResult(result.ID)
+	if err != nil || stored.ID != result.ID {
+		t.Errorf("Expected result %s to be retrievable, got error: %v", result.ID, err)
+	}
+}
+
+func TestEnhancedPredictImageTimeout(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:              "./testdata/models",
+			Version:           "1.0.0",
+			InferenceTimeout:  5000,
+			InferenceTimeouts: map[string]int{"dummy": 10},
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	metadata := &models.ImageMetadata{Filename: "test.jpg"}
+
+	start := time.Now()
+	_, err := service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "dummy")
+	if !errors.Is(err, ErrInferenceTimeout) {
+		t.Fatalf("Expected ErrInferenceTimeout, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("Expected inference to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestEnhancedPredictImageCanceled(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:    "./testdata/models",
+			Version: "1.0.0",
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	metadata := &models.ImageMetadata{Filename: "test.jpg"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := service.PredictImage(ctx, []byte("image-bytes"), metadata, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+
+	if errors.Is(err, ErrInferenceTimeout) {
+		t.Error("Expected cancellation not to be reported as a timeout")
+	}
+}
+
+func TestEnhancedPredictImageFallbackPolicy(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:                  "./testdata/models",
+			Version:               "1.0.0",
+			InferenceTimeout:      5000,
+			BreakerFailureRate:    0.5,
+			BreakerMinRequests:    1,
+			BreakerWindow:         10,
+			BreakerOpenTimeout:    60000,
+			BreakerHalfOpenProbes: 1,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	service.SetCircuitBreaker(NewCircuitBreaker(cfg))
+	metadata := &models.ImageMetadata{Filename: "test.jpg"}
+
+	// Back the dummy model with a TensorFlow model that always fails
+	if err := service.tfService.LoadModel("./testdata/models", "dummy"); err != nil {
+		t.Fatalf("Failed to load mock model: %v", err)
+	}
+	tfModel, _ := service.tfService.GetModel("dummy")
+	tfModel.Available = false
+
+	// Default policy fails instead of fabricating predictions
+	_, err := service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "")
+	if err == nil {
+		t.Fatal("Expected prediction to fail with the fail policy")
+	}
+
+	// The failure opened the breaker, so the engine is no longer called
+	_, err = service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got: %v", err)
+	}
+
+	// Simulated policy serves predictions but says so
+	service.SetFallbackPolicy(config.FallbackPolicySimulated, "")
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "")
+	if err != nil {
+		t.Fatalf("Expected simulated fallback to succeed, got: %v", err)
+	}
+	if result.Engine != metrics.EngineSimulated || !result.Fallback {
+		t.Errorf("Expected simulated fallback result, got engine=%s fallback=%t", result.Engine, result.Fallback)
+	}
+
+	// The fallback model is held to its own concurrency limit
+	one, none := 1, 0
+	cfg.Models = map[string]config.ModelOverrides{"same": {MaxConcurrentInferences: &one, MaxQueuedInferences: &none}}
+	limiter := NewInferenceLimiter(cfg)
+	service.SetInferenceLimiter(limiter)
+	dummy, _ := service.modelService.GetModel("dummy")
+	service.modelService.models["same"] = &LoadedModel{Info: models.ModelInfo{ID: "same", Classes: dummy.Info.Classes}}
+	service.SetFallbackPolicy(config.FallbackPolicyModel, "same")
+
+	_, release, err := limiter.Acquire(context.Background(), "same")
+	if err != nil {
+		t.Fatalf("Expected to take the fallback model's slot, got: %v", err)
+	}
+	_, err = service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "dummy")
+	if !IsOverloaded(err) || OverloadedModel(err) != "same" {
+		t.Errorf("Expected the busy fallback model to shed the request, got: %v", err)
+	}
+	release()
+
+	result, err = service.PredictImage(context.Background(), []byte("image-bytes"), metadata, "dummy")
+	if err != nil {
+		t.Fatalf("Expected model fallback to succeed, got: %v", err)
+	}
+	if result.ModelInfo.ID != "same" || !result.Fallback {
+		t.Errorf("Expected result from the fallback model, got model=%s fallback=%t", result.ModelInfo.ID, result.Fallback)
+	}
+}
+
+func TestEnhancedPredictImageUsesRoutedVariant(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:                    "./testdata/models",
+			Version:                 "1.0.0",
+			InferenceTimeout:        5000,
+			MaxConcurrentInferences: 1,
+			MaxQueuedInferences:     0,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	limiter := NewInferenceLimiter(cfg)
+	service.SetInferenceLimiter(limiter)
+	dummy, _ := service.modelService.GetModel("dummy")
+	service.modelService.models["dummy_v2"] = &LoadedModel{Info: models.ModelInfo{ID: "dummy_v2", Classes: dummy.Info.Classes}}
+	service.modelService.SetRoutingWeights(map[string]int{"dummy": 1, "dummy_v2": 1})
+
+	// The caller holds the routed variant's only slot, so the prediction
+	// must run on that variant instead of routing again
+	for i := 0; i < 20; i++ {
+		ctx, modelID := service.modelService.WithRoute(context.Background(), "")
+		ctx, release, err := limiter.Acquire(ctx, modelID)
+		if err != nil {
+			t.Fatalf("Expected a free slot, got: %v", err)
+		}
+		result, err := service.PredictImage(ctx, []byte("image-bytes"), &models.ImageMetadata{}, "")
+		release()
+		if err != nil {
+			t.Fatalf("Expected prediction to reuse the held slot, got: %v", err)
+		}
+		if result.ModelInfo.ID != modelID || result.Routing == nil || result.Routing.Variant != modelID {
+			t.Fatalf("Expected prediction on routed variant %s, got %s (%+v)", modelID, result.ModelInfo.ID, result.Routing)
+		}
+	}
+}
+
+func TestEnhancedPredictImageShadows(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:                "./testdata/models",
+			Version:             "1.0.0",
+			InferenceTimeout:    5000,
+			ShadowModels:        []string{"dummy", "same", "renamed", "missing"},
+			ShadowMaxConcurrent: 4,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	dummy, _ := service.modelService.GetModel("dummy")
+	var renamed []string
+	for _, class := range dummy.Info.Classes {
+		renamed = append(renamed, "other "+class)
+	}
+	service.modelService.models["same"] = &LoadedModel{Info: models.ModelInfo{ID: "same", Classes: dummy.Info.Classes}}
+	service.modelService.models["renamed"] = &LoadedModel{Info: models.ModelInfo{ID: "renamed", Classes: renamed}}
+	runner := NewShadowRunner(cfg)
+	service.SetShadowRunner(runner)
+
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "dummy")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	if len(result.Shadow) != 0 {
+		t.Error("Expected the response not to wait for shadows")
+	}
+
+	// Shadows are attached to the stored result once they have all finished
+	var stored *models.PredictionResult
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		stored, _ = service.GetResult(result.ID)
+		if len(stored.Shadow) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(stored.Shadow) != 2 {
+		t.Fatalf("Expected shadows of the two loaded candidates, got %+v", stored.Shadow)
+	}
+
+	report := runner.Report()
+	byModel := make(map[string]models.ShadowCandidate)
+	for _, candidate := range report.Candidates {
+		byModel[candidate.ModelID] = candidate
+	}
+	if byModel["same"].Compared != 1 || byModel["same"].AgreementRate != 1 {
+		t.Errorf("Expected identical candidate to agree, got %+v", byModel["same"])
+	}
+	renamedStats := byModel["renamed"]
+	if renamedStats.AgreementRate != 0 || len(renamedStats.Disagreements) != 1 ||
+		renamedStats.Disagreements[0].ResultID != result.ID {
+		t.Errorf("Expected renamed candidate to disagree on %s, got %+v", result.ID, renamedStats)
+	}
+	if renamedStats.MeanShadowLatency <= 0 || renamedStats.MeanPrimaryLatency <= 0 {
+		t.Errorf("Expected latencies to be recorded, got %+v", renamedStats)
+	}
+	if byModel["missing"].Failures != 1 || byModel["dummy"].Compared != 0 {
+		t.Errorf("Expected missing candidate to fail and the primary model not to shadow itself, got %+v", report.Candidates)
+	}
+}
+
+func TestEnhancedPredictImageEnsemble(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	dummy, _ := service.modelService.GetModel("dummy")
+	service.modelService.models["same"] = &LoadedModel{Info: models.ModelInfo{ID: "same", Classes: dummy.Info.Classes}}
+	service.modelService.models["ensemble"] = &LoadedModel{Info: models.ModelInfo{
+		ID: "ensemble",
+		Ensemble: &models.EnsembleSpec{
+			Strategy: models.EnsembleMeanProbability,
+			Members: []models.EnsembleMember{
+				{ModelID: "dummy", Weight: 2},
+				{ModelID: "same"},
+				{ModelID: "missing"},
+			},
+		},
+	}}
+
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "ensemble")
+	if err != nil {
+		t.Fatalf("Expected ensemble prediction to succeed, got error: %v", err)
+	}
+	if result.Engine != metrics.EngineEnsemble || len(result.Members) != 3 {
+		t.Fatalf("Expected an ensemble result with three members, got engine %q and %+v", result.Engine, result.Members)
+	}
+	if result.Members[0].Weight != 2 || result.Members[1].Weight != 1 || result.Members[2].Error == "" {
+		t.Errorf("Expected member weights and the missing member's error, got %+v", result.Members)
+	}
+
+	// Identical members average to the same predictions
+	top := result.Members[0].Predictions[0]
+	if result.Predictions[0].ClassName != top.ClassName || math.Abs(result.Predictions[0].Confidence-top.Confidence) > 1e-9 {
+		t.Errorf("Expected combined top prediction %+v, got %+v", top, result.Predictions[0])
+	}
+
+	// Members wait for their own inference slots
+	one, none := 1, 0
+	cfg.Models = map[string]config.ModelOverrides{
+		"dummy": {MaxConcurrentInferences: &one, MaxQueuedInferences: &none},
+		"same":  {MaxConcurrentInferences: &one, MaxQueuedInferences: &none},
+	}
+	limiter := NewInferenceLimiter(cfg)
+	service.SetInferenceLimiter(limiter)
+	_, releaseSame, _ := limiter.Acquire(context.Background(), "same")
+	result, err = service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "ensemble")
+	if err != nil {
+		t.Fatalf("Expected ensemble to succeed without its busy member, got error: %v", err)
+	}
+	if !strings.Contains(result.Members[1].Error, ErrQueueFull.Error()) || result.Members[0].Error != "" {
+		t.Errorf("Expected only the busy member to be shed, got %+v", result.Members)
+	}
+	_, releaseDummy, _ := limiter.Acquire(context.Background(), "dummy")
+	_, err = service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "ensemble")
+	if !IsOverloaded(err) {
+		t.Errorf("Expected ensemble of busy members to be shed, got: %v", err)
+	}
+	releaseDummy()
+	releaseSame()
+
+	service.modelService.models["nested"] = &LoadedModel{Info: models.ModelInfo{
+		ID: "nested",
+		Ensemble: &models.EnsembleSpec{
+			Strategy: models.EnsembleMax,
+			Members:  []models.EnsembleMember{{ModelID: "ensemble"}},
+		},
+	}}
+	if _, err := service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "nested"); err == nil {
+		t.Error("Expected an ensemble of ensembles to fail")
+	}
+}
+
+func TestCombineEnsemble(t *testing.T) {
+	prediction := func(class string, confidence float64) models.ClassificationResult {
+		return models.ClassificationResult{ClassName: class, Confidence: confidence, Probability: confidence}
+	}
+	members := []models.MemberPrediction{
+		{ModelID: "a", Weight: 1, Predictions: []models.ClassificationResult{prediction("cat", 0.6), prediction("dog", 0.4)}},
+		{ModelID: "b", Weight: 1, Predictions: []models.ClassificationResult{prediction("dog", 0.9), prediction("cat", 0.1)}},
+		{ModelID: "c", Weight: 3, Predictions: []models.ClassificationResult{prediction("cat", 0.7), prediction("dog", 0.3)}},
+		{ModelID: "d", Weight: 10, Error: "member failed"},
+	}
+
+	tests := []struct {
+		strategy   string
+		class      string
+		confidence float64
+	}{
+		{models.EnsembleMeanProbability, "cat", (0.6 + 0.1 + 3*0.7) / 5},
+		{models.EnsembleWeightedVote, "cat", 4.0 / 5},
+		{models.EnsembleMax, "dog", 0.9},
+	}
+
+	for _, tt := range tests {
+		predictions, err := combineEnsemble(tt.strategy, members)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.strategy, err)
+		}
+		if predictions[0].ClassName != tt.class || math.Abs(predictions[0].Confidence-tt.confidence) > 1e-9 {
+			t.Errorf("%s: expected %s at %.4f, got %+v", tt.strategy, tt.class, tt.confidence, predictions[0])
+		}
+	}
+
+	if _, err := combineEnsemble(models.EnsembleMax, members[3:]); err == nil {
+		t.Error("Expected an error when no member produced predictions")
+	}
+}
+
+func TestEnhancedPredictImageRejection(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	dummy, _ := service.modelService.GetModel("dummy")
+	dummy.Info.Rejection = &models.RejectionRules{MinConfidence: 0.99}
+
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "dummy")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	if result.Outcome != models.OutcomeUnknown || result.Rejection == nil || result.Rejection.Reason != models.RejectLowConfidence {
+		t.Fatalf("Expected an unknown outcome for low confidence, got %q with %+v", result.Outcome, result.Rejection)
+	}
+	if len(result.Predictions) == 0 {
+		t.Error("Expected a rejected result to keep its predictions")
+	}
+
+	// Rules sent with the request replace the model's
+	ctx := WithRejectionRules(context.Background(), &models.RejectionRules{})
+	result, err = service.PredictImage(ctx, []byte("image-bytes"), &models.ImageMetadata{}, "dummy")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	if result.Outcome != models.OutcomeClassified || result.Rejection != nil {
+		t.Errorf("Expected request rules to accept the prediction, got %q with %+v", result.Outcome, result.Rejection)
+	}
+
+	health := service.modelService.GetModelStatus().Models["dummy"]
+	if health.Unknown != 1 || health.Predictions != 2 {
+		t.Errorf("Expected 1 unknown of 2 predictions in model stats, got %+v", health)
+	}
+}
+
+func TestEvaluateRejection(t *testing.T) {
+	predictions := func(confidences ...float64) []models.ClassificationResult {
+		var results []models.ClassificationResult
+		for i, confidence := range confidences {
+			results = append(results, models.ClassificationResult{ClassName: fmt.Sprintf("class%d", i), Confidence: confidence})
+		}
+		return results
+	}
+
+	tests := []struct {
+		name        string
+		rules       *models.RejectionRules
+		predictions []models.ClassificationResult
+		reason      string
+	}{
+		{"no rules", nil, predictions(0.2, 0.2), ""},
+		{"confident", &models.RejectionRules{MinConfidence: 0.5, MinMargin: 0.3, MaxEntropy: 0.6}, predictions(0.9, 0.05, 0.05), ""},
+		{"low confidence", &models.RejectionRules{MinConfidence: 0.5}, predictions(0.4, 0.3), models.RejectLowConfidence},
+		{"low margin", &models.RejectionRules{MinMargin: 0.2}, predictions(0.5, 0.45), models.RejectLowMargin},
+		{"single class margin", &models.RejectionRules{MinMargin: 0.2}, predictions(0.5), ""},
+		{"high entropy", &models.RejectionRules{MaxEntropy: 0.9}, predictions(0.25, 0.25, 0.25, 0.25), models.RejectHighEntropy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejection := evaluateRejection(tt.rules, tt.predictions)
+			switch {
+			case tt.reason == "" && rejection != nil:
+				t.Errorf("Expected the prediction to be accepted, got %+v", rejection)
+			case tt.reason != "" && (rejection == nil || rejection.Reason != tt.reason):
+				t.Errorf("Expected rejection for %s, got %+v", tt.reason, rejection)
+			}
+		})
+	}
+
+	if err := ValidateRejectionRules(&models.RejectionRules{MaxEntropy: 1.5}); err == nil {
+		t.Error("Expected a threshold above 1 to be invalid")
+	}
+}
+
+func TestEnhancedPredictImageRollup(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	taxonomy, err := NewTaxonomy(map[string]string{
+		"tabby": "cat", "persian_cat": "cat", "beagle": "dog", "cat": "animal", "dog": "animal",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create taxonomy: %v", err)
+	}
+	service.modelService.models["pets"] = &LoadedModel{
+		Info:     models.ModelInfo{ID: "pets", Classes: []string{"tabby", "persian_cat", "beagle", "car"}},
+		Taxonomy: taxonomy,
+	}
+
+	result, err := service.PredictImage(context.Background(), []byte("image-bytes"), &models.ImageMetadata{}, "pets")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	scores := make(map[string]float64)
+	for _, pred := range result.Predictions {
+		scores[pred.ClassName] = pred.Probability
+		if pred.ClassName == "tabby" && fmt.Sprint(pred.Path) != "[animal cat tabby]" {
+			t.Errorf("Expected the taxonomy path with each prediction, got %v", pred.Path)
+		}
+	}
+	if result.RollupDepth != nil {
+		t.Error("Expected no roll-up without a requested depth")
+	}
+
+	depth := 1
+	ctx := WithRollupDepth(context.Background(), &depth)
+	result, err = service.PredictImage(ctx, []byte("image-bytes"), &models.ImageMetadata{}, "pets")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	if result.RollupDepth == nil || *result.RollupDepth != 1 {
+		t.Errorf("Expected the result to report the roll-up depth, got %v", result.RollupDepth)
+	}
+
+	rolled := make(map[string]models.ClassificationResult)
+	for _, pred := range result.Predictions {
+		rolled[pred.ClassName] = pred
+	}
+	if cat := rolled["cat"]; math.Abs(cat.Probability-(scores["tabby"]+scores["persian_cat"])) > 1e-6 ||
+		fmt.Sprint(cat.Path) != "[animal cat]" {
+		t.Errorf("Expected cat to sum tabby and persian_cat, got %+v from %v", cat, scores)
+	}
+	if _, ok := rolled["car"]; !ok || len(result.Predictions) != 3 {
+		t.Errorf("Expected cat, dog and car after roll-up, got %+v", result.Predictions)
+	}
+}
+
+func TestEnhancedSubmitFeedback(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+		},
+	}
+
+	service := newTestEnhancedPredictionService(cfg)
+	ctx := context.Background()
+
+	result, err := service.PredictImage(ctx, []byte("image-bytes"), &models.ImageMetadata{}, "dummy")
+	if err != nil {
+		t.Fatalf("Expected prediction to succeed, got error: %v", err)
+	}
+	predicted := result.Predictions[0].ClassName
+
+	updated, err := service.SubmitFeedback(ctx, result.ID, models.FeedbackRequest{CorrectLabel: "zebra", Comment: " blurry "})
+	if err != nil {
+		t.Fatalf("Expected feedback to be recorded, got error: %v", err)
+	}
+	if updated.Feedback.Rating != models.RatingDown || updated.Feedback.PredictedClass != predicted || updated.Feedback.Comment != "blurry" {
+		t.Errorf("Expected a correction of %s, got %+v", predicted, updated.Feedback)
+	}
+	if stored, _ := service.GetResult(result.ID); stored.Feedback == nil || stored.Feedback.CorrectLabel != "zebra" {
+		t.Errorf("Expected feedback to be stored with the result, got %+v", stored.Feedback)
+	}
+	if result.Feedback != nil {
+		t.Error("Expected the original result to be left unchanged")
+	}
+
+	// New feedback on the same result replaces the earlier one
+	if _, err := service.SubmitFeedback(ctx, result.ID, models.FeedbackRequest{Rating: models.RatingUp}); err != nil {
+		t.Fatalf("Expected feedback to be replaced, got error: %v", err)
+	}
+	health := service.modelService.GetModelStatus().Models["dummy"]
+	if health.Feedback == nil || health.Feedback.Ratings != 1 || health.Feedback.Correct != 1 {
+		t.Fatalf("Expected one correct rating, got %+v", health.Feedback)
+	}
+	if accuracy := health.ClassFeedback[predicted]; accuracy.Accuracy != 1 || accuracy.Lower >= 1 || accuracy.Upper != 1 {
+		t.Errorf("Expected full accuracy with an uncertain lower bound for %s, got %+v", predicted, accuracy)
+	}
+
+	// Concurrent submissions each replace the one before
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		rating := models.RatingUp
+		if i%2 == 0 {
+			rating = models.RatingDown
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.SubmitFeedback(ctx, result.ID, models.FeedbackRequest{Rating: rating})
+		}()
+	}
+	wg.Wait()
+	health = service.modelService.GetModelStatus().Models["dummy"]
+	if health.Feedback == nil || health.Feedback.Ratings != 1 {
+		t.Fatalf("Expected concurrent feedback to count once, got %+v", health.Feedback)
+	}
+
+	if _, err := service.SubmitFeedback(ctx, "pred_missing", models.FeedbackRequest{Rating: models.RatingUp}); !errors.Is(err, ErrResultNotFound) {
+		t.Errorf("Expected ErrResultNotFound, got %v", err)
+	}
+}
+
+func TestNewFeedback(t *testing.T) {
+	result := &models.PredictionResult{Predictions: []models.ClassificationResult{{ClassName: "cat"}, {ClassName: "dog"}}}
+
+	tests := []struct {
+		name    string
+		request models.FeedbackRequest
+		rating  string
+	}{
+		{"thumbs up", models.FeedbackRequest{Rating: models.RatingUp}, models.RatingUp},
+		{"thumbs down", models.FeedbackRequest{Rating: models.RatingDown}, models.RatingDown},
+		{"correction", models.FeedbackRequest{CorrectLabel: "dog"}, models.RatingDown},
+		{"confirmed label", models.FeedbackRequest{CorrectLabel: "cat"}, models.RatingUp},
+		{"down with correction", models.FeedbackRequest{Rating: models.RatingDown, CorrectLabel: "dog"}, models.RatingDown},
+		{"empty", models.FeedbackRequest{Comment: "hmm"}, ""},
+		{"unknown rating", models.FeedbackRequest{Rating: "maybe"}, ""},
+		{"contradiction", models.FeedbackRequest{Rating: models.RatingUp, CorrectLabel: "dog"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feedback, err := newFeedback(result, tt.request)
+			if tt.rating == "" {
+				if !errors.Is(err, ErrInvalidFeedback) {
+					t.Errorf("Expected invalid feedback, got %+v, %v", feedback, err)
+				}
+				return
+			}
+			if err != nil || feedback.Rating != tt.rating || feedback.PredictedClass != "cat" {
+				t.Errorf("Expected rating %s of cat, got %+v, %v", tt.rating, feedback, err)
+			}
+		})
+	}
+
+	accuracy := feedbackAccuracy(8, 2)
+	if accuracy.Accuracy != 0.8 || accuracy.Lower < 0.49 || accuracy.Lower > 0.5 || accuracy.Upper < 0.94 || accuracy.Upper > 0.95 {
+		t.Errorf("Expected 80%% accuracy with a 49-94%% interval, got %+v", accuracy)
+	}
+}
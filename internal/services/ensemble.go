@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// validateEnsemble checks an ensemble definition. Members are resolved
+// when the ensemble runs, since they may be loaded after it.
+func validateEnsemble(spec *models.EnsembleSpec) error {
+	switch spec.Strategy {
+	case models.EnsembleMeanProbability, models.EnsembleWeightedVote, models.EnsembleMax:
+	default:
+		return fmt.Errorf("unknown ensemble strategy: %q", spec.Strategy)
+	}
+
+	if len(spec.Members) == 0 {
+		return errors.New("ensemble has no members")
+	}
+	for _, member := range spec.Members {
+		if member.ModelID == "" || member.Weight < 0 {
+			return fmt.Errorf("invalid ensemble member %q with weight %g", member.ModelID, member.Weight)
+		}
+	}
+	return nil
+}
+
+// ensembleWeight returns the weight of a member, counting an unset weight as 1
+func ensembleWeight(member models.EnsembleMember) float64 {
+	if member.Weight == 0 {
+		return 1
+	}
+	return member.Weight
+}
+
+// runEnsemble runs the members of an ensemble concurrently on the shared
+// input and combines their predictions. Each member waits for its own
+// inference slot, so an ensemble is held to its members' concurrency
+// limits. Members that fail are reported in the breakdown and left out of
+// the combination; the ensemble fails only when every member does.
+func (s *EnhancedPredictionService) runEnsemble(ctx context.Context, input *inferenceInput, model *LoadedModel) (*inferenceOutcome, error) {
+	spec := model.Info.Ensemble
+	members := make([]models.MemberPrediction, len(spec.Members))
+	errs := make([]error, len(spec.Members))
+
+	var wg sync.WaitGroup
+	for i, member := range spec.Members {
+		members[i] = models.MemberPrediction{ModelID: member.ModelID, Weight: ensembleWeight(member)}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			memberModel, err := s.modelService.GetModel(member.ModelID)
+			if err == nil && memberModel.Info.Ensemble != nil {
+				err = fmt.Errorf("member %s is an ensemble; ensembles cannot be nested", member.ModelID)
+			}
+			var outcome *inferenceOutcome
+			if err == nil {
+				outcome, err = s.runMember(ctx, input, memberModel)
+			}
+			if err != nil {
+				errs[i] = err
+				members[i].Error = err.Error()
+				return
+			}
+			members[i].Engine = outcome.engine
+			members[i].Predictions = outcome.predictions
+		}()
+	}
+	wg.Wait()
+
+	predictions, err := combineEnsemble(spec.Strategy, members)
+	if err != nil {
+		// Shed the request as a whole when busy members are why it failed
+		for _, memberErr := range errs {
+			if IsOverloaded(memberErr) {
+				return nil, fmt.Errorf("ensemble %s: %w", model.Info.ID, memberErr)
+			}
+		}
+		return nil, fmt.Errorf("ensemble %s: %w", model.Info.ID, err)
+	}
+
+	return &inferenceOutcome{
+		predictions: predictions,
+		model:       model,
+		engine:      metrics.EngineEnsemble,
+		members:     members,
+	}, nil
+}
+
+// runMember runs one ensemble member while holding its inference slot
+func (s *EnhancedPredictionService) runMember(ctx context.Context, input *inferenceInput, memberModel *LoadedModel) (*inferenceOutcome, error) {
+	ctx, release, err := s.limiter.Acquire(ctx, memberModel.Info.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.runPrimaryEngine(ctx, input, memberModel)
+}
+
+// classScore accumulates one class across ensemble members
+type classScore struct {
+	result models.ClassificationResult
+	// votes is the weight of members ranking the class first; tiebreak is
+	// its weighted probability, which orders classes with equal votes
+	votes    float64
+	tiebreak float64
+}
+
+// combineEnsemble combines the predictions of the members that succeeded
+// using strategy, returning the top 5 classes
+func combineEnsemble(strategy string, members []models.MemberPrediction) ([]models.ClassificationResult, error) {
+	scores := make(map[string]*classScore)
+	totalWeight := 0.0
+	var failures []string
+
+	for _, member := range members {
+		if member.Error != "" {
+			failures = append(failures, member.ModelID+": "+member.Error)
+			continue
+		}
+		if len(member.Predictions) == 0 {
+			continue
+		}
+		totalWeight += member.Weight
+
+		for rank, pred := range member.Predictions {
+			score, ok := scores[pred.ClassName]
+			if !ok {
+				score = &classScore{result: models.ClassificationResult{
+					ClassName:   pred.ClassName,
+					Label:       pred.Label,
+					Description: pred.Description,
+					Path:        pred.Path,
+					Synonyms:    pred.Synonyms,
+					ExternalIDs: pred.ExternalIDs,
+				}}
+				scores[pred.ClassName] = score
+			}
+
+			switch strategy {
+			case models.EnsembleMeanProbability:
+				score.result.Confidence += member.Weight * pred.Confidence
+				score.result.Probability += member.Weight * pred.Probability
+				score.result.RawConfidence += member.Weight * pred.RawConfidence
+			case models.EnsembleMax:
+				score.result.Confidence = max(score.result.Confidence, pred.Confidence)
+				score.result.Probability = max(score.result.Probability, pred.Probability)
+				score.result.RawConfidence = max(score.result.RawConfidence, pred.RawConfidence)
+			case models.EnsembleWeightedVote:
+				if rank == 0 {
+					score.votes += member.Weight
+				}
+				score.tiebreak += member.Weight * pred.Probability
+			}
+		}
+	}
+
+	if totalWeight == 0 {
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("no member produced predictions (%s)", strings.Join(failures, "; "))
+		}
+		return nil, errors.New("no member produced predictions")
+	}
+
+	var combined []*classScore
+	for _, score := range scores {
+		switch strategy {
+		case models.EnsembleMeanProbability:
+			score.result.Confidence /= totalWeight
+			score.result.Probability /= totalWeight
+			score.result.RawConfidence /= totalWeight
+		case models.EnsembleWeightedVote:
+			// Only classes some member ranked first take part in the vote
+			if score.votes == 0 {
+				continue
+			}
+			score.result.Confidence = score.votes / totalWeight
+			score.result.Probability = score.votes / totalWeight
+			score.result.RawConfidence = score.votes / totalWeight
+		}
+		combined = append(combined, score)
+	}
+
+	sort.Slice(combined, func(i, j int) bool {
+		a, b := combined[i], combined[j]
+		if a.result.Confidence != b.result.Confidence {
+			return a.result.Confidence > b.result.Confidence
+		}
+		if a.tiebreak != b.tiebreak {
+			return a.tiebreak > b.tiebreak
+		}
+		return a.result.ClassName < b.result.ClassName
+	})
+
+	predictions := make([]models.ClassificationResult, 0, 5)
+	for _, score := range combined {
+		if len(predictions) == 5 {
+			break
+		}
+		predictions = append(predictions, score.result)
+	}
+	return predictions, nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInferenceTimeout is returned when inference does not finish within
+// the model's configured deadline
+var ErrInferenceTimeout = errors.New("inference deadline exceeded")
+
+// ErrBlobNotFound is returned when a blob key does not exist in the store
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrResultNotFound is returned for prediction results that are neither
+// kept in memory nor archived
+var ErrResultNotFound = errors.New("result not found")
+
+// ErrInvalidSignature is returned for signed URLs whose signature does not
+// match their path and expiry
+var ErrInvalidSignature = errors.New("invalid URL signature")
+
+// ErrURLExpired is returned for signed URLs past their expiry
+var ErrURLExpired = errors.New("signed URL has expired")
+
+// inferenceError converts a context error raised during inference into the
+// error reported to callers. Deadline expiry becomes ErrInferenceTimeout so
+// it can be told apart from the client going away (context.Canceled).
+func inferenceError(ctx context.Context, modelID string, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: model %s did not finish within %v", ErrInferenceTimeout, modelID, timeout)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("inference canceled: %w", context.Canceled)
+	}
+	return err
+}
@@ -0,0 +1,482 @@
+package services
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidExport is returned for export requests that cannot be run
+var ErrInvalidExport = errors.New("invalid export")
+
+// defaultExportMinConfidence is the confidence a prediction needs to be
+// exported as a label when nobody reviewed it
+const defaultExportMinConfidence = 0.9
+
+// ExportService packages stored images and their labels as training
+// datasets. Labels come from feedback where there is any, so corrections
+// flow back into retraining, and otherwise from confident predictions.
+type ExportService struct {
+	store  BlobStore
+	logger *logrus.Logger
+}
+
+// NewExportService creates an export service reading stored images and
+// archived results from store
+func NewExportService(store BlobStore, logger *logrus.Logger) *ExportService {
+	return &ExportService{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// ValidateExportRequest checks an export request and fills in defaults
+func ValidateExportRequest(req *models.ExportRequest) error {
+	switch req.Format {
+	case models.ExportFormatImageNet, models.ExportFormatCSV, models.ExportFormatJSONL, models.ExportFormatCOCO:
+	default:
+		return fmt.Errorf("%w: format must be one of %s, %s, %s or %s", ErrInvalidExport,
+			models.ExportFormatImageNet, models.ExportFormatCSV, models.ExportFormatJSONL, models.ExportFormatCOCO)
+	}
+
+	switch req.Feedback {
+	case "":
+		req.Feedback = models.ExportFeedbackAny
+	case models.ExportFeedbackAny, models.ExportFeedbackReviewed, models.ExportFeedbackCorrected,
+		models.ExportFeedbackConfirmed, models.ExportFeedbackUnreviewed:
+	default:
+		return fmt.Errorf("%w: unknown feedback filter %q", ErrInvalidExport, req.Feedback)
+	}
+
+	if req.MinConfidence < 0 || req.MinConfidence > 1 {
+		return fmt.Errorf("%w: min_confidence must be between 0 and 1", ErrInvalidExport)
+	}
+	if req.MinConfidence == 0 {
+		req.MinConfidence = defaultExportMinConfidence
+	}
+	if !req.Since.IsZero() && !req.Until.IsZero() && !req.Until.After(req.Since) {
+		return fmt.Errorf("%w: until must be after since", ErrInvalidExport)
+	}
+	if req.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidExport)
+	}
+	return nil
+}
+
+// Select returns the stored images matching a validated request, one per
+// image, oldest first. An image with several results is labeled by the
+// latest reviewed one, or the latest prediction if none was reviewed.
+func (s *ExportService) Select(ctx context.Context, req models.ExportRequest) ([]models.ExportItem, error) {
+	keys, err := s.store.List(ctx, resultsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]bool, len(req.Labels))
+	for _, label := range req.Labels {
+		labels[label] = true
+	}
+
+	selected := make(map[string]models.ExportItem)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := loadResult(ctx, s.store, key)
+		if err != nil {
+			s.logger.Warnf("Skipping unreadable result %s: %v", key, err)
+			continue
+		}
+		if result.Metadata.ImageKey == "" || len(result.Predictions) == 0 ||
+			(req.ModelID != "" && result.ModelInfo.ID != req.ModelID) ||
+			(!req.Since.IsZero() && result.ProcessedAt.Before(req.Since)) ||
+			(!req.Until.IsZero() && !result.ProcessedAt.Before(req.Until)) {
+			continue
+		}
+
+		item, ok := exportItem(result, req.MinConfidence)
+		if !ok || !matchesFeedbackFilter(item.LabelSource, req.Feedback) ||
+			(len(labels) > 0 && !labels[item.Label]) {
+			continue
+		}
+
+		if current, ok := selected[item.ImageKey]; ok && !preferExportItem(item, current) {
+			continue
+		}
+		selected[item.ImageKey] = item
+	}
+
+	items := make([]models.ExportItem, 0, len(selected))
+	for _, item := range selected {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].ProcessedAt.Equal(items[j].ProcessedAt) {
+			return items[i].ProcessedAt.Before(items[j].ProcessedAt)
+		}
+		return items[i].ResultID < items[j].ResultID
+	})
+	if req.Limit > 0 && len(items) > req.Limit {
+		items = items[:req.Limit]
+	}
+
+	dirs := exportDirNames(items)
+	for i := range items {
+		items[i].Path = exportPath(req.Format, dirs[items[i].Label], items[i])
+	}
+	return items, nil
+}
+
+// exportItem labels a result by its feedback, or by its top prediction if
+// that is confident enough. Results marked wrong without a correction and
+// predictions rejected as unknown have no usable label.
+func exportItem(result *models.PredictionResult, minConfidence float64) (models.ExportItem, bool) {
+	top := result.Predictions[0]
+	item := models.ExportItem{
+		ResultID:       result.ID,
+		ImageKey:       result.Metadata.ImageKey,
+		PredictedClass: top.ClassName,
+		Confidence:     top.Confidence,
+		ModelID:        result.ModelInfo.ID,
+		Width:          result.Metadata.Width,
+		Height:         result.Metadata.Height,
+		ProcessedAt:    result.ProcessedAt,
+	}
+
+	switch feedback := result.Feedback; {
+	case feedback != nil && feedback.CorrectLabel != "":
+		item.Label = feedback.CorrectLabel
+		item.LabelSource = models.LabelSourceCorrected
+		if feedback.Rating == models.RatingUp {
+			item.LabelSource = models.LabelSourceConfirmed
+		}
+	case feedback != nil && feedback.Rating == models.RatingUp:
+		item.Label = feedback.PredictedClass
+		item.LabelSource = models.LabelSourceConfirmed
+	case feedback != nil:
+		return item, false
+	case result.Outcome == models.OutcomeUnknown || top.Confidence < minConfidence:
+		return item, false
+	default:
+		item.Label = top.ClassName
+		item.LabelSource = models.LabelSourcePredicted
+	}
+	return item, true
+}
+
+// matchesFeedbackFilter reports whether a label source passes the
+// request's feedback filter
+func matchesFeedbackFilter(source, filter string) bool {
+	switch filter {
+	case models.ExportFeedbackReviewed:
+		return source != models.LabelSourcePredicted
+	case models.ExportFeedbackCorrected, models.ExportFeedbackConfirmed:
+		return source == filter
+	case models.ExportFeedbackUnreviewed:
+		return source == models.LabelSourcePredicted
+	default:
+		return true
+	}
+}
+
+// preferExportItem reports whether item should label an image instead of
+// current: reviewed labels win over predictions, then later results win
+func preferExportItem(item, current models.ExportItem) bool {
+	reviewed := item.LabelSource != models.LabelSourcePredicted
+	currentReviewed := current.LabelSource != models.LabelSourcePredicted
+	if reviewed != currentReviewed {
+		return reviewed
+	}
+	return item.ProcessedAt.After(current.ProcessedAt)
+}
+
+// exportPath returns where an image is written in the archive: dir, the
+// folder of its label, for the ImageNet layout, a flat images folder
+// otherwise
+func exportPath(format, dir string, item models.ExportItem) string {
+	name := path.Base(item.ImageKey)
+	if format == models.ExportFormatImageNet {
+		return dir + "/" + name
+	}
+	return "images/" + name
+}
+
+// exportDirNames assigns each label of items its own directory name. Labels
+// that map to the same name, such as "a b" and "a_b", are told apart by a
+// numeric suffix in label order.
+func exportDirNames(items []models.ExportItem) map[string]string {
+	labels := make([]string, 0, len(items))
+	dirs := make(map[string]string)
+	for _, item := range items {
+		if _, ok := dirs[item.Label]; !ok {
+			dirs[item.Label] = ""
+			labels = append(labels, item.Label)
+		}
+	}
+	sort.Strings(labels)
+
+	used := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		base := exportDirName(label)
+		name := base
+		for n := 2; used[name]; n++ {
+			name = base + "_" + strconv.Itoa(n)
+		}
+		used[name] = true
+		dirs[label] = name
+	}
+	return dirs
+}
+
+// exportDirName turns a label into a safe directory name
+func exportDirName(label string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, label)
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// WriteArchive writes the selected images and a manifest in format to w as
+// a tar archive. Images that have since been removed from the blob store
+// are left out and counted as missing.
+func (s *ExportService) WriteArchive(ctx context.Context, w io.Writer, format string, items []models.ExportItem) (*models.ExportSummary, error) {
+	tw := tar.NewWriter(w)
+	summary := &models.ExportSummary{Format: format, Labels: make(map[string]int)}
+	now := time.Now()
+
+	written := make([]models.ExportItem, 0, len(items))
+	for _, item := range items {
+		data, err := s.store.Get(ctx, item.ImageKey)
+		if errors.Is(err, ErrBlobNotFound) {
+			s.logger.Warnf("Skipping missing image %s of result %s", item.ImageKey, item.ResultID)
+			summary.Missing++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := writeTarFile(tw, item.Path, data, item.ProcessedAt); err != nil {
+			return nil, err
+		}
+		written = append(written, item)
+		summary.Images++
+		summary.Labels[item.Label]++
+	}
+
+	var manifest []byte
+	var manifestName string
+	var err error
+	switch format {
+	case models.ExportFormatImageNet:
+		manifestName, manifest = "labels.txt", imageNetLabels(written)
+	case models.ExportFormatCSV:
+		manifestName = "manifest.csv"
+		manifest, err = csvManifest(written)
+	case models.ExportFormatJSONL:
+		manifestName = "manifest.jsonl"
+		manifest, err = jsonlManifest(written)
+	case models.ExportFormatCOCO:
+		manifestName = "annotations.json"
+		manifest, err = cocoManifest(written, now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s: %w", manifestName, err)
+	}
+	if err := writeTarFile(tw, manifestName, manifest, now); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return summary, nil
+}
+
+// writeTarFile adds a regular file to a tar archive
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// imageNetLabels lists the exported labels, one per line, with the
+// directory holding their images
+func imageNetLabels(items []models.ExportItem) []byte {
+	dirs := make(map[string]string)
+	labels := make([]string, 0)
+	for _, item := range items {
+		if _, ok := dirs[item.Label]; !ok {
+			dirs[item.Label] = path.Dir(item.Path)
+			labels = append(labels, item.Label)
+		}
+	}
+	sort.Strings(labels)
+
+	var b strings.Builder
+	for _, label := range labels {
+		fmt.Fprintf(&b, "%s\t%s\n", dirs[label], label)
+	}
+	return []byte(b.String())
+}
+
+// csvManifest lists the exported images as CSV
+func csvManifest(items []models.ExportItem) ([]byte, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write([]string{"path", "label", "label_source", "predicted_class", "confidence",
+		"model_id", "result_id", "width", "height", "processed_at"}); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := w.Write([]string{
+			CSVSafe(item.Path), CSVSafe(item.Label), item.LabelSource, CSVSafe(item.PredictedClass),
+			strconv.FormatFloat(item.Confidence, 'f', 6, 64),
+			CSVSafe(item.ModelID), CSVSafe(item.ResultID),
+			strconv.Itoa(item.Width), strconv.Itoa(item.Height),
+			item.ProcessedAt.UTC().Format(time.RFC3339),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return []byte(b.String()), w.Error()
+}
+
+// CSVSafe keeps user-supplied text, such as filenames, label set labels
+// and feedback corrections, from being read as a spreadsheet formula
+func CSVSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// jsonlManifest lists the exported images as JSON lines
+func jsonlManifest(items []models.ExportItem) ([]byte, error) {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// cocoDataset is the subset of the COCO format an export fills in
+type cocoDataset struct {
+	Info        cocoInfo         `json:"info"`
+	Images      []cocoImage      `json:"images"`
+	Categories  []cocoCategory   `json:"categories"`
+	Annotations []cocoAnnotation `json:"annotations"`
+}
+
+type cocoInfo struct {
+	Description string `json:"description"`
+	DateCreated string `json:"date_created"`
+}
+
+type cocoImage struct {
+	ID           int    `json:"id"`
+	FileName     string `json:"file_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	DateCaptured string `json:"date_captured"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// cocoAnnotation labels a whole image. The models served here classify
+// images, so annotations carry no bounding box or segmentation.
+type cocoAnnotation struct {
+	ID          int     `json:"id"`
+	ImageID     int     `json:"image_id"`
+	CategoryID  int     `json:"category_id"`
+	Score       float64 `json:"score,omitempty"`
+	LabelSource string  `json:"label_source"`
+}
+
+// cocoManifest describes the exported images in COCO JSON, with one
+// category per label and one image-level annotation per image
+func cocoManifest(items []models.ExportItem, created time.Time) ([]byte, error) {
+	dataset := cocoDataset{
+		Info: cocoInfo{
+			Description: "Image recognition dataset export",
+			DateCreated: created.UTC().Format(time.RFC3339),
+		},
+		Images:      make([]cocoImage, 0, len(items)),
+		Categories:  []cocoCategory{},
+		Annotations: make([]cocoAnnotation, 0, len(items)),
+	}
+
+	var labels []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			labels = append(labels, item.Label)
+		}
+	}
+	sort.Strings(labels)
+	categories := make(map[string]int, len(labels))
+	for i, label := range labels {
+		categories[label] = i + 1
+		dataset.Categories = append(dataset.Categories, cocoCategory{ID: i + 1, Name: label})
+	}
+
+	for i, item := range items {
+		dataset.Images = append(dataset.Images, cocoImage{
+			ID:           i + 1,
+			FileName:     item.Path,
+			Width:        item.Width,
+			Height:       item.Height,
+			DateCaptured: item.ProcessedAt.UTC().Format(time.RFC3339),
+		})
+		annotation := cocoAnnotation{
+			ID:          i + 1,
+			ImageID:     i + 1,
+			CategoryID:  categories[item.Label],
+			LabelSource: item.LabelSource,
+		}
+		if item.LabelSource == models.LabelSourcePredicted {
+			annotation.Score = item.Confidence
+		}
+		dataset.Annotations = append(dataset.Annotations, annotation)
+	}
+
+	return json.MarshalIndent(dataset, "", "  ")
+}
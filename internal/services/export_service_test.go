@@ -0,0 +1,246 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// readTar returns the files of a tar archive by name
+func readTar(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", header.Name, err)
+		}
+		files[header.Name] = string(content)
+	}
+}
+
+func TestExportService(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	archive := func(id, image, modelID, class string, confidence float64, age time.Duration, feedback *models.Feedback) {
+		key := ContentKey("originals", []byte(image), ".png")
+		if err := store.Put(ctx, key, []byte(image), "image/png"); err != nil {
+			t.Fatalf("Failed to store image: %v", err)
+		}
+		data, _ := json.Marshal(&models.PredictionResult{
+			ID:          id,
+			Predictions: []models.ClassificationResult{{ClassName: class, Confidence: confidence}},
+			ModelInfo:   models.ModelInfo{ID: modelID},
+			Metadata:    models.ImageMetadata{Filename: image + ".png", ImageKey: key, Width: 64, Height: 48},
+			ProcessedAt: start.Add(age),
+			Feedback:    feedback,
+		})
+		if err := store.Put(ctx, ResultKey(id), data, "application/json"); err != nil {
+			t.Fatalf("Failed to archive result: %v", err)
+		}
+	}
+	archive("pred_a1", "a", "dummy", "cat", 0.95, 0, nil)
+	archive("pred_a2", "a", "dummy", "cat", 0.97, time.Hour, nil) // later result of the same image
+	archive("pred_b1", "b", "dummy", "cat", 0.6, 2*time.Hour,
+		&models.Feedback{Rating: models.RatingDown, PredictedClass: "cat", CorrectLabel: "lynx"})
+	archive("pred_b2", "b", "dummy", "dog", 0.99, 3*time.Hour, nil) // reviewed result wins
+	archive("pred_c1", "c", "dummy", "dog", 0.5, 4*time.Hour,
+		&models.Feedback{Rating: models.RatingUp, PredictedClass: "dog"})
+	archive("pred_d1", "d", "dummy", "cat", 0.5, 5*time.Hour, nil) // not confident enough
+	archive("pred_e1", "e", "dummy", "cat", 0.99, 6*time.Hour,
+		&models.Feedback{Rating: models.RatingDown, PredictedClass: "cat"}) // wrong without a label
+	archive("pred_f1", "f", "other", "bird", 0.99, 7*time.Hour, nil)
+
+	service := NewExportService(store, logger)
+	selectItems := func(req models.ExportRequest) []models.ExportItem {
+		t.Helper()
+		if req.Format == "" {
+			req.Format = models.ExportFormatCSV
+		}
+		if err := ValidateExportRequest(&req); err != nil {
+			t.Fatalf("Expected valid request, got error: %v", err)
+		}
+		items, err := service.Select(ctx, req)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return items
+	}
+	resultIDs := func(items []models.ExportItem) string {
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ResultID
+		}
+		return strings.Join(ids, ",")
+	}
+
+	items := selectItems(models.ExportRequest{})
+	if got := resultIDs(items); got != "pred_a2,pred_b1,pred_c1,pred_f1" {
+		t.Fatalf("Expected one labeled result per image, got %s", got)
+	}
+	if items[1].Label != "lynx" || items[1].LabelSource != models.LabelSourceCorrected {
+		t.Errorf("Expected corrected label, got %+v", items[1])
+	}
+	if items[2].Label != "dog" || items[2].LabelSource != models.LabelSourceConfirmed {
+		t.Errorf("Expected confirmed label, got %+v", items[2])
+	}
+
+	filters := []struct {
+		name    string
+		request models.ExportRequest
+		want    string
+	}{
+		{"model", models.ExportRequest{ModelID: "other"}, "pred_f1"},
+		{"label", models.ExportRequest{Labels: []string{"cat", "lynx"}}, "pred_a2,pred_b1"},
+		{"since", models.ExportRequest{Since: start.Add(3 * time.Hour)}, "pred_b2,pred_c1,pred_f1"},
+		{"until", models.ExportRequest{Until: start.Add(time.Hour)}, "pred_a1"},
+		{"min confidence", models.ExportRequest{MinConfidence: 0.4}, "pred_a2,pred_b1,pred_c1,pred_d1,pred_f1"},
+		{"reviewed", models.ExportRequest{Feedback: models.ExportFeedbackReviewed}, "pred_b1,pred_c1"},
+		{"corrected", models.ExportRequest{Feedback: models.ExportFeedbackCorrected}, "pred_b1"},
+		{"unreviewed", models.ExportRequest{Feedback: models.ExportFeedbackUnreviewed}, "pred_a2,pred_b2,pred_f1"},
+		{"limit", models.ExportRequest{Limit: 2}, "pred_a2,pred_b1"},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultIDs(selectItems(tt.request)); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// ImageNet layout puts images in a folder per label
+	items = selectItems(models.ExportRequest{Format: models.ExportFormatImageNet})
+	var buf bytes.Buffer
+	summary, err := service.WriteArchive(ctx, &buf, models.ExportFormatImageNet, items)
+	if err != nil {
+		t.Fatalf("Expected archive to be written, got error: %v", err)
+	}
+	if summary.Images != 4 || summary.Labels["cat"] != 1 || summary.Labels["lynx"] != 1 {
+		t.Errorf("Expected 4 images across labels, got %+v", summary)
+	}
+	files := readTar(t, buf.Bytes())
+	for _, item := range items {
+		if !strings.HasPrefix(item.Path, item.Label+"/") || files[item.Path] == "" {
+			t.Errorf("Expected %s in its label folder, got %s", item.ResultID, item.Path)
+		}
+	}
+	if files["labels.txt"] != "bird\tbird\ncat\tcat\ndog\tdog\nlynx\tlynx\n" {
+		t.Errorf("Unexpected labels.txt: %q", files["labels.txt"])
+	}
+
+	// Images removed from the store are counted as missing
+	items = selectItems(models.ExportRequest{Format: models.ExportFormatCOCO})
+	if err := store.Delete(ctx, items[0].ImageKey); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+	buf.Reset()
+	summary, err = service.WriteArchive(ctx, &buf, models.ExportFormatCOCO, items)
+	if err != nil {
+		t.Fatalf("Expected archive to be written, got error: %v", err)
+	}
+	if summary.Images != 3 || summary.Missing != 1 {
+		t.Errorf("Expected 3 images and 1 missing, got %+v", summary)
+	}
+
+	var coco cocoDataset
+	if err := json.Unmarshal([]byte(readTar(t, buf.Bytes())["annotations.json"]), &coco); err != nil {
+		t.Fatalf("Expected COCO annotations, got error: %v", err)
+	}
+	if len(coco.Images) != 3 || len(coco.Annotations) != 3 || len(coco.Categories) != 3 {
+		t.Fatalf("Expected 3 images, annotations and categories, got %+v", coco)
+	}
+	if coco.Images[0].FileName != items[1].Path || coco.Images[0].Width != 64 {
+		t.Errorf("Expected image entry for %s, got %+v", items[1].Path, coco.Images[0])
+	}
+	if name := coco.Categories[coco.Annotations[0].CategoryID-1].Name; name != "lynx" {
+		t.Errorf("Expected first annotation to be lynx, got %s", name)
+	}
+}
+
+func TestExportDirNames(t *testing.T) {
+	var items []models.ExportItem
+	for _, label := range []string{"a_b", "a b", "a_b", "a/b", "a_b_2", "cat"} {
+		items = append(items, models.ExportItem{Label: label})
+	}
+
+	dirs := exportDirNames(items)
+	want := map[string]string{"a b": "a_b", "a/b": "a_b_2", "a_b": "a_b_3", "a_b_2": "a_b_2_2", "cat": "cat"}
+	for label, dir := range want {
+		if dirs[label] != dir {
+			t.Errorf("Expected %q in %q, got %q", label, dir, dirs[label])
+		}
+	}
+	if len(dirs) != len(want) {
+		t.Errorf("Expected one directory per label, got %v", dirs)
+	}
+}
+
+func TestCSVManifestEscapesFormulas(t *testing.T) {
+	manifest, err := csvManifest([]models.ExportItem{{
+		Path:           "images/a.png",
+		Label:          "=HYPERLINK(\"http://example.com\")",
+		PredictedClass: "cat",
+		ResultID:       "pred_1",
+	}})
+	if err != nil {
+		t.Fatalf("Expected manifest, got error: %v", err)
+	}
+	if !strings.Contains(string(manifest), `images/a.png,"'=HYPERLINK(""http://example.com"")",`) {
+		t.Errorf("Expected the label to be escaped, got %q", manifest)
+	}
+}
+
+func TestValidateExportRequest(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		request models.ExportRequest
+	}{
+		{"unknown format", models.ExportRequest{Format: "zip"}},
+		{"unknown feedback", models.ExportRequest{Format: models.ExportFormatCSV, Feedback: "maybe"}},
+		{"confidence above 1", models.ExportRequest{Format: models.ExportFormatCSV, MinConfidence: 1.5}},
+		{"until before since", models.ExportRequest{Format: models.ExportFormatCSV, Since: now, Until: now.Add(-time.Hour)}},
+		{"negative limit", models.ExportRequest{Format: models.ExportFormatCSV, Limit: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateExportRequest(&tt.request); !errors.Is(err, ErrInvalidExport) {
+				t.Errorf("Expected ErrInvalidExport, got %v", err)
+			}
+		})
+	}
+
+	request := models.ExportRequest{Format: models.ExportFormatJSONL}
+	if err := ValidateExportRequest(&request); err != nil {
+		t.Fatalf("Expected valid request, got error: %v", err)
+	}
+	if request.Feedback != models.ExportFeedbackAny || request.MinConfidence != defaultExportMinConfidence {
+		t.Errorf("Expected defaults to be filled in, got %+v", request)
+	}
+}
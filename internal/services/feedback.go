@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// ErrInvalidFeedback is returned for feedback that cannot apply to a result
+var ErrInvalidFeedback = errors.New("invalid feedback")
+
+const (
+	// maxFeedbackComment bounds the free-text comment of feedback
+	maxFeedbackComment = 1000
+
+	// feedbackZ is the normal quantile of the 95% accuracy interval
+	feedbackZ = 1.96
+)
+
+// newFeedback checks a feedback request against the top prediction of a
+// result. A correct label that matches the top prediction is a thumbs up,
+// any other label a thumbs down.
+func newFeedback(result *models.PredictionResult, request models.FeedbackRequest) (*models.Feedback, error) {
+	if len(result.Predictions) == 0 {
+		return nil, fmt.Errorf("%w: result has no predictions", ErrInvalidFeedback)
+	}
+
+	feedback := &models.Feedback{
+		PredictedClass: result.Predictions[0].ClassName,
+		CorrectLabel:   strings.TrimSpace(request.CorrectLabel),
+		Comment:        strings.TrimSpace(request.Comment),
+		SubmittedAt:    time.Now(),
+	}
+	if len(feedback.CorrectLabel) > maxLabelLength {
+		return nil, fmt.Errorf("%w: correct_label exceeds %d characters", ErrInvalidFeedback, maxLabelLength)
+	}
+	if len(feedback.Comment) > maxFeedbackComment {
+		return nil, fmt.Errorf("%w: comment exceeds %d characters", ErrInvalidFeedback, maxFeedbackComment)
+	}
+
+	implied := ""
+	if feedback.CorrectLabel != "" {
+		implied = models.RatingDown
+		if feedback.CorrectLabel == feedback.PredictedClass {
+			implied = models.RatingUp
+		}
+	}
+
+	switch request.Rating {
+	case "":
+		if implied == "" {
+			return nil, fmt.Errorf("%w: rating or correct_label is required", ErrInvalidFeedback)
+		}
+		feedback.Rating = implied
+	case models.RatingUp, models.RatingDown:
+		if implied != "" && implied != request.Rating {
+			return nil, fmt.Errorf("%w: rating %q contradicts correct_label %q for predicted class %q",
+				ErrInvalidFeedback, request.Rating, feedback.CorrectLabel, feedback.PredictedClass)
+		}
+		feedback.Rating = request.Rating
+	default:
+		return nil, fmt.Errorf("%w: rating must be %q or %q", ErrInvalidFeedback, models.RatingUp, models.RatingDown)
+	}
+
+	return feedback, nil
+}
+
+// feedbackCounts tallies the feedback on predictions of one class
+type feedbackCounts struct {
+	correct   int64
+	incorrect int64
+}
+
+// add counts a feedback rating, or removes it when delta is -1. Without a
+// blob store, counts of feedback given before a restart are not known, so
+// they never go negative.
+func (c *feedbackCounts) add(rating string, delta int64) {
+	count := &c.incorrect
+	if rating == models.RatingUp {
+		count = &c.correct
+	}
+	*count = max(*count+delta, 0)
+}
+
+// feedbackAccuracy estimates accuracy from feedback counts with a Wilson
+// score interval, which stays meaningful for the few ratings most classes
+// get
+func feedbackAccuracy(correct, incorrect int64) models.FeedbackAccuracy {
+	accuracy := models.FeedbackAccuracy{Ratings: correct + incorrect, Correct: correct}
+	if accuracy.Ratings == 0 {
+		return accuracy
+	}
+
+	n := float64(accuracy.Ratings)
+	p := float64(correct) / n
+	z2 := feedbackZ * feedbackZ
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := feedbackZ / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+
+	accuracy.Accuracy = p
+	accuracy.Lower = math.Max(0, center-margin)
+	accuracy.Upper = math.Min(1, center+margin)
+	return accuracy
+}
@@ -4,153 +4,327 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
 	"github.com/sirupsen/logrus"
 )
 
-// FileManager handles file operations and cleanup
+// Managed directory names used in stats and metrics
+const (
+	DirTemp    = "temp"
+	DirUploads = "uploads"
+)
+
+// Cleanup removal reasons
+const (
+	removalExpired = "expired"
+	removalEvicted = "evicted"
+)
+
+// FileManager owns the temp and upload directories and enforces their
+// retention: files past their directory's retention age are removed, and
+// if the total still exceeds the disk usage cap the oldest files are
+// evicted first. In dry-run mode cleanup only logs what it would remove.
 type FileManager struct {
-	config      *config.Config
-	logger      *logrus.Logger
-	tempDir     string
-	uploadsDir  string
-	cleanupAge  time.Duration
-}
-
-// NewFileManager creates a new file manager
-func NewFileManager(cfg *config.Config) (*FileManager, error) {
-	tempDir := "./temp"
-	uploadsDir := "./uploads"
-	cleanupAge := 24 * time.Hour // Default: clean files older than 24 hours
-
-	// Create directories if they don't exist
-	if err := os.MkdirAll(tempDir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	if err := os.MkdirAll(uploadsDir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create uploads directory: %w", err)
-	}
+	logger   *logrus.Logger
+	interval time.Duration
 
-	return &FileManager{
-		config:     cfg,
-		logger:     logrus.New(),
-		tempDir:    tempDir,
-		uploadsDir: uploadsDir,
-		cleanupAge: cleanupAge,
-	}, nil
-}
+	mu           sync.RWMutex
+	policies     []retentionPolicy
+	maxDiskUsage int64
+	dryRun       bool
+	stats        models.StorageStats
 
-// SetCleanupAge sets the age threshold for cleanup
-func (fm *FileManager) SetCleanupAge(age time.Duration) {
-	fm.cleanupAge = age
-}
+	// runMu serializes cleanup passes
+	runMu sync.Mutex
 
-// CleanupTempFiles removes old temporary files
-func (fm *FileManager) CleanupTempFiles() error {
-	return fm.cleanupDirectory(fm.tempDir)
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-// CleanupUploads removes old uploaded files
-func (fm *FileManager) CleanupUploads() error {
-	return fm.cleanupDirectory(fm.uploadsDir)
+// retentionPolicy is the retention rule for one managed directory
+type retentionPolicy struct {
+	name   string
+	dir    string
+	maxAge time.Duration // 0 keeps files until they are evicted
 }
 
-// CleanupAll performs cleanup on all managed directories
-func (fm *FileManager) CleanupAll() error {
-	var lastErr error
+// storedFile is a file found during a cleanup pass
+type storedFile struct {
+	path    string
+	dir     string
+	size    int64
+	modTime time.Time
+}
 
-	if err := fm.CleanupTempFiles(); err != nil {
-		fm.logger.Errorf("Failed to cleanup temp files: %v", err)
-		lastErr = err
+// NewFileManager creates a file manager for the directories and retention
+// settings in the upload configuration
+func NewFileManager(cfg *config.Config, logger *logrus.Logger) (*FileManager, error) {
+	fm := &FileManager{
+		logger:   logger,
+		interval: time.Duration(cfg.Upload.CleanupInterval) * time.Second,
+		stop:     make(chan struct{}),
 	}
+	fm.Configure(cfg.Upload)
 
-	if err := fm.CleanupUploads(); err != nil {
-		fm.logger.Errorf("Failed to cleanup uploads: %v", err)
-		lastErr = err
+	if err := fm.EnsureDirectories(); err != nil {
+		return nil, err
 	}
 
-	return lastErr
+	return fm, nil
 }
 
-// cleanupDirectory removes files older than cleanupAge from a directory
-func (fm *FileManager) cleanupDirectory(dir string) error {
-	cutoff := time.Now().Add(-fm.cleanupAge)
-	
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// Configure applies the retention settings of the upload configuration.
+// It is safe to call while cleanup is running.
+func (fm *FileManager) Configure(upload config.UploadConfig) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.policies = []retentionPolicy{
+		{name: DirTemp, dir: upload.TempDir, maxAge: time.Duration(upload.CleanupAfter) * time.Second},
+		{name: DirUploads, dir: upload.UploadDir, maxAge: time.Duration(upload.UploadRetention) * time.Second},
+	}
+	fm.maxDiskUsage = upload.MaxDiskUsage
+	fm.dryRun = upload.CleanupDryRun
+}
+
+// Cleanup runs one retention pass over every managed directory and returns
+// what it removed (or, in dry-run mode, would have removed)
+func (fm *FileManager) Cleanup() models.CleanupRun {
+	fm.runMu.Lock()
+	defer fm.runMu.Unlock()
+
+	fm.mu.RLock()
+	policies := fm.policies
+	maxDiskUsage := fm.maxDiskUsage
+	dryRun := fm.dryRun
+	fm.mu.RUnlock()
+
+	run := models.CleanupRun{StartedAt: time.Now()}
+	usage := make(map[string]*models.DirectoryUsage, len(policies))
+	var kept []storedFile
+
+	// Expire files past their directory's retention
+	for _, policy := range policies {
+		dirUsage := &models.DirectoryUsage{
+			Name:      policy.name,
+			Path:      policy.dir,
+			Retention: retentionString(policy.maxAge),
+		}
+		usage[policy.name] = dirUsage
+
+		files, err := listFiles(policy.name, policy.dir)
 		if err != nil {
-			return err
+			fm.logger.Errorf("Failed to scan %s directory %s: %v", policy.name, policy.dir, err)
+			run.Errors++
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+		cutoff := run.StartedAt.Add(-policy.maxAge)
+		for _, file := range files {
+			dirUsage.Files++
+			dirUsage.Bytes += file.size
+			if policy.maxAge > 0 && file.modTime.Before(cutoff) {
+				if fm.remove(file, removalExpired, dryRun, usage) {
+					run.ExpiredFiles++
+					run.ExpiredBytes += file.size
+					continue
+				}
+				run.Errors++
+			}
+			kept = append(kept, file)
 		}
+	}
+
+	// Evict the oldest files while the total is over the cap
+	var total int64
+	for _, file := range kept {
+		total += file.size
+	}
+	if maxDiskUsage > 0 && total > maxDiskUsage {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].modTime.Before(kept[j].modTime) })
 
-		// Check if file is older than cutoff
-		if info.ModTime().Before(cutoff) {
-			fm.logger.Infof("Removing old file: %s (age: %v)", path, time.Since(info.ModTime()))
-			
-			if err := os.Remove(path); err != nil {
-				fm.logger.Errorf("Failed to remove file %s: %v", path, err)
-				return err
+		for _, file := range kept {
+			if total <= maxDiskUsage {
+				break
 			}
+			if !fm.remove(file, removalEvicted, dryRun, usage) {
+				run.Errors++
+				continue
+			}
+			total -= file.size
+			run.EvictedFiles++
+			run.EvictedBytes += file.size
 		}
+	}
+
+	run.DurationMs = float64(time.Since(run.StartedAt).Nanoseconds()) / 1e6
+
+	// Usage reflects what is actually on disk, so dry runs leave it unchanged
+	stats := models.StorageStats{
+		MaxBytes:    maxDiskUsage,
+		DryRun:      dryRun,
+		LastCleanup: &run,
+	}
+	for _, policy := range policies {
+		dirUsage := usage[policy.name]
+		stats.Directories = append(stats.Directories, *dirUsage)
+		stats.TotalBytes += dirUsage.Bytes
+		metrics.SetStorageUsage(policy.name, dirUsage.Bytes)
+	}
+
+	fm.mu.Lock()
+	fm.stats = stats
+	fm.mu.Unlock()
+
+	fm.logger.WithFields(logrus.Fields{
+		"expired_files": run.ExpiredFiles,
+		"evicted_files": run.EvictedFiles,
+		"total_bytes":   stats.TotalBytes,
+		"dry_run":       dryRun,
+	}).Info("Storage cleanup finished")
+
+	return run
+}
+
+// remove deletes a file found by cleanup and takes it off the directory
+// usage, or only logs it in dry-run mode. It reports whether the file is
+// gone (or would be).
+func (fm *FileManager) remove(file storedFile, reason string, dryRun bool, usage map[string]*models.DirectoryUsage) bool {
+	entry := fm.logger.WithFields(logrus.Fields{
+		"path":   file.path,
+		"reason": reason,
+		"age":    time.Since(file.modTime).Round(time.Second).String(),
+		"bytes":  file.size,
+	})
 
+	if dryRun {
+		entry.Info("Dry run: would remove file")
+		return true
+	}
+
+	if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+		entry.Errorf("Failed to remove file: %v", err)
+		return false
+	}
+
+	entry.Debug("Removed file")
+	metrics.FilesRemoved(file.dir, reason, 1)
+	usage[file.dir].Files--
+	usage[file.dir].Bytes -= file.size
+	return true
+}
+
+// listFiles returns every regular file below dir
+func listFiles(name, dir string) ([]storedFile, error) {
+	var files []storedFile
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, storedFile{
+				path:    path,
+				dir:     name,
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
 		return nil
 	})
+
+	return files, err
 }
 
-// StartPeriodicCleanup starts a background cleanup routine
-func (fm *FileManager) StartPeriodicCleanup(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	
+// retentionString formats a retention age for display
+func retentionString(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "keep"
+	}
+	return maxAge.String()
+}
+
+// Stats returns storage usage as of the last cleanup run
+func (fm *FileManager) Stats() models.StorageStats {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.stats
+}
+
+// StartPeriodicCleanup runs cleanup now and then every configured interval
+// until Stop is called
+func (fm *FileManager) StartPeriodicCleanup() {
 	go func() {
+		ticker := time.NewTicker(fm.interval)
 		defer ticker.Stop()
-		
-		for range ticker.C {
-			fm.logger.Debug("Running periodic cleanup")
-			if err := fm.CleanupAll(); err != nil {
-				fm.logger.Errorf("Periodic cleanup failed: %v", err)
+
+		fm.Cleanup()
+		for {
+			select {
+			case <-ticker.C:
+				fm.logger.Debug("Running periodic cleanup")
+				fm.Cleanup()
+			case <-fm.stop:
+				return
 			}
 		}
 	}()
-	
-	fm.logger.Infof("Started periodic cleanup with interval: %v", interval)
+
+	fm.logger.Infof("Started periodic cleanup with interval: %v", fm.interval)
+}
+
+// Stop stops the periodic cleanup routine
+func (fm *FileManager) Stop() {
+	fm.stopOnce.Do(func() {
+		close(fm.stop)
+		fm.logger.Info("Stopped periodic cleanup")
+	})
 }
 
 // GetTempDir returns the temporary directory path
 func (fm *FileManager) GetTempDir() string {
-	return fm.tempDir
+	return fm.policyDir(DirTemp)
 }
 
 // GetUploadsDir returns the uploads directory path
 func (fm *FileManager) GetUploadsDir() string {
-	return fm.uploadsDir
+	return fm.policyDir(DirUploads)
+}
+
+// policyDir returns the path of a managed directory
+func (fm *FileManager) policyDir(name string) string {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	for _, policy := range fm.policies {
+		if policy.name == name {
+			return policy.dir
+		}
+	}
+	return ""
 }
 
 // CreateTempFile creates a temporary file and returns its path
 func (fm *FileManager) CreateTempFile(prefix string) (*os.File, error) {
-	return os.CreateTemp(fm.tempDir, prefix)
+	return os.CreateTemp(fm.GetTempDir(), prefix)
 }
 
-// EnsureDirectories creates all necessary directories
+// EnsureDirectories creates the managed directories
 func (fm *FileManager) EnsureDirectories() error {
-	dirs := []string{
-		fm.tempDir,
-		fm.uploadsDir,
-		"./logs",
-		"./models",
-		"./cache",
-		"./cache/models",
-	}
+	fm.mu.RLock()
+	policies := fm.policies
+	fm.mu.RUnlock()
 
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0750); err != nil {
-			return err
+	for _, policy := range policies {
+		if err := os.MkdirAll(policy.dir, 0750); err != nil {
+			return fmt.Errorf("failed to create %s directory: %w", policy.name, err)
 		}
-		fm.logger.Debugf("Ensured directory exists: %s", dir)
+		fm.logger.Debugf("Ensured directory exists: %s", policy.dir)
 	}
 
 	return nil
@@ -191,11 +365,11 @@ func (fm *FileManager) GetDirectoryStats(dir string) (DirectoryStats, error) {
 		} else {
 			stats.Files++
 			stats.TotalSize += info.Size()
-			
+
 			if stats.OldestFile.IsZero() || info.ModTime().Before(stats.OldestFile) {
 				stats.OldestFile = info.ModTime()
 			}
-			
+
 			if stats.NewestFile.IsZero() || info.ModTime().After(stats.NewestFile) {
 				stats.NewestFile = info.ModTime()
 			}
@@ -215,4 +389,4 @@ type DirectoryStats struct {
 	TotalSize   int64     `json:"total_size"`
 	OldestFile  time.Time `json:"oldest_file"`
 	NewestFile  time.Time `json:"newest_file"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestFileManager(t *testing.T, upload config.UploadConfig) *FileManager {
+	t.Helper()
+	root := t.TempDir()
+	upload.TempDir = filepath.Join(root, "temp")
+	upload.UploadDir = filepath.Join(root, "uploads")
+	upload.CleanupInterval = 3600
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	fm, err := NewFileManager(&config.Config{Upload: upload}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	return fm
+}
+
+// writeAged creates a file of the given size last modified age ago
+func writeAged(t *testing.T, dir, name string, size int, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set file time: %v", err)
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestFileManagerRetentionPerDirectory(t *testing.T) {
+	fm := newTestFileManager(t, config.UploadConfig{
+		CleanupAfter:    3600,  // temp: 1h
+		UploadRetention: 86400, // uploads: 24h
+	})
+
+	oldTemp := writeAged(t, fm.GetTempDir(), "old.png", 10, 2*time.Hour)
+	newTemp := writeAged(t, fm.GetTempDir(), "new.png", 10, time.Minute)
+	upload := writeAged(t, fm.GetUploadsDir(), "upload.png", 10, 2*time.Hour)
+
+	run := fm.Cleanup()
+
+	if exists(oldTemp) || !exists(newTemp) {
+		t.Error("Expected only the expired temp file to be removed")
+	}
+	if !exists(upload) {
+		t.Error("Expected upload within its retention to be kept")
+	}
+	if run.ExpiredFiles != 1 || run.ExpiredBytes != 10 {
+		t.Errorf("Expected 1 expired file of 10 bytes, got %d files %d bytes", run.ExpiredFiles, run.ExpiredBytes)
+	}
+
+	stats := fm.Stats()
+	if stats.TotalBytes != 20 || len(stats.Directories) != 2 {
+		t.Errorf("Expected 20 bytes in 2 directories, got %d bytes in %d", stats.TotalBytes, len(stats.Directories))
+	}
+}
+
+func TestFileManagerEvictsOldestFirst(t *testing.T) {
+	fm := newTestFileManager(t, config.UploadConfig{MaxDiskUsage: 250})
+
+	oldest := writeAged(t, fm.GetUploadsDir(), "a.png", 100, 3*time.Hour)
+	older := writeAged(t, fm.GetTempDir(), "b.png", 100, 2*time.Hour)
+	newest := writeAged(t, fm.GetUploadsDir(), "c.png", 100, time.Hour)
+
+	run := fm.Cleanup()
+
+	if exists(oldest) {
+		t.Error("Expected the oldest file to be evicted")
+	}
+	if !exists(older) || !exists(newest) {
+		t.Error("Expected newer files to be kept once under the cap")
+	}
+	if run.EvictedFiles != 1 || fm.Stats().TotalBytes != 200 {
+		t.Errorf("Expected 1 eviction leaving 200 bytes, got %d evictions and %d bytes",
+			run.EvictedFiles, fm.Stats().TotalBytes)
+	}
+}
+
+func TestFileManagerDryRun(t *testing.T) {
+	fm := newTestFileManager(t, config.UploadConfig{
+		CleanupAfter:  60,
+		MaxDiskUsage:  50,
+		CleanupDryRun: true,
+	})
+
+	expired := writeAged(t, fm.GetTempDir(), "old.png", 100, time.Hour)
+	evictable := writeAged(t, fm.GetUploadsDir(), "big.png", 100, time.Minute)
+
+	run := fm.Cleanup()
+
+	if !exists(expired) || !exists(evictable) {
+		t.Error("Expected dry run to leave files in place")
+	}
+	if run.ExpiredFiles != 1 || run.EvictedFiles != 1 {
+		t.Errorf("Expected dry run to report 1 expired and 1 evicted, got %d and %d",
+			run.ExpiredFiles, run.EvictedFiles)
+	}
+	if stats := fm.Stats(); !stats.DryRun || stats.TotalBytes != 200 {
+		t.Errorf("Expected dry-run stats to report actual usage of 200 bytes, got dry_run=%t bytes=%d",
+			stats.DryRun, stats.TotalBytes)
+	}
+
+	// Reconfiguring turns dry run off for the next pass
+	fm.Configure(config.UploadConfig{
+		TempDir:      fm.GetTempDir(),
+		UploadDir:    fm.GetUploadsDir(),
+		CleanupAfter: 60,
+	})
+	fm.Cleanup()
+	if exists(expired) {
+		t.Error("Expected expired file to be removed once dry run is off")
+	}
+}
@@ -1,13 +1,19 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
 	"bytes"
 	"math"
+	"time"
 
 	"github.com/disintegration/imaging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ImageProcessor handles image preprocessing for TensorFlow models
@@ -49,18 +55,32 @@ func (p *ImageProcessor) SetNormalization(normalize bool, meanValues, stdValues
 }
 
 // ProcessImageBytes converts image bytes to TensorFlow-ready tensor data
-func (p *ImageProcessor) ProcessImageBytes(imageData []byte) ([][]float32, error) {
+func (p *ImageProcessor) ProcessImageBytes(ctx context.Context, imageData []byte) ([][]float32, error) {
 	// Decode image
 	img, _, err := image.Decode(bytes.NewReader(imageData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	return p.ProcessImage(img)
+	return p.ProcessImage(ctx, img)
 }
 
 // ProcessImage converts an image.Image to TensorFlow-ready tensor data
-func (p *ImageProcessor) ProcessImage(img image.Image) ([][]float32, error) {
+func (p *ImageProcessor) ProcessImage(ctx context.Context, img image.Image) ([][]float32, error) {
+	start := time.Now()
+	_, span := tracing.StartSpan(ctx, "ImageProcessor.ProcessImage",
+		attribute.Int("image.width", img.Bounds().Dx()),
+		attribute.Int("image.height", img.Bounds().Dy()),
+	)
+	defer func() {
+		span.End()
+		metrics.ObservePreprocessing("tensor", time.Since(start))
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Resize image to target dimensions
 	resized := imaging.Resize(img, p.targetWidth, p.targetHeight, imaging.Lanczos)
 
@@ -108,7 +128,7 @@ func (p *ImageProcessor) ProcessImage(img image.Image) ([][]float32, error) {
 }
 
 // ProcessImageForBatch converts multiple images to tensor format
-func (p *ImageProcessor) ProcessImageForBatch(images []image.Image) ([][][]float32, error) {
+func (p *ImageProcessor) ProcessImageForBatch(ctx context.Context, images []image.Image) ([][][]float32, error) {
 	batchSize := len(images)
 	if batchSize == 0 {
 		return nil, fmt.Errorf("no images provided")
@@ -117,7 +137,10 @@ func (p *ImageProcessor) ProcessImageForBatch(images []image.Image) ([][][]float
 	// Process each image
 	var batchData [][][]float32
 	for _, img := range images {
-		tensorData, err := p.ProcessImage(img)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tensorData, err := p.ProcessImage(ctx, img)
 		if err != nil {
 			return nil, fmt.Errorf("failed to process image: %w", err)
 		}
@@ -132,8 +155,15 @@ func (p *ImageProcessor) GetInputShape() []int {
 	return []int{1, p.targetHeight, p.targetWidth, 3}
 }
 
-// PostprocessPredictions converts raw model outputs to classification results
-func (p *ImageProcessor) PostprocessPredictions(predictions []float32, classNames []string, topK int) ([]ClassificationPrediction, error) {
+// PostprocessPredictions converts raw model outputs to classification
+// results, applying the model's calibration when it has one
+func (p *ImageProcessor) PostprocessPredictions(ctx context.Context, predictions []float32, classNames []string, topK int, calibration *models.Calibration) ([]ClassificationPrediction, error) {
+	_, span := tracing.StartSpan(ctx, "ImageProcessor.PostprocessPredictions",
+		attribute.Int("predictions.classes", len(classNames)),
+		attribute.Int("predictions.top_k", topK),
+	)
+	defer span.End()
+
 	if len(predictions) != len(classNames) {
 		return nil, fmt.Errorf("predictions length (%d) does not match class names length (%d)", 
 			len(predictions), len(classNames))
@@ -146,23 +176,30 @@ func (p *ImageProcessor) PostprocessPredictions(predictions []float32, className
 	// Apply softmax to get probabilities
 	softmaxPreds := applySoftmax(predictions)
 
+	rawProbs := make([]float64, len(softmaxPreds))
+	for i, prob := range softmaxPreds {
+		rawProbs[i] = float64(prob)
+	}
+	calibrated := calibrate(calibration, classNames, rawProbs)
+
 	// Create prediction structs
 	var results []ClassificationPrediction
 	for i, prob := range softmaxPreds {
 		if i < len(classNames) {
 			results = append(results, ClassificationPrediction{
-				ClassIndex:  i,
-				ClassName:   classNames[i],
-				Probability: prob,
-				Confidence:  prob, // Using probability as confidence for now
+				ClassIndex:    i,
+				ClassName:     classNames[i],
+				Probability:   float32(calibrated[i]),
+				Confidence:    float32(calibrated[i]),
+				RawConfidence: prob,
 			})
 		}
 	}
 
-	// Sort by probability (descending)
+	// Sort by calibrated confidence (descending)
 	for i := 0; i < len(results)-1; i++ {
 		for j := i + 1; j < len(results); j++ {
-			if results[j].Probability > results[i].Probability {
+			if results[j].Confidence > results[i].Confidence {
 				results[i], results[j] = results[j], results[i]
 			}
 		}
@@ -182,6 +219,8 @@ type ClassificationPrediction struct {
 	ClassName   string  `json:"class_name"`
 	Probability float32 `json:"probability"`
 	Confidence  float32 `json:"confidence"`
+	// RawConfidence is the softmax probability before calibration
+	RawConfidence float32 `json:"raw_confidence"`
 }
 
 // applySoftmax applies softmax activation to convert logits to probabilities
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"testing"
@@ -57,7 +58,7 @@ func TestImageProcessorProcessImage(t *testing.T) {
 		}
 	}
 
-	tensorData, err := processor.ProcessImage(img)
+	tensorData, err := processor.ProcessImage(context.Background(), img)
 	if err != nil {
 		t.Fatalf("Failed to process image: %v", err)
 	}
@@ -86,7 +87,7 @@ func TestPostprocessPredictions(t *testing.T) {
 	predictions := []float32{1.0, 2.0, 0.5, 3.0, 1.5}
 	classNames := []string{"cat", "dog", "bird", "car", "horse"}
 	
-	results, err := processor.PostprocessPredictions(predictions, classNames, 3)
+	results, err := processor.PostprocessPredictions(context.Background(), predictions, classNames, 3, nil)
 	if err != nil {
 		t.Fatalf("Failed to postprocess predictions: %v", err)
 	}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
@@ -11,12 +12,17 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/image/webp"
 )
 
@@ -24,22 +30,58 @@ import (
 type ImageService struct {
 	config *config.Config
 	logger *logrus.Logger
+
+	// Upload limits can change at runtime on configuration reload
+	limitsMu     sync.RWMutex
+	maxFileSize  int64
+	allowedTypes []string
+
+	// store keeps original uploads and thumbnails; nil when they are not kept
+	store         BlobStore
+	thumbnailSize int
 }
 
 // NewImageService creates a new image service
-func NewImageService(cfg *config.Config) *ImageService {
+func NewImageService(cfg *config.Config, logger *logrus.Logger) *ImageService {
 	return &ImageService{
-		config: cfg,
-		logger: logrus.New(),
+		config:       cfg,
+		logger:       logger,
+		maxFileSize:  cfg.Upload.MaxFileSize,
+		allowedTypes: cfg.Upload.AllowedTypes,
+
+		thumbnailSize: cfg.Blob.ThumbnailSize,
 	}
 }
 
+// SetBlobStore keeps original uploads and their thumbnails in store.
+// Without a store uploads are discarded after prediction.
+func (s *ImageService) SetBlobStore(store BlobStore) {
+	s.store = store
+}
+
+// BlobStore returns the store holding original uploads, or nil
+func (s *ImageService) BlobStore() BlobStore {
+	return s.store
+}
+
+// SetUploadLimits replaces the maximum upload size and allowed content types
+func (s *ImageService) SetUploadLimits(maxFileSize int64, allowedTypes []string) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	s.maxFileSize = maxFileSize
+	s.allowedTypes = allowedTypes
+}
+
 // ValidateImage validates an uploaded image file
 func (s *ImageService) ValidateImage(file multipart.File, header *multipart.FileHeader) error {
+	s.limitsMu.RLock()
+	maxFileSize := s.maxFileSize
+	s.limitsMu.RUnlock()
+
 	// Check file size
-	if header.Size > s.config.Upload.MaxFileSize {
+	if header.Size > maxFileSize {
 		return fmt.Errorf("file size %d bytes exceeds maximum allowed size %d bytes", 
-			header.Size, s.config.Upload.MaxFileSize)
+			header.Size, maxFileSize)
 	}
 
 	// Check content type
@@ -75,7 +117,16 @@ func (s *ImageService) ValidateImage(file multipart.File, header *multipart.File
 }
 
 // ProcessImage processes an uploaded image and returns metadata
-func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileHeader) (*models.ImageMetadata, []byte, error) {
+func (s *ImageService) ProcessImage(ctx context.Context, file multipart.File, header *multipart.FileHeader) (_ *models.ImageMetadata, _ []byte, err error) {
+	ctx, span := tracing.StartSpan(ctx, "ImageService.ProcessImage",
+		attribute.String("image.filename", header.Filename),
+		attribute.Int64("image.size", header.Size),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	// Validate the image first
 	if err := s.ValidateImage(file, header); err != nil {
 		return nil, nil, fmt.Errorf("validation failed: %w", err)
@@ -88,10 +139,19 @@ func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileH
 	}
 
 	// Decode image to get dimensions
+	decodeStart := time.Now()
+	_, decodeSpan := tracing.StartSpan(ctx, "ImageService.decode")
 	img, format, err := s.decodeImage(bytes.NewReader(fileData))
+	decodeSpan.End()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	metrics.ObservePreprocessing("decode", time.Since(decodeStart))
+
+	// Stop before the expensive resize if the client has gone away
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 
 	// Create metadata
 	metadata := &models.ImageMetadata{
@@ -104,18 +164,116 @@ func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileH
 		UploadedAt:  time.Now(),
 	}
 
+	// Keep the original for display and reprocessing; a storage failure
+	// does not fail the prediction
+	if err := s.storeImage(ctx, fileData, img, format, metadata); err != nil {
+		logging.FromContext(ctx, s.logger).Errorf("Failed to store upload %s: %v", metadata.Filename, err)
+	}
+
 	// Preprocess image for model input
+	resizeStart := time.Now()
+	_, resizeSpan := tracing.StartSpan(ctx, "ImageService.resize")
 	processedData, err := s.preprocessForModel(img)
+	resizeSpan.End()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to preprocess image: %w", err)
 	}
+	metrics.ObservePreprocessing("resize", time.Since(resizeStart))
 
-	s.logger.Infof("Processed image: %s (%dx%d, %s, %d bytes)", 
+	logging.FromContext(ctx, s.logger).Infof("Processed image: %s (%dx%d, %s, %d bytes)", 
 		metadata.Filename, metadata.Width, metadata.Height, metadata.Format, metadata.Size)
 
 	return metadata, processedData, nil
 }
 
+// StoreImage keeps raw image bytes and a thumbnail in the blob store and
+// records their keys in metadata. Dimensions and format missing from
+// metadata are filled in from the decoded image. It does nothing when no
+// blob store is configured.
+func (s *ImageService) StoreImage(ctx context.Context, data []byte, metadata *models.ImageMetadata) error {
+	if s.store == nil {
+		return nil
+	}
+
+	img, format, err := s.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if metadata.Width == 0 && metadata.Height == 0 {
+		metadata.Width = img.Bounds().Dx()
+		metadata.Height = img.Bounds().Dy()
+	}
+	if metadata.Format == "" {
+		metadata.Format = format
+	}
+
+	return s.storeImage(ctx, data, img, format, metadata)
+}
+
+// storeImage writes the original and its thumbnail under content-addressed
+// keys, skipping blobs that are already stored
+func (s *ImageService) storeImage(ctx context.Context, data []byte, img image.Image, format string, metadata *models.ImageMetadata) (err error) {
+	if s.store == nil {
+		return nil
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "ImageService.store",
+		attribute.String("blob.backend", s.store.Backend()),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	imageKey := ContentKey("originals", data, "."+format)
+	if err := s.putBlob(ctx, "original", imageKey, "image/"+format, func() ([]byte, error) {
+		return data, nil
+	}); err != nil {
+		return err
+	}
+
+	// Thumbnails are addressed by the original's content and their size
+	thumbnailKey := ContentKey("thumbnails", data, fmt.Sprintf("_%d.jpg", s.thumbnailSize))
+	if err := s.putBlob(ctx, "thumbnail", thumbnailKey, "image/jpeg", func() ([]byte, error) {
+		return s.GetImageThumbnail(img, s.thumbnailSize)
+	}); err != nil {
+		return err
+	}
+
+	metadata.ImageKey = imageKey
+	metadata.ThumbnailKey = thumbnailKey
+	return nil
+}
+
+// putBlob stores the blob produced by build under key unless it exists
+func (s *ImageService) putBlob(ctx context.Context, kind, key, contentType string, build func() ([]byte, error)) error {
+	backend := s.store.Backend()
+
+	exists, err := s.store.Exists(ctx, key)
+	if err != nil {
+		metrics.BlobWrite(backend, kind, "error")
+		return fmt.Errorf("failed to check %s blob: %w", kind, err)
+	}
+	if exists {
+		metrics.BlobWrite(backend, kind, "deduplicated")
+		return nil
+	}
+
+	data, err := build()
+	if err != nil {
+		metrics.BlobWrite(backend, kind, "error")
+		return err
+	}
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		metrics.BlobWrite(backend, kind, "error")
+		return fmt.Errorf("failed to store %s blob: %w", kind, err)
+	}
+
+	metrics.BlobWrite(backend, kind, "stored")
+	s.logger.Debugf("Stored %s blob %s (%d bytes)", kind, key, len(data))
+	return nil
+}
+
 // SaveTempFile saves image data to a temporary file
 func (s *ImageService) SaveTempFile(data []byte, filename string) (string, error) {
 	// Generate unique filename
@@ -139,39 +297,6 @@ func (s *ImageService) SaveTempFile(data []byte, filename string) (string, error
 	return tempPath, nil
 }
 
-// CleanupTempFiles removes old temporary files
-func (s *ImageService) CleanupTempFiles() error {
-	entries, err := os.ReadDir(s.config.Upload.TempDir)
-	if err != nil {
-		return fmt.Errorf("failed to read temp directory: %w", err)
-	}
-
-	now := time.Now()
-	cleanupThreshold := time.Duration(s.config.Upload.CleanupAfter) * time.Second
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		if now.Sub(info.ModTime()) > cleanupThreshold {
-			filePath := filepath.Join(s.config.Upload.TempDir, entry.Name())
-			if err := os.Remove(filePath); err != nil {
-				s.logger.Warnf("Failed to remove temp file %s: %v", filePath, err)
-			} else {
-				s.logger.Debugf("Cleaned up temp file: %s", filePath)
-			}
-		}
-	}
-
-	return nil
-}
-
 // ResizeImage resizes an image to the specified dimensions
 func (s *ImageService) ResizeImage(img image.Image, width, height int) image.Image {
 	return imaging.Resize(img, width, height, imaging.Lanczos)
@@ -193,7 +318,10 @@ func (s *ImageService) ConvertToRGB(img image.Image) *image.RGBA {
 
 // isAllowedType checks if the content type is allowed
 func (s *ImageService) isAllowedType(contentType string) bool {
-	for _, allowedType := range s.config.Upload.AllowedTypes {
+	s.limitsMu.RLock()
+	defer s.limitsMu.RUnlock()
+
+	for _, allowedType := range s.allowedTypes {
 		if contentType == allowedType {
 			return true
 		}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+var (
+	// ErrQueueFull is returned when a model's wait queue has no room left
+	ErrQueueFull = errors.New("inference queue is full")
+
+	// ErrQueueTimeout is returned when a request waited longer than the
+	// queue-time budget without getting an inference slot
+	ErrQueueTimeout = errors.New("timed out waiting for an inference slot")
+)
+
+// OverloadError records which model shed a request, so clients can be
+// told that model's retry delay
+type OverloadError struct {
+	ModelID string
+	Err     error
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("%v for model %s", e.Err, e.ModelID)
+}
+
+func (e *OverloadError) Unwrap() error {
+	return e.Err
+}
+
+// IsOverloaded reports whether err means the request was shed because the
+// inference queue was saturated
+func IsOverloaded(err error) bool {
+	return errors.Is(err, ErrQueueFull) || errors.Is(err, ErrQueueTimeout)
+}
+
+// OverloadedModel returns the model that shed the request, or "" if err
+// is not an overload error
+func OverloadedModel(err error) string {
+	var overload *OverloadError
+	if errors.As(err, &overload) {
+		return overload.ModelID
+	}
+	return ""
+}
+
+// InferenceLimiter bounds concurrent inferences per model with a
+// semaphore and a bounded wait queue, shedding load once the queue is full
+type InferenceLimiter struct {
+	config *config.Config
+
+	mu     sync.Mutex
+	models map[string]*modelLimiter
+}
+
+// modelLimiter is the semaphore and queue for a single model
+type modelLimiter struct {
+	slots        chan struct{}
+	waiting      int
+	maxQueue     int
+	queueTimeout time.Duration
+}
+
+type permitKey struct{ modelID string }
+
+// NewInferenceLimiter creates a limiter from the model configuration
+func NewInferenceLimiter(cfg *config.Config) *InferenceLimiter {
+	return &InferenceLimiter{
+		config: cfg,
+		models: make(map[string]*modelLimiter),
+	}
+}
+
+// Acquire waits for an inference slot for modelID. The returned context
+// records the held slot so nested calls for the same model do not queue
+// twice, and release must be called once the work is finished.
+func (l *InferenceLimiter) Acquire(ctx context.Context, modelID string) (context.Context, func(), error) {
+	noop := func() {}
+	if l == nil {
+		return ctx, noop, nil
+	}
+	if held, _ := ctx.Value(permitKey{modelID}).(bool); held {
+		return ctx, noop, nil
+	}
+
+	ml := l.modelLimiter(modelID)
+	if ml == nil {
+		return ctx, noop, nil
+	}
+	permitCtx := context.WithValue(ctx, permitKey{modelID}, true)
+	release := func() {
+		<-ml.slots
+		metrics.SetInferenceInFlight(modelID, len(ml.slots))
+	}
+
+	// Fast path: a slot is free
+	select {
+	case ml.slots <- struct{}{}:
+		metrics.SetInferenceInFlight(modelID, len(ml.slots))
+		return permitCtx, release, nil
+	default:
+	}
+
+	// Join the wait queue if there is room
+	l.mu.Lock()
+	if ml.waiting >= ml.maxQueue {
+		l.mu.Unlock()
+		metrics.InferenceRejected(modelID, "queue_full")
+		return ctx, noop, &OverloadError{ModelID: modelID, Err: ErrQueueFull}
+	}
+	ml.waiting++
+	metrics.SetQueueDepth(modelID, ml.waiting)
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		ml.waiting--
+		metrics.SetQueueDepth(modelID, ml.waiting)
+		l.mu.Unlock()
+	}()
+
+	var budget <-chan time.Time
+	if ml.queueTimeout > 0 {
+		timer := time.NewTimer(ml.queueTimeout)
+		defer timer.Stop()
+		budget = timer.C
+	}
+
+	select {
+	case ml.slots <- struct{}{}:
+		metrics.SetInferenceInFlight(modelID, len(ml.slots))
+		return permitCtx, release, nil
+	case <-budget:
+		metrics.InferenceRejected(modelID, "queue_timeout")
+		return ctx, noop, &OverloadError{ModelID: modelID, Err: ErrQueueTimeout}
+	case <-ctx.Done():
+		return ctx, noop, ctx.Err()
+	}
+}
+
+// RetryAfter suggests how long a client rejected by modelID's queue should
+// wait before retrying, based on that model's queue timeout
+func (l *InferenceLimiter) RetryAfter(modelID string) time.Duration {
+	if l == nil {
+		return time.Second
+	}
+	queueTimeout := l.config.ForModel(modelID).QueueTimeout
+	if queueTimeout < 1000 {
+		return time.Second
+	}
+	return time.Duration(queueTimeout) * time.Millisecond
+}
+
+// Status returns the queue state of every model that has seen traffic
+func (l *InferenceLimiter) Status() map[string]models.QueueStatus {
+	status := make(map[string]models.QueueStatus)
+	if l == nil {
+		return status
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for modelID, ml := range l.models {
+		if ml == nil {
+			continue
+		}
+		status[modelID] = models.QueueStatus{
+			Running:       len(ml.slots),
+			Waiting:       ml.waiting,
+			MaxConcurrent: cap(ml.slots),
+			MaxQueue:      ml.maxQueue,
+			Saturated:     len(ml.slots) >= cap(ml.slots) && ml.waiting >= ml.maxQueue,
+		}
+	}
+
+	return status
+}
+
+// SaturatedModels returns the IDs of models whose wait queue is full
+func (l *InferenceLimiter) SaturatedModels() []string {
+	var saturated []string
+	for modelID, queue := range l.Status() {
+		if queue.Saturated {
+			saturated = append(saturated, modelID)
+		}
+	}
+	sort.Strings(saturated)
+	return saturated
+}
+
+// CheckReady reports an error while any model's wait queue is full
+func (l *InferenceLimiter) CheckReady(ctx context.Context) error {
+	if saturated := l.SaturatedModels(); len(saturated) > 0 {
+		return fmt.Errorf("inference queue saturated for models: %s", strings.Join(saturated, ", "))
+	}
+	return nil
+}
+
+// modelLimiter returns the limiter for a model, creating it on first use
+// from the model's settings. It returns nil for models whose concurrency
+// is not limited.
+func (l *InferenceLimiter) modelLimiter(modelID string) *modelLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ml, exists := l.models[modelID]
+	if !exists {
+		settings := l.config.ForModel(modelID)
+		if settings.MaxConcurrentInferences > 0 {
+			ml = &modelLimiter{
+				slots:        make(chan struct{}, settings.MaxConcurrentInferences),
+				maxQueue:     settings.MaxQueuedInferences,
+				queueTimeout: time.Duration(settings.QueueTimeout) * time.Millisecond,
+			}
+		}
+		l.models[modelID] = ml
+	}
+	return ml
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+)
+
+func newTestLimiter(concurrent, queued, timeoutMs int) *InferenceLimiter {
+	return NewInferenceLimiter(&config.Config{
+		Model: config.ModelConfig{
+			MaxConcurrentInferences: concurrent,
+			MaxQueuedInferences:     queued,
+			QueueTimeout:            timeoutMs,
+		},
+	})
+}
+
+func TestInferenceLimiterQueueFull(t *testing.T) {
+	limiter := newTestLimiter(1, 0, 1000)
+
+	_, release, err := limiter.Acquire(context.Background(), "model")
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got: %v", err)
+	}
+
+	_, _, err = limiter.Acquire(context.Background(), "model")
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got: %v", err)
+	}
+
+	status := limiter.Status()["model"]
+	if status.Running != 1 || !status.Saturated {
+		t.Errorf("Expected 1 running and saturated queue, got %+v", status)
+	}
+
+	// Other models have their own slots
+	_, releaseOther, err := limiter.Acquire(context.Background(), "other")
+	if err != nil {
+		t.Errorf("Expected other model to have a free slot, got: %v", err)
+	}
+	releaseOther()
+
+	release()
+	if _, release, err = limiter.Acquire(context.Background(), "model"); err != nil {
+		t.Errorf("Expected acquire after release to succeed, got: %v", err)
+	}
+	release()
+}
+
+func TestInferenceLimiterQueueTimeout(t *testing.T) {
+	limiter := newTestLimiter(1, 1, 20)
+
+	_, release, err := limiter.Acquire(context.Background(), "model")
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got: %v", err)
+	}
+	defer release()
+
+	_, _, err = limiter.Acquire(context.Background(), "model")
+	if !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got: %v", err)
+	}
+
+	if !IsOverloaded(err) {
+		t.Error("Expected queue timeout to count as overload")
+	}
+	if model := OverloadedModel(err); model != "model" {
+		t.Errorf("Expected overload to name the model, got %q", model)
+	}
+}
+
+func TestInferenceLimiterRetryAfter(t *testing.T) {
+	slow := 5000
+	limiter := NewInferenceLimiter(&config.Config{
+		Model:  config.ModelConfig{QueueTimeout: 2000},
+		Models: map[string]config.ModelOverrides{"slow": {QueueTimeout: &slow}},
+	})
+
+	if got := limiter.RetryAfter("model"); got != 2*time.Second {
+		t.Errorf("Expected global queue timeout, got %v", got)
+	}
+	if got := limiter.RetryAfter("slow"); got != 5*time.Second {
+		t.Errorf("Expected the model's own queue timeout, got %v", got)
+	}
+}
+
+func TestInferenceLimiterWaitsForSlot(t *testing.T) {
+	limiter := newTestLimiter(1, 1, 1000)
+
+	_, release, err := limiter.Acquire(context.Background(), "model")
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, releaseQueued, err := limiter.Acquire(context.Background(), "model")
+		if err == nil {
+			releaseQueued()
+		}
+		done <- err
+	}()
+
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("Expected queued request to get the released slot, got: %v", err)
+	}
+}
+
+func TestInferenceLimiterReentrant(t *testing.T) {
+	limiter := newTestLimiter(1, 0, 0)
+
+	ctx, release, err := limiter.Acquire(context.Background(), "model")
+	if err != nil {
+		t.Fatalf("Expected first acquire to succeed, got: %v", err)
+	}
+	defer release()
+
+	// A caller already holding the slot must not queue behind itself
+	_, releaseNested, err := limiter.Acquire(ctx, "model")
+	if err != nil {
+		t.Errorf("Expected nested acquire to reuse the held slot, got: %v", err)
+	}
+	releaseNested()
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrJobQueueFull is returned when no more jobs can be queued
+	ErrJobQueueFull = errors.New("job queue is full")
+
+	// ErrJobServiceClosed is returned when jobs are submitted during shutdown
+	ErrJobServiceClosed = errors.New("job service is shutting down")
+)
+
+const (
+	// jobRetention is how long finished jobs stay queryable
+	jobRetention = time.Hour
+
+	// maxJobAttempts bounds retries of jobs shed by the inference limiter
+	maxJobAttempts = 5
+)
+
+// JobService runs prediction jobs asynchronously on a fixed pool of
+// workers. Jobs that have not finished when the service shuts down are
+// persisted and resumed on the next start.
+type JobService struct {
+	predictor PredictionServiceInterface
+	logger    *logrus.Logger
+	workers   int
+	queueSize int
+	stateFile string
+
+	mu     sync.RWMutex
+	jobs   map[string]*jobTask
+	queue  chan *jobTask
+	closed bool
+
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// jobTask is a job together with the request needed to run it
+type jobTask struct {
+	Job       *models.Job              `json:"job"`
+	Request   models.PredictionRequest `json:"request"`
+	RequestID string                   `json:"request_id,omitempty"`
+	// Metadata describes an already stored image being reprocessed, so
+	// the new result links to the same blobs
+	Metadata *models.ImageMetadata `json:"metadata,omitempty"`
+	// Routing keeps a job on the variant its submitter is assigned to
+	Routing RoutingHints `json:"routing,omitempty"`
+}
+
+// NewJobService creates a job service that runs jobs through predictor
+func NewJobService(cfg *config.Config, predictor PredictionServiceInterface, logger *logrus.Logger) *JobService {
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	return &JobService{
+		predictor: predictor,
+		logger:    logger,
+		workers:   cfg.Jobs.Workers,
+		queueSize: cfg.Jobs.QueueSize,
+		stateFile: cfg.Jobs.StateFile,
+		jobs:      make(map[string]*jobTask),
+		runCtx:    runCtx,
+		cancelRun: cancelRun,
+	}
+}
+
+// Start restores jobs persisted by a previous shutdown and starts the workers
+func (s *JobService) Start() error {
+	restored, err := s.loadState()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.queue = make(chan *jobTask, max(s.queueSize, len(restored)))
+	for _, task := range restored {
+		task.Job.Status = models.StatusPending
+		task.Job.Progress = 0
+		s.jobs[task.Job.ID] = task
+		s.queue <- task
+	}
+	s.mu.Unlock()
+
+	if len(restored) > 0 {
+		s.logger.Infof("Restored %d unfinished jobs", len(restored))
+	}
+
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+
+	return nil
+}
+
+// Submit queues a prediction job
+func (s *JobService) Submit(ctx context.Context, request models.PredictionRequest) (*models.Job, error) {
+	return s.submit(ctx, request, nil)
+}
+
+// SubmitStored queues a prediction job for an image already in the blob
+// store. The result carries metadata, including its blob keys, instead of
+// metadata derived from the request.
+func (s *JobService) SubmitStored(ctx context.Context, request models.PredictionRequest, metadata models.ImageMetadata) (*models.Job, error) {
+	return s.submit(ctx, request, &metadata)
+}
+
+func (s *JobService) submit(ctx context.Context, request models.PredictionRequest, metadata *models.ImageMetadata) (*models.Job, error) {
+	now := time.Now()
+	task := &jobTask{
+		Job: &models.Job{
+			ID:        newJobID(),
+			Status:    models.StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Request:   request,
+		RequestID: logging.RequestIDFromContext(ctx),
+		Metadata:  metadata,
+		Routing:   RoutingHintsFromContext(ctx),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.queue == nil {
+		return nil, ErrJobServiceClosed
+	}
+
+	s.pruneLocked(now)
+
+	select {
+	case s.queue <- task:
+	default:
+		return nil, ErrJobQueueFull
+	}
+	s.jobs[task.Job.ID] = task
+
+	job := *task.Job
+	return &job, nil
+}
+
+// Get returns a snapshot of a job
+func (s *JobService) Get(jobID string) (*models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, exists := s.jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job := *task.Job
+	return &job, nil
+}
+
+// Shutdown stops accepting jobs and lets the workers finish the queue until
+// ctx expires. Jobs still queued or running at that point are canceled and
+// persisted so the next start resumes them.
+func (s *JobService) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.queue != nil {
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.Warn("Job drain deadline reached, canceling running jobs")
+		s.cancelRun()
+		<-done
+	}
+	s.cancelRun()
+
+	return s.saveState()
+}
+
+// worker runs queued jobs until the queue is closed
+func (s *JobService) worker() {
+	defer s.wg.Done()
+
+	for task := range s.queue {
+		// After the drain deadline leave the remaining jobs for the next start
+		if s.runCtx.Err() != nil {
+			continue
+		}
+		s.run(task)
+	}
+}
+
+// run executes a single job
+func (s *JobService) run(task *jobTask) {
+	s.update(task, func(job *models.Job) {
+		job.Status = models.StatusProcessing
+		job.Progress = 0.1
+	})
+
+	ctx := logging.WithRequestID(s.runCtx, task.RequestID)
+	ctx = logging.WithFields(ctx, logrus.Fields{"job_id": task.Job.ID})
+	ctx = WithRoutingHints(ctx, task.Routing)
+	ctx = WithRejectionRules(ctx, task.Request.Rejection)
+	ctx = WithRollupDepth(ctx, task.Request.RollupDepth)
+
+	metadata := &models.ImageMetadata{
+		Filename:   task.Request.Filename,
+		Size:       int64(len(task.Request.ImageData)),
+		UploadedAt: task.Job.CreatedAt,
+	}
+	if task.Metadata != nil {
+		stored := *task.Metadata
+		metadata = &stored
+	}
+
+	// Jobs are not latency sensitive, so wait out overload instead of failing
+	var result *models.PredictionResult
+	var err error
+	for attempt := 1; ; attempt++ {
+		result, err = s.predictor.PredictImage(ctx, task.Request.ImageData, metadata, task.Request.ModelID)
+		if !IsOverloaded(err) || attempt == maxJobAttempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-s.runCtx.Done():
+		}
+	}
+
+	// Interrupted by shutdown: put the job back so it is persisted
+	if err != nil && s.runCtx.Err() != nil {
+		s.update(task, func(job *models.Job) {
+			job.Status = models.StatusPending
+			job.Progress = 0
+		})
+		return
+	}
+
+	s.update(task, func(job *models.Job) {
+		job.Progress = 1
+		// Finished jobs stay queryable for a while; the image is not needed
+		task.Request.ImageData = nil
+		if err != nil {
+			job.Status = models.StatusFailed
+			job.Error = models.NewErrorResponse(models.ErrorCodePredictionFailed, "Prediction failed", err.Error())
+			return
+		}
+		job.Status = models.StatusCompleted
+		job.Result = result
+	})
+
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warnf("Job failed: %v", err)
+	}
+}
+
+// update applies fn to a job under the lock
+func (s *JobService) update(task *jobTask, fn func(job *models.Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(task.Job)
+	task.Job.UpdatedAt = time.Now()
+}
+
+// pruneLocked drops finished jobs past the retention period. The caller
+// must hold s.mu.
+func (s *JobService) pruneLocked(now time.Time) {
+	for id, task := range s.jobs {
+		finished := task.Job.Status == models.StatusCompleted || task.Job.Status == models.StatusFailed
+		if finished && now.Sub(task.Job.UpdatedAt) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// saveState persists unfinished jobs to the state file
+func (s *JobService) saveState() error {
+	s.mu.RLock()
+	var unfinished []*jobTask
+	for _, task := range s.jobs {
+		if task.Job.Status == models.StatusPending || task.Job.Status == models.StatusProcessing {
+			unfinished = append(unfinished, task)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(unfinished) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(unfinished)
+	if err != nil {
+		return fmt.Errorf("failed to encode unfinished jobs: %w", err)
+	}
+
+	if err := os.WriteFile(s.stateFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to persist unfinished jobs: %w", err)
+	}
+
+	s.logger.Infof("Persisted %d unfinished jobs to %s", len(unfinished), s.stateFile)
+	return nil
+}
+
+// loadState reads and removes jobs persisted by a previous shutdown
+func (s *JobService) loadState() ([]*jobTask, error) {
+	data, err := os.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job state: %w", err)
+	}
+
+	var tasks []*jobTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return nil, fmt.Errorf("failed to decode job state: %w", err)
+	}
+
+	if err := os.Remove(s.stateFile); err != nil {
+		return nil, fmt.Errorf("failed to remove job state: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// newJobID generates a random job ID
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("job_%d", time.Now().UnixNano())
+	}
+	return "job_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// blockingPredictor returns a result once released or fails when canceled
+type blockingPredictor struct {
+	release chan struct{}
+}
+
+func (p *blockingPredictor) PredictImage(ctx context.Context, imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error) {
+	select {
+	case <-p.release:
+		return &models.PredictionResult{ID: "pred_test"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *blockingPredictor) GetResult(resultID string) (*models.PredictionResult, error) {
+	return nil, nil
+}
+
+func (p *blockingPredictor) SubmitFeedback(ctx context.Context, resultID string, request models.FeedbackRequest) (*models.PredictionResult, error) {
+	return nil, nil
+}
+
+func (p *blockingPredictor) ListModels() []models.ModelInfo {
+	return nil
+}
+
+func newTestJobService(t *testing.T, stateFile string, predictor PredictionServiceInterface) *JobService {
+	cfg := &config.Config{
+		Jobs: config.JobsConfig{Workers: 1, QueueSize: 4, StateFile: stateFile},
+	}
+	service := NewJobService(cfg, predictor, logrus.New())
+	if err := service.Start(); err != nil {
+		t.Fatalf("Failed to start job service: %v", err)
+	}
+	return service
+}
+
+func waitForJobStatus(t *testing.T, service *JobService, jobID string, status models.PredictionStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := service.Get(jobID)
+		if err == nil && job.Status == status {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not reach status %s", jobID, status)
+}
+
+func TestJobServiceRunsJobs(t *testing.T) {
+	predictor := &blockingPredictor{release: make(chan struct{})}
+	close(predictor.release)
+	service := newTestJobService(t, filepath.Join(t.TempDir(), "jobs.json"), predictor)
+
+	job, err := service.Submit(context.Background(), models.PredictionRequest{ImageData: []byte("image")})
+	if err != nil {
+		t.Fatalf("Expected job to be queued, got: %v", err)
+	}
+
+	waitForJobStatus(t, service, job.ID, models.StatusCompleted)
+
+	completed, _ := service.Get(job.ID)
+	if completed.Result == nil || completed.Result.ID != "pred_test" {
+		t.Errorf("Expected job result to be stored, got %+v", completed.Result)
+	}
+
+	if err := service.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected clean shutdown, got: %v", err)
+	}
+	if _, err := service.Submit(context.Background(), models.PredictionRequest{}); err != ErrJobServiceClosed {
+		t.Errorf("Expected ErrJobServiceClosed after shutdown, got: %v", err)
+	}
+}
+
+func TestJobServicePersistsUnfinishedJobs(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "jobs.json")
+	predictor := &blockingPredictor{release: make(chan struct{})}
+	service := newTestJobService(t, stateFile, predictor)
+
+	running, err := service.Submit(context.Background(), models.PredictionRequest{ImageData: []byte("first")})
+	if err != nil {
+		t.Fatalf("Expected job to be queued, got: %v", err)
+	}
+	queued, err := service.Submit(context.Background(), models.PredictionRequest{ImageData: []byte("second")})
+	if err != nil {
+		t.Fatalf("Expected job to be queued, got: %v", err)
+	}
+	waitForJobStatus(t, service, running.ID, models.StatusProcessing)
+
+	// The drain deadline passes while the first job is still running
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := service.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected unfinished jobs to be persisted, got: %v", err)
+	}
+
+	// A new service resumes both jobs
+	close(predictor.release)
+	restarted := newTestJobService(t, stateFile, predictor)
+	waitForJobStatus(t, restarted, running.ID, models.StatusCompleted)
+	waitForJobStatus(t, restarted, queued.ID, models.StatusCompleted)
+}
@@ -0,0 +1,553 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrLabelSetNotFound is returned for label sets that do not exist
+	ErrLabelSetNotFound = errors.New("label set not found")
+
+	// ErrLabelSetExists is returned when creating a label set whose ID is
+	// already taken by a label set or model
+	ErrLabelSetExists = errors.New("label set already exists")
+
+	// ErrInvalidLabelSet is returned for label set requests that cannot be
+	// applied
+	ErrInvalidLabelSet = errors.New("invalid label set")
+)
+
+const (
+	// minLabelSetLabels is the fewest labels a label set can classify into
+	minLabelSetLabels = 2
+
+	// maxLabelLength bounds the length of label names
+	maxLabelLength = 100
+
+	// maxLabelSetLabels bounds the labels of a label set
+	maxLabelSetLabels = 100
+
+	// maxLabelSetExamples bounds the example images of a single request,
+	// since every example is embedded before the request returns
+	maxLabelSetExamples = 200
+
+	// prototypeLogitScale turns cosine similarities into logits. Similar
+	// images differ by a few hundredths in similarity, which the softmax
+	// would otherwise flatten into near-uniform confidences.
+	prototypeLogitScale = 10
+)
+
+// labelSetIDPattern restricts label set IDs to what is safe in URLs and
+// metric labels
+var labelSetIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// LabelSetService manages label sets: custom labels learned from a few
+// example images each, without training. Example embeddings of a base
+// model are averaged into one prototype per label, and each label set is
+// served as a virtual model classifying by the nearest prototype. Label
+// sets are persisted to the label sets file.
+type LabelSetService struct {
+	modelService *ModelService
+	predictor    *EnhancedPredictionService
+	logger       *logrus.Logger
+	file         string
+	maxImageSize int64
+
+	mu   sync.Mutex
+	sets map[string]*models.LabelSet
+}
+
+// NewLabelSetService creates a label set service embedding examples with
+// predictor
+func NewLabelSetService(cfg *config.Config, modelService *ModelService, predictor *EnhancedPredictionService, logger *logrus.Logger) *LabelSetService {
+	return &LabelSetService{
+		modelService: modelService,
+		predictor:    predictor,
+		logger:       logger,
+		file:         cfg.Model.LabelSetsFile,
+		maxImageSize: cfg.Upload.MaxFileSize,
+		sets:         make(map[string]*models.LabelSet),
+	}
+}
+
+// Load restores persisted label sets and registers their virtual models
+func (s *LabelSetService) Load() error {
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read label sets: %w", err)
+	}
+
+	var sets []*models.LabelSet
+	if err := json.Unmarshal(data, &sets); err != nil {
+		return fmt.Errorf("failed to decode label sets: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, set := range sets {
+		if err := s.modelService.RegisterModel(labelSetModel(set)); err != nil {
+			s.logger.Errorf("Failed to register label set %s: %v", set.ID, err)
+			continue
+		}
+		if _, err := s.modelService.GetModel(set.BaseModel); err != nil {
+			s.logger.Warnf("Base model %s of label set %s is not loaded", set.BaseModel, set.ID)
+		}
+		s.sets[set.ID] = set
+	}
+
+	if len(s.sets) > 0 {
+		s.logger.Infof("Loaded %d label sets", len(s.sets))
+	}
+	return nil
+}
+
+// Create builds a label set from the request's examples. Every label needs
+// at least one example image.
+func (s *LabelSetService) Create(ctx context.Context, request models.LabelSetRequest) (*models.LabelSet, error) {
+	if !labelSetIDPattern.MatchString(request.ID) {
+		return nil, fmt.Errorf("%w: id must be 1-64 lowercase letters, digits, '-' or '_'", ErrInvalidLabelSet)
+	}
+	if request.BaseModel == "" {
+		return nil, fmt.Errorf("%w: base_model is required", ErrInvalidLabelSet)
+	}
+	if len(request.RemoveLabels) > 0 {
+		return nil, fmt.Errorf("%w: remove_labels only applies to updates", ErrInvalidLabelSet)
+	}
+	if len(request.Examples) < minLabelSetLabels {
+		return nil, fmt.Errorf("%w: at least %d labels are required", ErrInvalidLabelSet, minLabelSetLabels)
+	}
+	if model, err := s.modelService.GetModel(request.ID); err == nil && model.LabelSet == nil {
+		return nil, fmt.Errorf("%w: %s is a model", ErrLabelSetExists, request.ID)
+	}
+
+	base, err := s.modelService.GetModel(request.BaseModel)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLabelSet, err)
+	}
+	if !s.predictor.embeds(base) {
+		return nil, fmt.Errorf("%w: model %s does not expose embeddings", ErrInvalidLabelSet, base.Info.ID)
+	}
+
+	prototypes, err := s.embedExamples(ctx, base.Info.ID, request.Examples)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := &models.LabelSet{
+		ID:          request.ID,
+		Name:        request.Name,
+		Description: request.Description,
+		BaseModel:   base.Info.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if set.Name == "" {
+		set.Name = set.ID
+	}
+	mergePrototypes(set, prototypes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sets[set.ID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrLabelSetExists, set.ID)
+	}
+	if err := s.commit(set); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Created label set %s with %d labels on model %s", set.ID, len(set.Labels), set.BaseModel)
+	return publicLabelSet(set), nil
+}
+
+// Update renames a label set, adds the request's examples to its labels,
+// creating labels that do not exist yet, and removes RemoveLabels. The
+// base model of a label set cannot change, as prototypes of different
+// models are not comparable.
+func (s *LabelSetService) Update(ctx context.Context, setID string, request models.LabelSetRequest) (*models.LabelSet, error) {
+	current, err := s.get(setID)
+	if err != nil {
+		return nil, err
+	}
+	if request.ID != "" && request.ID != setID {
+		return nil, fmt.Errorf("%w: id cannot change", ErrInvalidLabelSet)
+	}
+	if request.BaseModel != "" && request.BaseModel != current.BaseModel {
+		return nil, fmt.Errorf("%w: base_model cannot change", ErrInvalidLabelSet)
+	}
+
+	// Embed outside the lock; merging is additive, so concurrent updates
+	// of the same label set all count
+	prototypes, err := s.embedExamples(ctx, current.BaseModel, request.Examples)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.sets[setID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLabelSetNotFound, setID)
+	}
+	updated := *existing
+	updated.Labels = append([]models.LabelSetLabel(nil), existing.Labels...)
+	if request.Name != "" {
+		updated.Name = request.Name
+	}
+	if request.Description != "" {
+		updated.Description = request.Description
+	}
+
+	for _, remove := range request.RemoveLabels {
+		found := false
+		for i, label := range updated.Labels {
+			if label.Label == remove {
+				updated.Labels = append(updated.Labels[:i], updated.Labels[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: label %q does not exist", ErrInvalidLabelSet, remove)
+		}
+	}
+	mergePrototypes(&updated, prototypes)
+
+	if len(updated.Labels) < minLabelSetLabels {
+		return nil, fmt.Errorf("%w: at least %d labels are required", ErrInvalidLabelSet, minLabelSetLabels)
+	}
+	if len(updated.Labels) > maxLabelSetLabels {
+		return nil, fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidLabelSet, maxLabelSetLabels)
+	}
+	updated.UpdatedAt = time.Now()
+
+	if err := s.commit(&updated); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Updated label set %s (%d labels)", updated.ID, len(updated.Labels))
+	return publicLabelSet(&updated), nil
+}
+
+// Get returns a label set without its prototypes
+func (s *LabelSetService) Get(setID string) (*models.LabelSet, error) {
+	set, err := s.get(setID)
+	if err != nil {
+		return nil, err
+	}
+	return publicLabelSet(set), nil
+}
+
+// List returns all label sets by ID, without their prototypes
+func (s *LabelSetService) List() []models.LabelSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sets := make([]models.LabelSet, 0, len(s.sets))
+	for _, set := range s.sets {
+		sets = append(sets, *publicLabelSet(set))
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID < sets[j].ID })
+	return sets
+}
+
+// Delete removes a label set and its virtual model
+func (s *LabelSetService) Delete(setID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, ok := s.sets[setID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLabelSetNotFound, setID)
+	}
+
+	delete(s.sets, setID)
+	if err := s.save(); err != nil {
+		s.sets[setID] = set
+		return err
+	}
+	s.modelService.UnregisterModel(setID)
+
+	s.logger.Infof("Deleted label set %s", setID)
+	return nil
+}
+
+// get returns the stored label set
+func (s *LabelSetService) get(setID string) (*models.LabelSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, ok := s.sets[setID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLabelSetNotFound, setID)
+	}
+	return set, nil
+}
+
+// commit persists a new or updated label set and registers its virtual
+// model. The caller holds s.mu.
+func (s *LabelSetService) commit(set *models.LabelSet) error {
+	previous, existed := s.sets[set.ID]
+	s.sets[set.ID] = set
+	if err := s.save(); err != nil {
+		if existed {
+			s.sets[set.ID] = previous
+		} else {
+			delete(s.sets, set.ID)
+		}
+		return err
+	}
+
+	if err := s.modelService.RegisterModel(labelSetModel(set)); err != nil {
+		if existed {
+			s.sets[set.ID] = previous
+		} else {
+			delete(s.sets, set.ID)
+		}
+		if saveErr := s.save(); saveErr != nil {
+			s.logger.Errorf("Failed to persist label sets: %v", saveErr)
+		}
+		return fmt.Errorf("%w: %v", ErrLabelSetExists, err)
+	}
+	return nil
+}
+
+// save atomically rewrites the label sets file. The caller holds s.mu.
+func (s *LabelSetService) save() error {
+	sets := make([]*models.LabelSet, 0, len(s.sets))
+	for _, set := range s.sets {
+		sets = append(sets, set)
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID < sets[j].ID })
+
+	data, err := json.Marshal(sets)
+	if err != nil {
+		return fmt.Errorf("failed to encode label sets: %w", err)
+	}
+
+	tempPath := filepath.Join(filepath.Dir(s.file), "."+filepath.Base(s.file)+".tmp")
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to persist label sets: %w", err)
+	}
+	if err := os.Rename(tempPath, s.file); err != nil {
+		return fmt.Errorf("failed to persist label sets: %w", err)
+	}
+	return nil
+}
+
+// labelPrototype is the mean of a label's new example embeddings
+type labelPrototype struct {
+	mean     []float64
+	examples int
+}
+
+// embedExamples embeds the example images of each label with the base
+// model and averages the normalized embeddings per label
+func (s *LabelSetService) embedExamples(ctx context.Context, baseModel string, examples map[string][][]byte) (map[string]labelPrototype, error) {
+	if len(examples) > maxLabelSetLabels {
+		return nil, fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidLabelSet, maxLabelSetLabels)
+	}
+	total := 0
+	for _, images := range examples {
+		total += len(images)
+	}
+	if total > maxLabelSetExamples {
+		return nil, fmt.Errorf("%w: at most %d examples are allowed per request", ErrInvalidLabelSet, maxLabelSetExamples)
+	}
+
+	prototypes := make(map[string]labelPrototype, len(examples))
+	for label, images := range examples {
+		if strings.TrimSpace(label) == "" || len(label) > maxLabelLength {
+			return nil, fmt.Errorf("%w: label names must be 1-%d characters", ErrInvalidLabelSet, maxLabelLength)
+		}
+		if len(images) == 0 {
+			return nil, fmt.Errorf("%w: label %q has no examples", ErrInvalidLabelSet, label)
+		}
+
+		var sum []float64
+		for i, data := range images {
+			if int64(len(data)) > s.maxImageSize {
+				return nil, fmt.Errorf("%w: example %d of label %q exceeds %d bytes", ErrInvalidLabelSet, i, label, s.maxImageSize)
+			}
+			embedding, err := s.predictor.Embed(ctx, data, baseModel)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if IsOverloaded(err) {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w: example %d of label %q: %v", ErrInvalidLabelSet, i, label, err)
+			}
+			normalize(embedding)
+			if sum == nil {
+				sum = make([]float64, len(embedding))
+			}
+			for j, value := range embedding {
+				sum[j] += value
+			}
+		}
+
+		for j := range sum {
+			sum[j] /= float64(len(images))
+		}
+		prototypes[label] = labelPrototype{mean: sum, examples: len(images)}
+	}
+	return prototypes, nil
+}
+
+// mergePrototypes adds new examples to a label set, weighting each label's
+// prototype by its number of examples. New labels are kept in name order.
+func mergePrototypes(set *models.LabelSet, prototypes map[string]labelPrototype) {
+	names := make([]string, 0, len(prototypes))
+	for name := range prototypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		added := prototypes[name]
+		merged := false
+		for i, label := range set.Labels {
+			if label.Label != name {
+				continue
+			}
+			total := label.Examples + added.examples
+			prototype := make([]float64, len(label.Prototype))
+			for j := range prototype {
+				prototype[j] = (label.Prototype[j]*float64(label.Examples) + added.mean[j]*float64(added.examples)) / float64(total)
+			}
+			set.Labels[i] = models.LabelSetLabel{Label: name, Examples: total, Prototype: prototype}
+			merged = true
+			break
+		}
+		if !merged {
+			set.Labels = append(set.Labels, models.LabelSetLabel{Label: name, Examples: added.examples, Prototype: added.mean})
+		}
+	}
+}
+
+// labelSetModel builds the virtual model serving a label set
+func labelSetModel(set *models.LabelSet) *LoadedModel {
+	classes := make([]string, len(set.Labels))
+	for i, label := range set.Labels {
+		classes[i] = label.Label
+	}
+
+	return &LoadedModel{
+		Info: models.ModelInfo{
+			ID:          set.ID,
+			Name:        set.Name,
+			Version:     set.UpdatedAt.UTC().Format("20060102T150405Z"),
+			Description: set.Description,
+			InputShape:  []int{224, 224, 3},
+			OutputShape: []int{len(classes)},
+			Classes:     classes,
+			LoadedAt:    time.Now(),
+			Metadata:    map[string]string{"type": models.ModelTypeLabelSet},
+			BaseModel:   set.BaseModel,
+		},
+		Health: models.ModelHealth{
+			Status:   "healthy",
+			LastUsed: time.Now(),
+		},
+		LastUsed: time.Now(),
+		LabelSet: set,
+	}
+}
+
+// publicLabelSet returns a copy of a label set without its prototypes
+func publicLabelSet(set *models.LabelSet) *models.LabelSet {
+	public := *set
+	public.Labels = make([]models.LabelSetLabel, len(set.Labels))
+	for i, label := range set.Labels {
+		public.Labels[i] = models.LabelSetLabel{Label: label.Label, Examples: label.Examples}
+	}
+	return &public
+}
+
+// runLabelSet embeds the input with the label set's base model and scores
+// each label by the cosine similarity of the embedding to its prototype
+func (s *EnhancedPredictionService) runLabelSet(ctx context.Context, input *inferenceInput, model *LoadedModel) (*inferenceOutcome, error) {
+	start := time.Now()
+	base, err := s.modelService.GetModel(model.LabelSet.BaseModel)
+	if err != nil {
+		return nil, fmt.Errorf("base model of label set %s: %w", model.Info.ID, err)
+	}
+
+	embedding, err := s.embed(ctx, input, base)
+	metrics.ObserveInference(model.Info.ID, metrics.EnginePrototype, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(model.LabelSet.Labels))
+	classes := make([]string, len(model.LabelSet.Labels))
+	for i, label := range model.LabelSet.Labels {
+		if len(label.Prototype) != len(embedding) {
+			return nil, fmt.Errorf("label set %s has %d-dimensional prototypes but model %s embeds into %d dimensions",
+				model.Info.ID, len(label.Prototype), base.Info.ID, len(embedding))
+		}
+		scores[i] = float32(prototypeLogitScale * cosineSimilarity(embedding, label.Prototype))
+		classes[i] = label.Label
+	}
+
+	predictions, err := s.postprocess(ctx, scores, classes, model)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inferenceOutcome{predictions: predictions, model: model, engine: metrics.EnginePrototype}, nil
+}
+
+// normalize scales a vector to unit length in place
+func normalize(v []float64) {
+	var norm float64
+	for _, value := range v {
+		norm += value * value
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors of
+// equal length, or 0 if either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// solidPNG encodes a single-color image
+func solidPNG(t *testing.T, c color.Color, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLabelSetService(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:             "./testdata/models",
+			Version:          "1.0.0",
+			InferenceTimeout: 5000,
+			LabelSetsFile:    filepath.Join(t.TempDir(), "label_sets.json"),
+		},
+		Upload: config.UploadConfig{MaxFileSize: 1 << 20},
+	}
+
+	predictor := newTestEnhancedPredictionService(cfg)
+	service := NewLabelSetService(cfg, predictor.modelService, predictor, logrus.New())
+	ctx := context.Background()
+
+	red := color.RGBA{R: 220, G: 20, B: 30, A: 255}
+	blue := color.RGBA{R: 20, G: 40, B: 210, A: 255}
+	green := color.RGBA{R: 30, G: 200, B: 40, A: 255}
+
+	set, err := service.Create(ctx, models.LabelSetRequest{
+		ID:        "colors",
+		BaseModel: "dummy",
+		Examples: map[string][][]byte{
+			"red":  {solidPNG(t, red, 32, 32), solidPNG(t, color.RGBA{R: 200, G: 40, B: 20, A: 255}, 40, 20)},
+			"blue": {solidPNG(t, blue, 32, 32)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected label set to be created, got error: %v", err)
+	}
+	if len(set.Labels) != 2 || set.Labels[0].Label != "blue" || set.Labels[1].Examples != 2 {
+		t.Errorf("Expected blue and red with 2 examples, got %+v", set.Labels)
+	}
+	if set.Labels[0].Prototype != nil {
+		t.Error("Expected prototypes to be left out of returned label sets")
+	}
+
+	model, err := predictor.modelService.GetModel("colors")
+	if err != nil {
+		t.Fatalf("Expected label set to be served as a model, got error: %v", err)
+	}
+	if model.Info.BaseModel != "dummy" || model.Info.Metadata["type"] != models.ModelTypeLabelSet {
+		t.Errorf("Expected label set model info, got %+v", model.Info)
+	}
+
+	predict := func(c color.Color) *models.PredictionResult {
+		t.Helper()
+		result, err := predictor.PredictImage(ctx, solidPNG(t, c, 64, 48), &models.ImageMetadata{Filename: "test.png"}, "colors")
+		if err != nil {
+			t.Fatalf("Expected prediction to succeed, got error: %v", err)
+		}
+		return result
+	}
+
+	result := predict(color.RGBA{R: 230, G: 30, B: 40, A: 255})
+	if result.Engine != metrics.EnginePrototype {
+		t.Errorf("Expected prototype engine, got %s", result.Engine)
+	}
+	if result.Predictions[0].ClassName != "red" || result.Predictions[0].Confidence <= result.Predictions[1].Confidence {
+		t.Errorf("Expected red to be the nearest prototype, got %+v", result.Predictions)
+	}
+
+	// Adding a label makes it predictable without touching the others
+	set, err = service.Update(ctx, "colors", models.LabelSetRequest{
+		Examples: map[string][][]byte{"green": {solidPNG(t, green, 32, 32)}},
+	})
+	if err != nil {
+		t.Fatalf("Expected label set to be updated, got error: %v", err)
+	}
+	if len(set.Labels) != 3 {
+		t.Errorf("Expected 3 labels, got %+v", set.Labels)
+	}
+	if result := predict(green); result.Predictions[0].ClassName != "green" {
+		t.Errorf("Expected green to be the nearest prototype, got %+v", result.Predictions)
+	}
+
+	if _, err := service.Update(ctx, "colors", models.LabelSetRequest{RemoveLabels: []string{"green", "blue"}}); !errors.Is(err, ErrInvalidLabelSet) {
+		t.Errorf("Expected removing all but one label to be rejected, got %v", err)
+	}
+	if _, err := service.Update(ctx, "colors", models.LabelSetRequest{BaseModel: "other"}); !errors.Is(err, ErrInvalidLabelSet) {
+		t.Errorf("Expected changing the base model to be rejected, got %v", err)
+	}
+
+	// Label sets survive a restart
+	restarted := newTestEnhancedPredictionService(cfg)
+	reloaded := NewLabelSetService(cfg, restarted.modelService, restarted, logrus.New())
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Expected label sets to load, got error: %v", err)
+	}
+	if sets := reloaded.List(); len(sets) != 1 || len(sets[0].Labels) != 3 {
+		t.Errorf("Expected persisted label set, got %+v", sets)
+	}
+	if _, err := restarted.modelService.GetModel("colors"); err != nil {
+		t.Errorf("Expected reloaded label set to be served, got error: %v", err)
+	}
+
+	if err := service.Delete("colors"); err != nil {
+		t.Fatalf("Expected label set to be deleted, got error: %v", err)
+	}
+	if _, err := predictor.modelService.GetModel("colors"); err == nil {
+		t.Error("Expected deleted label set to no longer be served")
+	}
+	if err := service.Delete("colors"); !errors.Is(err, ErrLabelSetNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestLabelSetServiceCreateValidation(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:          "./testdata/models",
+			Version:       "1.0.0",
+			LabelSetsFile: filepath.Join(t.TempDir(), "label_sets.json"),
+		},
+		Upload: config.UploadConfig{MaxFileSize: 1 << 20},
+	}
+
+	predictor := newTestEnhancedPredictionService(cfg)
+	service := NewLabelSetService(cfg, predictor.modelService, predictor, logrus.New())
+	example := solidPNG(t, color.White, 8, 8)
+
+	tooManyLabels := make(map[string][][]byte)
+	for i := 0; i <= maxLabelSetLabels; i++ {
+		tooManyLabels[fmt.Sprintf("label-%d", i)] = [][]byte{example}
+	}
+	tooManyExamples := make([][]byte, maxLabelSetExamples)
+	for i := range tooManyExamples {
+		tooManyExamples[i] = example
+	}
+
+	tests := []struct {
+		name    string
+		request models.LabelSetRequest
+		want    error
+	}{
+		{"invalid id", models.LabelSetRequest{ID: "Bad ID", BaseModel: "dummy", Examples: map[string][][]byte{"a": {example}, "b": {example}}}, ErrInvalidLabelSet},
+		{"one label", models.LabelSetRequest{ID: "one", BaseModel: "dummy", Examples: map[string][][]byte{"a": {example}}}, ErrInvalidLabelSet},
+		{"no examples", models.LabelSetRequest{ID: "empty", BaseModel: "dummy", Examples: map[string][][]byte{"a": {example}, "b": {}}}, ErrInvalidLabelSet},
+		{"unknown base model", models.LabelSetRequest{ID: "unknown", BaseModel: "missing", Examples: map[string][][]byte{"a": {example}, "b": {example}}}, ErrInvalidLabelSet},
+		{"invalid image", models.LabelSetRequest{ID: "broken", BaseModel: "dummy", Examples: map[string][][]byte{"a": {example}, "b": {[]byte("not an image")}}}, ErrInvalidLabelSet},
+		{"model id", models.LabelSetRequest{ID: "dummy", BaseModel: "dummy", Examples: map[string][][]byte{"a": {example}, "b": {example}}}, ErrLabelSetExists},
+		{"too many labels", models.LabelSetRequest{ID: "labels", BaseModel: "dummy", Examples: tooManyLabels}, ErrInvalidLabelSet},
+		{"too many examples", models.LabelSetRequest{ID: "examples", BaseModel: "dummy", Examples: map[string][][]byte{"a": tooManyExamples, "b": {example}}}, ErrInvalidLabelSet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Create(context.Background(), tt.request); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLabelSetServiceEmbedsWithinInferenceLimit(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:                    "./testdata/models",
+			Version:                 "1.0.0",
+			LabelSetsFile:           filepath.Join(t.TempDir(), "label_sets.json"),
+			MaxConcurrentInferences: 1,
+		},
+		Upload: config.UploadConfig{MaxFileSize: 1 << 20},
+	}
+
+	predictor := newTestEnhancedPredictionService(cfg)
+	limiter := NewInferenceLimiter(cfg)
+	predictor.SetInferenceLimiter(limiter)
+	service := NewLabelSetService(cfg, predictor.modelService, predictor, logrus.New())
+	example := solidPNG(t, color.White, 8, 8)
+
+	// With the base model's only slot taken, examples are not embedded
+	_, release, err := limiter.Acquire(context.Background(), "dummy")
+	if err != nil {
+		t.Fatalf("Expected a free slot, got: %v", err)
+	}
+	_, err = service.Create(context.Background(), models.LabelSetRequest{
+		ID:        "busy",
+		BaseModel: "dummy",
+		Examples:  map[string][][]byte{"a": {example}, "b": {example}},
+	})
+	release()
+	if !IsOverloaded(err) {
+		t.Errorf("Expected embedding to be shed while the base model is busy, got: %v", err)
+	}
+}
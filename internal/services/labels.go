@@ -0,0 +1,117 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// labelsFile is the name of the optional class labels in a model directory
+const labelsFile = "labels.json"
+
+// defaultClassDescriptions describe common classes of models without a
+// labels file
+var defaultClassDescriptions = map[string]string{
+	"cat":        "A small domestic feline mammal",
+	"dog":        "A domestic canine companion animal",
+	"bird":       "A feathered, winged, bipedal animal",
+	"car":        "A four-wheeled motor vehicle",
+	"truck":      "A large motor vehicle for transporting goods",
+	"airplane":   "A powered flying vehicle with wings",
+	"boat":       "A watercraft designed for travel on water",
+	"train":      "A connected series of railway cars",
+	"bicycle":    "A two-wheeled vehicle powered by pedaling",
+	"motorcycle": "A two-wheeled motor vehicle",
+	"person":     "A human being",
+	"horse":      "A large domesticated ungulate mammal",
+	"sheep":      "A woolly ruminant mammal",
+	"cow":        "A large domesticated bovine animal",
+	"elephant":   "A large mammal with a trunk",
+	"bear":       "A large omnivorous mammal",
+	"zebra":      "A black and white striped equine",
+	"giraffe":    "A tall African mammal with a long neck",
+	// ImageNet classes
+	"tench":             "A European freshwater fish",
+	"goldfish":          "A small golden-colored fish",
+	"great_white_shark": "A large predatory shark",
+	"tiger_shark":       "A large shark with distinctive markings",
+	"hammerhead":        "A shark with a flattened head",
+	"electric_ray":      "A cartilaginous fish that can produce electric discharge",
+	"stingray":          "A cartilaginous fish with a long tail",
+	"cock":              "A male domestic fowl",
+	"hen":               "A female domestic fowl",
+	"ostrich":           "A large flightless bird",
+}
+
+// Labels holds the display names, descriptions, synonyms and external IDs
+// of a model's classes, keyed by class name
+type Labels struct {
+	classes map[string]models.ClassInfo
+}
+
+// loadLabels reads a JSON object of class names to class information
+func loadLabels(path string) (*Labels, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var classes map[string]models.ClassInfo
+	if err := json.Unmarshal(data, &classes); err != nil {
+		return nil, fmt.Errorf("failed to parse labels: %w", err)
+	}
+	return &Labels{classes: classes}, nil
+}
+
+// describe fills in the label, description, synonyms and external IDs of a
+// prediction. Classes without labels get a readable form of the class name
+// and the built-in description, if there is one.
+func (l *Labels) describe(pred *models.ClassificationResult) {
+	var info models.ClassInfo
+	if l != nil {
+		info = l.classes[pred.ClassName]
+	}
+
+	pred.Label = info.DisplayName
+	if pred.Label == "" {
+		pred.Label = displayName(pred.ClassName)
+	}
+	pred.Description = info.Description
+	if pred.Description == "" {
+		pred.Description = defaultClassDescriptions[pred.ClassName]
+	}
+	pred.Synonyms = info.Synonyms
+	pred.ExternalIDs = info.ExternalIDs
+}
+
+// localizedName returns the display name of class in the first of
+// languages it has one for, matching a regional tag such as "fr-CA" to
+// "fr" when needed, and the language used
+func (l *Labels) localizedName(class string, languages []string) (string, string, bool) {
+	if l == nil {
+		return "", "", false
+	}
+	names := l.classes[class].DisplayNames
+	if len(names) == 0 {
+		return "", "", false
+	}
+
+	for _, language := range languages {
+		base, _, _ := strings.Cut(language, "-")
+		for _, candidate := range []string{language, base} {
+			for tag, name := range names {
+				if strings.EqualFold(tag, candidate) {
+					return name, tag, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// displayName turns a class name such as "tiger_cat" into "tiger cat"
+func displayName(class string) string {
+	return strings.ReplaceAll(class, "_", " ")
+}
@@ -1,13 +1,17 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // MockTensorFlowService provides TensorFlow interface without requiring C library
@@ -28,10 +32,10 @@ type MockTFModel struct {
 }
 
 // NewTensorFlowService creates a new mock TensorFlow service
-func NewTensorFlowService(cfg *config.Config) *MockTensorFlowService {
+func NewTensorFlowService(cfg *config.Config, logger *logrus.Logger) *MockTensorFlowService {
 	service := &MockTensorFlowService{
 		config: cfg,
-		logger: logrus.New(),
+		logger: logger,
 		models: make(map[string]*MockTFModel),
 	}
 	
@@ -55,6 +59,7 @@ func (s *MockTensorFlowService) LoadModel(modelPath string, modelID string) erro
 		InputShape:  []int{1, 224, 224, 3},
 		OutputShape: []int{1, 1000},
 		Classes:     s.getImageNetClasses(),
+		Embedding:   true,
 	}
 
 	// Store the mock model
@@ -65,16 +70,58 @@ func (s *MockTensorFlowService) LoadModel(modelPath string, modelID string) erro
 	}
 
 	s.models[modelID] = mockModel
+	metrics.ModelLoadEvent(modelID, metrics.EngineTensorFlow, "loaded")
 	s.logger.Infof("Mock: Successfully loaded TensorFlow model: %s", modelID)
 
 	return nil
 }
 
 // Predict simulates TensorFlow inference
-func (s *MockTensorFlowService) Predict(modelID string, imageData [][]float32) ([]float32, error) {
+func (s *MockTensorFlowService) Predict(ctx context.Context, modelID string, imageData [][]float32) ([]float32, error) {
+	_, span := tracing.StartSpan(ctx, "TensorFlow.Predict",
+		attribute.String("model.id", modelID),
+		attribute.String("inference.engine", metrics.EngineTensorFlow),
+	)
+	defer span.End()
+
+	if len(imageData) == 0 {
+		return nil, fmt.Errorf("no image data provided")
+	}
+
+	outputs, err := s.predict(ctx, modelID, imageData[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	return outputs[0], nil
+}
+
+// PredictBatch simulates TensorFlow inference over a batch of image tensors,
+// returning one row of predictions per input
+func (s *MockTensorFlowService) PredictBatch(ctx context.Context, modelID string, batch [][]float32) ([][]float32, error) {
+	_, span := tracing.StartSpan(ctx, "TensorFlow.PredictBatch",
+		attribute.String("model.id", modelID),
+		attribute.String("inference.engine", metrics.EngineTensorFlow),
+		attribute.Int("batch.size", len(batch)),
+	)
+	defer span.End()
+
+	if len(batch) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+
+	return s.predict(ctx, modelID, batch)
+}
+
+// predict runs the mock model over each tensor in the batch
+func (s *MockTensorFlowService) predict(ctx context.Context, modelID string, batch [][]float32) ([][]float32, error) {
 	s.modelsMutex.RLock()
 	defer s.modelsMutex.RUnlock()
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	mockModel, exists := s.models[modelID]
 	if !exists {
 		return nil, fmt.Errorf("mock model not found: %s", modelID)
@@ -84,21 +131,92 @@ func (s *MockTensorFlowService) Predict(modelID string, imageData [][]float32) (
 		return nil, fmt.Errorf("mock model not available: %s", modelID)
 	}
 
-	s.logger.Debugf("Mock: Running inference on model %s", modelID)
+	s.logger.Debugf("Mock: Running inference on model %s (batch size %d)", modelID, len(batch))
 
 	// Generate mock predictions (simulate ImageNet-style output)
 	numClasses := len(mockModel.Info.Classes)
-	predictions := make([]float32, numClasses)
-	
-	// Generate pseudo-random but deterministic predictions
-	seed := float32(len(imageData[0]) % 1000)
-	for i := 0; i < numClasses; i++ {
-		// Simple pseudo-random generation
-		val := float32(i+1) * seed * 0.001
-		predictions[i] = float32(1.0 / (1.0 + math.Exp(-float64(val)))) // Sigmoid-like activation
+	outputs := make([][]float32, len(batch))
+	for b, tensor := range batch {
+		predictions := make([]float32, numClasses)
+
+		// Generate pseudo-random but deterministic predictions
+		seed := float32(len(tensor) % 1000)
+		for i := 0; i < numClasses; i++ {
+			// Simple pseudo-random generation
+			val := float32(i+1) * seed * 0.001
+			predictions[i] = float32(1.0 / (1.0 + math.Exp(-float64(val)))) // Sigmoid-like activation
+		}
+		outputs[b] = predictions
+	}
+
+	return outputs, nil
+}
+
+// Embed simulates reading a model's penultimate layer, returning an
+// embedding of the first image tensor
+func (s *MockTensorFlowService) Embed(ctx context.Context, modelID string, imageData [][]float32) ([]float32, error) {
+	_, span := tracing.StartSpan(ctx, "TensorFlow.Embed",
+		attribute.String("model.id", modelID),
+		attribute.String("inference.engine", metrics.EngineTensorFlow),
+	)
+	defer span.End()
+
+	if len(imageData) == 0 {
+		return nil, fmt.Errorf("no image data provided")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.modelsMutex.RLock()
+	mockModel, exists := s.models[modelID]
+	s.modelsMutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("mock model not found: %s", modelID)
+	}
+	if !mockModel.Available {
+		return nil, fmt.Errorf("mock model not available: %s", modelID)
+	}
+
+	shape := mockModel.Info.InputShape
+	return poolEmbedding(imageData[0], shape[len(shape)-3], shape[len(shape)-2], shape[len(shape)-1])
+}
+
+// embeddingGrid is the number of cells per side the mock embedding pools
+// an image into
+const embeddingGrid = 4
+
+// poolEmbedding average-pools an HWC image tensor over a grid of cells,
+// giving one value per cell and channel. It stands in for the embedding
+// layer of a real model: images with similar layout and colors get
+// similar embeddings.
+func poolEmbedding(tensor []float32, height, width, channels int) ([]float32, error) {
+	if len(tensor) != height*width*channels {
+		return nil, fmt.Errorf("tensor has %d values, expected %dx%dx%d", len(tensor), height, width, channels)
+	}
+
+	embedding := make([]float32, embeddingGrid*embeddingGrid*channels)
+	counts := make([]int, embeddingGrid*embeddingGrid)
+	for y := 0; y < height; y++ {
+		row := y * embeddingGrid / height
+		for x := 0; x < width; x++ {
+			cell := row*embeddingGrid + x*embeddingGrid/width
+			counts[cell]++
+			for c := 0; c < channels; c++ {
+				embedding[cell*channels+c] += tensor[(y*width+x)*channels+c]
+			}
+		}
+	}
+	for cell, count := range counts {
+		if count == 0 {
+			continue
+		}
+		for c := 0; c < channels; c++ {
+			embedding[cell*channels+c] /= float32(count)
+		}
 	}
 
-	return predictions, nil
+	return embedding, nil
 }
 
 // GetModel returns a mock TensorFlow model
@@ -138,6 +256,7 @@ func (s *MockTensorFlowService) UnloadModel(modelID string) error {
 	}
 
 	delete(s.models, modelID)
+	metrics.ModelLoadEvent(modelID, metrics.EngineTensorFlow, "unloaded")
 	s.logger.Infof("Mock: Unloaded TensorFlow model: %s", modelID)
 
 	return nil
@@ -149,6 +268,7 @@ func (s *MockTensorFlowService) Close() {
 	defer s.modelsMutex.Unlock()
 
 	for modelID := range s.models {
+		metrics.ModelLoadEvent(modelID, metrics.EngineTensorFlow, "unloaded")
 		s.logger.Infof("Mock: Closed TensorFlow model: %s", modelID)
 	}
 
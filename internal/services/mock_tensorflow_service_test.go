@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"testing"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/sirupsen/logrus"
 )
 
 func TestNewTensorFlowService(t *testing.T) {
@@ -14,7 +16,7 @@ func TestNewTensorFlowService(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	if service == nil {
 		t.Fatal("Expected service to be created")
 	}
@@ -36,7 +38,7 @@ func TestMockTensorFlowLoadModel(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	
 	err := service.LoadModel("./testdata/demo_model", "test_model")
 	if err != nil {
@@ -62,7 +64,7 @@ func TestMockTensorFlowGetModel(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	
 	// Load a model first
 	err := service.LoadModel("./testdata/demo_model", "test_model")
@@ -100,7 +102,7 @@ func TestMockTensorFlowPredict(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	
 	// Load a model first
 	err := service.LoadModel("./testdata/demo_model", "test_model")
@@ -119,7 +121,7 @@ func TestMockTensorFlowPredict(t *testing.T) {
 	}
 
 	// Run prediction
-	predictions, err := service.Predict("test_model", imageData)
+	predictions, err := service.Predict(context.Background(), "test_model", imageData)
 	if err != nil {
 		t.Errorf("Expected prediction to succeed, got error: %v", err)
 	}
@@ -136,7 +138,7 @@ func TestMockTensorFlowPredict(t *testing.T) {
 	}
 
 	// Test prediction with non-existent model
-	_, err = service.Predict("non_existent", imageData)
+	_, err = service.Predict(context.Background(), "non_existent", imageData)
 	if err == nil {
 		t.Error("Expected error for non-existent model")
 	}
@@ -150,7 +152,7 @@ func TestMockTensorFlowUnloadModel(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	
 	// Load a model first
 	err := service.LoadModel("./testdata/demo_model", "test_model")
@@ -191,7 +193,7 @@ func TestMockTensorFlowClose(t *testing.T) {
 		},
 	}
 
-	service := NewTensorFlowService(cfg)
+	service := NewTensorFlowService(cfg, logrus.New())
 	
 	// Load multiple models
 	if err := service.LoadModel("./testdata/demo_model1", "test_model1"); err != nil {
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// RoutingHints identify a request to the model router. Key keeps a client
+// on the same variant of the traffic split; Override names the model to use
+// instead of the split.
+type RoutingHints struct {
+	Key      string `json:"key,omitempty"`
+	Override string `json:"override,omitempty"`
+}
+
+type routingHintsKey struct{}
+
+// WithRoutingHints returns a context carrying the routing hints of a request
+func WithRoutingHints(ctx context.Context, hints RoutingHints) context.Context {
+	return context.WithValue(ctx, routingHintsKey{}, hints)
+}
+
+// RoutingHintsFromContext returns the routing hints carried by ctx
+func RoutingHintsFromContext(ctx context.Context) RoutingHints {
+	hints, _ := ctx.Value(routingHintsKey{}).(RoutingHints)
+	return hints
+}
+
+// routeDecision is the routing of a request, made once and carried in its
+// context so every later step serves the same variant
+type routeDecision struct {
+	requested string
+	modelID   string
+	routing   *models.RoutingInfo
+}
+
+type routeDecisionKey struct{}
+
+// modelRoute is one variant of the traffic split
+type modelRoute struct {
+	modelID string
+	weight  int
+}
+
+// variantCounters accumulates the outcomes of requests routed to a variant
+type variantCounters struct {
+	requests        int64
+	errors          int64
+	totalTime       float64
+	totalConfidence float64
+}
+
+// SetRoutingWeights replaces the traffic split for requests without a
+// model_id. Variants are ordered by model ID so that shifting weight
+// between two variants only moves the clients on the boundary.
+func (s *ModelService) SetRoutingWeights(weights map[string]int) {
+	routes := make([]modelRoute, 0, len(weights))
+	total := 0
+	for modelID, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		if _, err := s.GetModel(modelID); err != nil {
+			s.logger.Warnf("Routing weight set for model that is not loaded: %s", modelID)
+		}
+		routes = append(routes, modelRoute{modelID: modelID, weight: weight})
+		total += weight
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].modelID < routes[j].modelID
+	})
+
+	s.routingMutex.Lock()
+	defer s.routingMutex.Unlock()
+	s.routes = routes
+	s.totalWeight = total
+}
+
+// HasSplit reports whether requests without a model_id are split between variants
+func (s *ModelService) HasSplit() bool {
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+	return s.totalWeight > 0
+}
+
+// WithRoute routes a request for modelID and returns a context carrying
+// the decision along with the chosen model. Later Route calls for the same
+// request reuse it, so a handler can take the inference slot of the very
+// variant the prediction runs on.
+func (s *ModelService) WithRoute(ctx context.Context, modelID string) (context.Context, string) {
+	resolved, routing := s.Route(ctx, modelID)
+	return context.WithValue(ctx, routeDecisionKey{}, routeDecision{
+		requested: modelID,
+		modelID:   resolved,
+		routing:   routing,
+	}), resolved
+}
+
+// Route chooses the model serving a request for modelID. A decision made
+// by WithRoute for the same request is reused. An explicit model is used
+// as is and returns no routing info. Otherwise a loaded override model
+// wins, then the split picks a variant by hashing the routing key, so a
+// client keeps its variant, and without a split the default model serves
+// the request.
+func (s *ModelService) Route(ctx context.Context, modelID string) (string, *models.RoutingInfo) {
+	if decision, ok := ctx.Value(routeDecisionKey{}).(routeDecision); ok && decision.requested == modelID {
+		return decision.modelID, decision.routing
+	}
+	if modelID != "" {
+		return modelID, nil
+	}
+
+	hints := RoutingHintsFromContext(ctx)
+	if hints.Override != "" {
+		if _, err := s.GetModel(hints.Override); err == nil {
+			return hints.Override, &models.RoutingInfo{Variant: hints.Override, Reason: models.RouteOverride}
+		}
+	}
+
+	s.routingMutex.RLock()
+	routes, total := s.routes, s.totalWeight
+	s.routingMutex.RUnlock()
+
+	if total > 0 {
+		var point int
+		if hints.Key != "" {
+			h := fnv.New64a()
+			h.Write([]byte(hints.Key))
+			point = int(h.Sum64() % uint64(total))
+		} else {
+			point = rand.IntN(total)
+		}
+		for _, route := range routes {
+			if point < route.weight {
+				return route.modelID, &models.RoutingInfo{Variant: route.modelID, Reason: models.RouteSplit}
+			}
+			point -= route.weight
+		}
+	}
+
+	s.modelsMutex.RLock()
+	defaultModel := s.defaultModel
+	s.modelsMutex.RUnlock()
+	return defaultModel, &models.RoutingInfo{Variant: defaultModel, Reason: models.RouteDefault}
+}
+
+// RecordRoute records the outcome of a routed request for the variant
+// comparison. Requests with an explicit model are not recorded.
+func (s *ModelService) RecordRoute(routing *models.RoutingInfo, processingTime, confidence float64, success bool) {
+	if routing == nil {
+		return
+	}
+	metrics.ModelRouted(routing.Variant, routing.Reason)
+
+	s.routingMutex.Lock()
+	defer s.routingMutex.Unlock()
+
+	counters, ok := s.variants[routing.Variant]
+	if !ok {
+		counters = &variantCounters{}
+		s.variants[routing.Variant] = counters
+	}
+	counters.requests++
+	if !success {
+		counters.errors++
+		return
+	}
+	counters.totalTime += processingTime
+	counters.totalConfidence += confidence
+}
+
+// VariantStats returns the weight and outcomes of each variant in the split
+// or that has served routed requests, ordered by model ID
+func (s *ModelService) VariantStats() []models.VariantStats {
+	s.routingMutex.RLock()
+	defer s.routingMutex.RUnlock()
+
+	weights := make(map[string]int, len(s.routes))
+	for _, route := range s.routes {
+		weights[route.modelID] = route.weight
+	}
+
+	var stats []models.VariantStats
+	for modelID := range s.variants {
+		if _, ok := weights[modelID]; !ok {
+			weights[modelID] = 0
+		}
+	}
+	for modelID, weight := range weights {
+		variant := models.VariantStats{ModelID: modelID, Weight: weight}
+		if counters, ok := s.variants[modelID]; ok {
+			variant.Requests = counters.requests
+			variant.Errors = counters.errors
+			if succeeded := counters.requests - counters.errors; succeeded > 0 {
+				variant.AvgTime = counters.totalTime / float64(succeeded)
+				variant.MeanConfidence = counters.totalConfidence / float64(succeeded)
+			}
+		}
+		stats = append(stats, variant)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ModelID < stats[j].ModelID
+	})
+
+	return stats
+}
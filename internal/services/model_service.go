@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
 	"github.com/sirupsen/logrus"
 )
@@ -21,6 +23,12 @@ type ModelService struct {
 	models       map[string]*LoadedModel
 	modelsMutex  sync.RWMutex
 	defaultModel string
+
+	// Traffic split for requests without a model_id, see model_routing.go
+	routingMutex sync.RWMutex
+	routes       []modelRoute
+	totalWeight  int
+	variants     map[string]*variantCounters
 }
 
 // LoadedModel represents a loaded ML model
@@ -31,20 +39,33 @@ type LoadedModel struct {
 	Predictions int64
 	Errors      int64
 	TotalTime   float64
+	// Taxonomy rolls the model's labels up to broader ones, if the model
+	// directory has a taxonomy.json
+	Taxonomy *Taxonomy
+	// Labels describe the model's classes, if the model directory has a
+	// labels.json
+	Labels *Labels
+	// LabelSet holds the prototypes of a virtual model serving a label set
+	LabelSet *models.LabelSet
+
+	// feedback tallies user feedback by predicted class
+	feedback map[string]*feedbackCounts
 }
 
 // NewModelService creates a new model service
-func NewModelService(cfg *config.Config) *ModelService {
+func NewModelService(cfg *config.Config, logger *logrus.Logger) *ModelService {
 	service := &ModelService{
-		config: cfg,
-		logger: logrus.New(),
-		models: make(map[string]*LoadedModel),
+		config:   cfg,
+		logger:   logger,
+		models:   make(map[string]*LoadedModel),
+		variants: make(map[string]*variantCounters),
 	}
 
 	// Load models on startup
 	if err := service.LoadModels(); err != nil {
 		service.logger.Errorf("Failed to load models on startup: %v", err)
 	}
+	service.SetRoutingWeights(cfg.Model.RoutingWeights)
 
 	return service
 }
@@ -76,6 +97,7 @@ func (s *ModelService) LoadModels() error {
 		modelID := entry.Name()
 		if err := s.loadModel(modelID); err != nil {
 			s.logger.Errorf("Failed to load model %s: %v", modelID, err)
+			metrics.ModelLoadEvent(modelID, metrics.EngineSimulated, "failed")
 			continue
 		}
 		loadedCount++
@@ -112,6 +134,45 @@ func (s *ModelService) loadModel(modelID string) error {
 		metadata = s.createDefaultMetadata(modelID)
 	}
 
+	engine := metrics.EngineSimulated
+	if metadata.Ensemble != nil {
+		if err := validateEnsemble(metadata.Ensemble); err != nil {
+			return fmt.Errorf("invalid ensemble: %w", err)
+		}
+		engine = metrics.EngineEnsemble
+	}
+	if metadata.Rejection != nil {
+		if err := ValidateRejectionRules(metadata.Rejection); err != nil {
+			return fmt.Errorf("invalid rejection rules: %w", err)
+		}
+	}
+	if metadata.Calibration != nil {
+		if metadata.Ensemble != nil {
+			return fmt.Errorf("ensembles are calibrated through their members")
+		}
+		if err := validateCalibration(metadata.Calibration); err != nil {
+			return fmt.Errorf("invalid calibration: %w", err)
+		}
+	}
+
+	var taxonomy *Taxonomy
+	taxonomyPath := filepath.Join(modelDir, taxonomyFile)
+	if _, err := os.Stat(taxonomyPath); err == nil {
+		taxonomy, err = loadTaxonomy(taxonomyPath)
+		if err != nil {
+			return fmt.Errorf("invalid taxonomy: %w", err)
+		}
+	}
+
+	var labels *Labels
+	labelsPath := filepath.Join(modelDir, labelsFile)
+	if _, err := os.Stat(labelsPath); err == nil {
+		labels, err = loadLabels(labelsPath)
+		if err != nil {
+			return fmt.Errorf("invalid labels: %w", err)
+		}
+	}
+
 	// Create loaded model
 	loadedModel := &LoadedModel{
 		Info: *metadata,
@@ -126,9 +187,12 @@ func (s *ModelService) loadModel(modelID string) error {
 		Predictions: 0,
 		Errors:      0,
 		TotalTime:   0,
+		Taxonomy:    taxonomy,
+		Labels:      labels,
 	}
 
 	s.models[modelID] = loadedModel
+	metrics.ModelLoadEvent(modelID, engine, "loaded")
 	s.logger.Infof("Loaded model: %s (version: %s)", metadata.Name, metadata.Version)
 
 	return nil
@@ -206,6 +270,7 @@ func (s *ModelService) createDummyModel() {
 			Classes:     s.getDefaultClasses()[:50],
 			LoadedAt:    time.Now(),
 			Metadata:    map[string]string{"type": "dummy"},
+			Embedding:   true,
 		},
 		Health: models.ModelHealth{
 			Status:      "healthy",
@@ -222,9 +287,47 @@ func (s *ModelService) createDummyModel() {
 
 	s.models["dummy"] = dummyModel
 	s.defaultModel = "dummy"
+	metrics.ModelLoadEvent("dummy", metrics.EngineSimulated, "loaded")
 	s.logger.Info("Created dummy model for development")
 }
 
+// RegisterModel adds or replaces a model that does not live in the model
+// directory, such as a label set. Models loaded from disk cannot be
+// replaced.
+func (s *ModelService) RegisterModel(model *LoadedModel) error {
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+
+	if existing, exists := s.models[model.Info.ID]; exists {
+		if existing.LabelSet == nil {
+			return fmt.Errorf("model %s already exists", model.Info.ID)
+		}
+		// Keep the statistics of the model being replaced
+		model.Health = existing.Health
+		model.LastUsed = existing.LastUsed
+		model.Predictions = existing.Predictions
+		model.Errors = existing.Errors
+		model.TotalTime = existing.TotalTime
+		model.feedback = existing.feedback
+	} else {
+		metrics.ModelLoadEvent(model.Info.ID, metrics.EnginePrototype, "loaded")
+	}
+
+	s.models[model.Info.ID] = model
+	return nil
+}
+
+// UnregisterModel removes a model added by RegisterModel
+func (s *ModelService) UnregisterModel(modelID string) {
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+
+	if model, exists := s.models[modelID]; exists && model.LabelSet != nil {
+		delete(s.models, modelID)
+		metrics.ModelLoadEvent(modelID, metrics.EnginePrototype, "unloaded")
+	}
+}
+
 // GetModel returns a model by ID
 func (s *ModelService) GetModel(modelID string) (*LoadedModel, error) {
 	s.modelsMutex.RLock()
@@ -242,6 +345,13 @@ func (s *ModelService) GetModel(modelID string) (*LoadedModel, error) {
 	return model, nil
 }
 
+// InferenceTimeout returns the inference deadline for a model, falling back
+// to the global default when no per-model override is configured. A zero
+// duration means inference is not bounded.
+func (s *ModelService) InferenceTimeout(modelID string) time.Duration {
+	return time.Duration(s.config.ForModel(modelID).InferenceTimeout) * time.Millisecond
+}
+
 // GetDefaultModel returns the default model
 func (s *ModelService) GetDefaultModel() (*LoadedModel, error) {
 	return s.GetModel(s.defaultModel)
@@ -272,12 +382,46 @@ func (s *ModelService) GetModelStatus() models.ModelStatus {
 	}
 
 	for id, model := range s.models {
-		status.Models[id] = model.Health
+		health := model.Health
+		if len(model.feedback) > 0 {
+			var correct, incorrect int64
+			health.ClassFeedback = make(map[string]models.FeedbackAccuracy, len(model.feedback))
+			for class, counts := range model.feedback {
+				if counts.correct+counts.incorrect == 0 {
+					continue
+				}
+				health.ClassFeedback[class] = feedbackAccuracy(counts.correct, counts.incorrect)
+				correct += counts.correct
+				incorrect += counts.incorrect
+			}
+			if correct+incorrect > 0 {
+				overall := feedbackAccuracy(correct, incorrect)
+				health.Feedback = &overall
+			}
+		}
+		status.Models[id] = health
 	}
 
 	return status
 }
 
+// CheckReady reports an error unless models are loaded and the default
+// model can serve requests
+func (s *ModelService) CheckReady(ctx context.Context) error {
+	s.modelsMutex.RLock()
+	defer s.modelsMutex.RUnlock()
+
+	if len(s.models) == 0 {
+		return fmt.Errorf("no models loaded")
+	}
+
+	if _, exists := s.models[s.defaultModel]; !exists {
+		return fmt.Errorf("default model not loaded: %s", s.defaultModel)
+	}
+
+	return nil
+}
+
 // UpdateModelStats updates model usage statistics
 func (s *ModelService) UpdateModelStats(modelID string, processingTime float64, success bool) {
 	s.modelsMutex.Lock()
@@ -313,6 +457,141 @@ func (s *ModelService) UpdateModelStats(modelID string, processingTime float64,
 	}
 }
 
+// RecordUnknown counts a prediction of a model rejected as unknown
+func (s *ModelService) RecordUnknown(modelID string) {
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+
+	if model, exists := s.models[modelID]; exists {
+		model.Health.Unknown++
+	}
+}
+
+// RecordFeedback counts feedback on a prediction of a model, replacing the
+// previous feedback on the same result if there was any
+func (s *ModelService) RecordFeedback(modelID string, previous, current *models.Feedback) {
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+
+	model, exists := s.models[modelID]
+	if !exists {
+		return
+	}
+	if model.feedback == nil {
+		model.feedback = make(map[string]*feedbackCounts)
+	}
+
+	if previous != nil {
+		if counts, ok := model.feedback[previous.PredictedClass]; ok {
+			counts.add(previous.Rating, -1)
+		}
+	}
+	counts, ok := model.feedback[current.PredictedClass]
+	if !ok {
+		counts = &feedbackCounts{}
+		model.feedback[current.PredictedClass] = counts
+	}
+	counts.add(current.Rating, 1)
+}
+
+// RestoreFeedback rebuilds the feedback counts of loaded models from the
+// results archived in store, replacing any counted so far, and returns the
+// number of results with feedback found
+func (s *ModelService) RestoreFeedback(ctx context.Context, store BlobStore) (int, error) {
+	keys, err := store.List(ctx, resultsPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := make(map[string]map[string]*feedbackCounts)
+	found := 0
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return found, err
+		}
+
+		result, err := loadResult(ctx, store, key)
+		if err != nil {
+			s.logger.Warnf("Skipping unreadable result %s: %v", key, err)
+			continue
+		}
+		if result.Feedback == nil {
+			continue
+		}
+		found++
+
+		byClass, ok := restored[result.ModelInfo.ID]
+		if !ok {
+			byClass = make(map[string]*feedbackCounts)
+			restored[result.ModelInfo.ID] = byClass
+		}
+		counts, ok := byClass[result.Feedback.PredictedClass]
+		if !ok {
+			counts = &feedbackCounts{}
+			byClass[result.Feedback.PredictedClass] = counts
+		}
+		counts.add(result.Feedback.Rating, 1)
+	}
+
+	s.modelsMutex.Lock()
+	defer s.modelsMutex.Unlock()
+	for id, model := range s.models {
+		model.feedback = restored[id]
+	}
+	return found, nil
+}
+
+// LocalizeResult returns a copy of result whose labels are display names
+// in the first of languages the model's labels provide, and the language
+// used, if any. Ensemble predictions take the names of their members.
+func (s *ModelService) LocalizeResult(result *models.PredictionResult, languages []string) (*models.PredictionResult, string) {
+	s.modelsMutex.RLock()
+	defer s.modelsMutex.RUnlock()
+
+	var sources []*Labels
+	if model, exists := s.models[result.ModelInfo.ID]; exists {
+		sources = append(sources, model.Labels)
+	}
+	for _, member := range result.Members {
+		if model, exists := s.models[member.ModelID]; exists {
+			sources = append(sources, model.Labels)
+		}
+	}
+
+	localized := *result
+	var used string
+	localize := func(predictions []models.ClassificationResult, sources []*Labels) []models.ClassificationResult {
+		if len(predictions) == 0 {
+			return predictions
+		}
+		copied := append([]models.ClassificationResult(nil), predictions...)
+		for i := range copied {
+			for _, labels := range sources {
+				if name, language, ok := labels.localizedName(copied[i].ClassName, languages); ok {
+					copied[i].Label = name
+					if used == "" {
+						used = language
+					}
+					break
+				}
+			}
+		}
+		return copied
+	}
+
+	localized.Predictions = localize(result.Predictions, sources)
+	if len(result.Members) > 0 {
+		localized.Members = append([]models.MemberPrediction(nil), result.Members...)
+		for i, member := range localized.Members {
+			if model, exists := s.models[member.ModelID]; exists {
+				localized.Members[i].Predictions = localize(member.Predictions, []*Labels{model.Labels})
+			}
+		}
+	}
+
+	return &localized, used
+}
+
 // IsModelHealthy checks if a model is healthy
 func (s *ModelService) IsModelHealthy(modelID string) bool {
 	s.modelsMutex.RLock()
@@ -331,11 +610,16 @@ func (s *ModelService) ReloadModel(modelID string) error {
 	s.modelsMutex.Lock()
 	defer s.modelsMutex.Unlock()
 
+	if model, exists := s.models[modelID]; exists && model.LabelSet != nil {
+		return fmt.Errorf("model %s is a label set and has nothing to reload", modelID)
+	}
+
 	// Remove existing model
 	delete(s.models, modelID)
 
 	// Reload the model
 	if err := s.loadModel(modelID); err != nil {
+		metrics.ModelLoadEvent(modelID, metrics.EngineSimulated, "failed")
 		return fmt.Errorf("failed to reload model %s: %w", modelID, err)
 	}
 
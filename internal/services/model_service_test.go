@@ -1,9 +1,17 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/sirupsen/logrus"
 )
 
 func TestNewModelService(t *testing.T) {
@@ -14,7 +22,7 @@ func TestNewModelService(t *testing.T) {
 		},
 	}
 
-	service := NewModelService(cfg)
+	service := NewModelService(cfg, logrus.New())
 	if service == nil {
 		t.Fatal("Expected service to be created")
 	}
@@ -36,7 +44,7 @@ func TestModelServiceGetStats(t *testing.T) {
 		},
 	}
 
-	service := NewModelService(cfg)
+	service := NewModelService(cfg, logrus.New())
 	stats := service.GetStats()
 
 	if stats.ModelsLoaded == "" {
@@ -64,7 +72,7 @@ func TestModelServiceGetModel(t *testing.T) {
 		},
 	}
 
-	service := NewModelService(cfg)
+	service := NewModelService(cfg, logrus.New())
 	
 	// Test getting default model (should be dummy)
 	model, err := service.GetDefaultModel()
@@ -91,7 +99,7 @@ func TestModelServiceListModels(t *testing.T) {
 		},
 	}
 
-	service := NewModelService(cfg)
+	service := NewModelService(cfg, logrus.New())
 	models := service.ListModels()
 
 	// Should have at least the dummy model
@@ -108,7 +116,7 @@ func TestModelServiceUpdateStats(t *testing.T) {
 		},
 	}
 
-	service := NewModelService(cfg)
+	service := NewModelService(cfg, logrus.New())
 	
 	// Get default model to update its stats
 	model, err := service.GetDefaultModel()
@@ -134,4 +142,221 @@ func TestModelServiceUpdateStats(t *testing.T) {
 	if updatedModel.Health.AvgTime == 0 {
 		t.Error("Expected average time to be updated")
 	}
-}
\ No newline at end of file
+}
+
+func TestModelServiceRoute(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Path:    "./testdata/models",
+			Version: "1.0.0",
+		},
+	}
+
+	service := NewModelService(cfg, logrus.New())
+	service.models["dummy_v2"] = &LoadedModel{Info: models.ModelInfo{ID: "dummy_v2"}}
+	ctx := context.Background()
+
+	// Without a split requests go to the default model
+	if modelID, routing := service.Route(ctx, ""); modelID != "dummy" || routing.Reason != models.RouteDefault {
+		t.Errorf("Expected default model, got %s (%+v)", modelID, routing)
+	}
+
+	service.SetRoutingWeights(map[string]int{"dummy": 3, "dummy_v2": 1})
+
+	// An explicit model is not routed
+	if modelID, routing := service.Route(ctx, "dummy"); modelID != "dummy" || routing != nil {
+		t.Errorf("Expected explicit model without routing, got %s (%+v)", modelID, routing)
+	}
+
+	// The same key always gets the same variant, and keys follow the weights
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		keyCtx := WithRoutingHints(ctx, RoutingHints{Key: fmt.Sprintf("client-%d", i)})
+		modelID, routing := service.Route(keyCtx, "")
+		if again, _ := service.Route(keyCtx, ""); again != modelID {
+			t.Fatalf("Expected sticky assignment, got %s then %s", modelID, again)
+		}
+		if routing.Reason != models.RouteSplit {
+			t.Fatalf("Expected split routing, got %+v", routing)
+		}
+		counts[modelID]++
+	}
+	if counts["dummy_v2"] < 150 || counts["dummy_v2"] > 350 {
+		t.Errorf("Expected about a quarter of clients on dummy_v2, got %d of 1000", counts["dummy_v2"])
+	}
+
+	// A request routed once keeps its variant, even without a routing key
+	for i := 0; i < 50; i++ {
+		routedCtx, modelID := service.WithRoute(ctx, "")
+		if again, routing := service.Route(routedCtx, ""); again != modelID || routing.Variant != modelID {
+			t.Fatalf("Expected routed request to stay on %s, got %s (%+v)", modelID, again, routing)
+		}
+	}
+
+	// An override of a loaded model bypasses the split; unknown ones are ignored
+	overrideCtx := WithRoutingHints(ctx, RoutingHints{Key: "client-1", Override: "dummy_v2"})
+	if modelID, routing := service.Route(overrideCtx, ""); modelID != "dummy_v2" || routing.Reason != models.RouteOverride {
+		t.Errorf("Expected override to dummy_v2, got %s (%+v)", modelID, routing)
+	}
+	unknownCtx := WithRoutingHints(ctx, RoutingHints{Key: "client-1", Override: "missing"})
+	if _, routing := service.Route(unknownCtx, ""); routing.Reason != models.RouteSplit {
+		t.Errorf("Expected unknown override to fall back to the split, got %+v", routing)
+	}
+
+	service.RecordRoute(&models.RoutingInfo{Variant: "dummy_v2", Reason: models.RouteSplit}, 10, 0.8, true)
+	service.RecordRoute(&models.RoutingInfo{Variant: "dummy_v2", Reason: models.RouteSplit}, 0, 0, false)
+	stats := service.VariantStats()
+	if len(stats) != 2 || stats[1].ModelID != "dummy_v2" || stats[1].Weight != 1 {
+		t.Fatalf("Expected both variants with their weights, got %+v", stats)
+	}
+	if stats[1].Requests != 2 || stats[1].Errors != 1 || stats[1].AvgTime != 10 || stats[1].MeanConfidence != 0.8 {
+		t.Errorf("Expected outcomes of dummy_v2 recorded, got %+v", stats[1])
+	}
+}
+
+func TestModelServiceLoadsTaxonomy(t *testing.T) {
+	dir := t.TempDir()
+	writeModel := func(modelID, taxonomy string) {
+		modelDir := filepath.Join(dir, modelID)
+		if err := os.MkdirAll(modelDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		metadata := fmt.Sprintf(`{"id": %q, "name": %q, "classes": ["tabby", "persian_cat", "beagle", "car"]}`, modelID, modelID)
+		if err := os.WriteFile(filepath.Join(modelDir, "metadata.json"), []byte(metadata), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(modelDir, taxonomyFile), []byte(taxonomy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeModel("pets", `{"tabby": "cat", "persian_cat": "cat", "beagle": "dog", "cat": "animal", "dog": "animal"}`)
+	writeModel("cyclic", `{"cat": "animal", "animal": "cat"}`)
+
+	service := NewModelService(&config.Config{Model: config.ModelConfig{Path: dir}}, logrus.New())
+
+	model, err := service.GetModel("pets")
+	if err != nil {
+		t.Fatalf("Expected model with taxonomy to load, got error: %v", err)
+	}
+	if path := model.Taxonomy.Path("tabby"); fmt.Sprint(path) != "[animal cat tabby]" {
+		t.Errorf("Expected path from the root, got %v", path)
+	}
+	if path := model.Taxonomy.Path("car"); fmt.Sprint(path) != "[car]" {
+		t.Errorf("Expected a label without parents to be its own root, got %v", path)
+	}
+
+	if _, err := service.GetModel("cyclic"); err == nil {
+		t.Error("Expected a model with a cyclic taxonomy not to load")
+	}
+}
+
+func TestModelServiceLabels(t *testing.T) {
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "pets")
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := `{"id": "pets", "name": "Pets", "classes": ["tabby", "tiger_cat"]}`
+	labels := `{"tabby": {
+		"display_name": "Tabby cat",
+		"display_names": {"fr": "Chat tigré", "pt-BR": "Gato malhado"},
+		"description": "A cat with a striped coat",
+		"synonyms": ["tabby cat"],
+		"external_ids": {"wordnet": "n02123045"}
+	}}`
+	if err := os.WriteFile(filepath.Join(modelDir, "metadata.json"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(modelDir, labelsFile), []byte(labels), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewModelService(&config.Config{Model: config.ModelConfig{Path: dir}}, logrus.New())
+	model, err := service.GetModel("pets")
+	if err != nil {
+		t.Fatalf("Expected model with labels to load, got error: %v", err)
+	}
+
+	tabby := models.ClassificationResult{ClassName: "tabby"}
+	model.Labels.describe(&tabby)
+	if tabby.Label != "Tabby cat" || tabby.Description != "A cat with a striped coat" ||
+		tabby.ExternalIDs["wordnet"] != "n02123045" || len(tabby.Synonyms) != 1 {
+		t.Errorf("Expected the class information from labels.json, got %+v", tabby)
+	}
+	tiger := models.ClassificationResult{ClassName: "tiger_cat"}
+	model.Labels.describe(&tiger)
+	if tiger.Label != "tiger cat" {
+		t.Errorf("Expected a readable label for a class without labels, got %q", tiger.Label)
+	}
+
+	result := &models.PredictionResult{
+		ModelInfo:   model.Info,
+		Predictions: []models.ClassificationResult{tabby, tiger},
+	}
+	tests := []struct {
+		languages []string
+		label     string
+		language  string
+	}{
+		{[]string{"fr-CA", "en"}, "Chat tigré", "fr"},
+		{[]string{"de", "pt-BR"}, "Gato malhado", "pt-BR"},
+		{[]string{"de"}, "Tabby cat", ""},
+	}
+	for _, tt := range tests {
+		localized, language := service.LocalizeResult(result, tt.languages)
+		if localized.Predictions[0].Label != tt.label || language != tt.language {
+			t.Errorf("%v: expected %q in %q, got %q in %q",
+				tt.languages, tt.label, tt.language, localized.Predictions[0].Label, language)
+		}
+	}
+	if result.Predictions[0].Label != "Tabby cat" {
+		t.Error("Expected localizing not to change the stored result")
+	}
+}
+
+func TestModelServiceRestoreFeedback(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	archive := func(id, modelID string, feedback *models.Feedback) {
+		data, _ := json.Marshal(&models.PredictionResult{ID: id, ModelInfo: models.ModelInfo{ID: modelID}, Feedback: feedback})
+		if err := store.Put(ctx, ResultKey(id), data, "application/json"); err != nil {
+			t.Fatalf("Failed to archive result: %v", err)
+		}
+	}
+	archive("pred_1", "dummy", &models.Feedback{Rating: models.RatingUp, PredictedClass: "cat"})
+	archive("pred_2", "dummy", &models.Feedback{Rating: models.RatingDown, PredictedClass: "cat", CorrectLabel: "lynx"})
+	archive("pred_3", "dummy", &models.Feedback{Rating: models.RatingUp, PredictedClass: "dog"})
+	archive("pred_4", "dummy", nil)
+	archive("pred_5", "retired", &models.Feedback{Rating: models.RatingUp, PredictedClass: "cat"})
+	if err := store.Put(ctx, ResultKey("pred_6"), []byte("{"), "application/json"); err != nil {
+		t.Fatalf("Failed to archive result: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	service := NewModelService(&config.Config{Model: config.ModelConfig{Path: "./testdata/models"}}, logger)
+	// Counted before the restore and replaced by it
+	service.RecordFeedback("dummy", nil, &models.Feedback{Rating: models.RatingDown, PredictedClass: "dog"})
+
+	restored, err := service.RestoreFeedback(ctx, store)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if restored != 4 {
+		t.Errorf("Expected 4 results with feedback, got %d", restored)
+	}
+
+	health := service.GetModelStatus().Models["dummy"]
+	if health.Feedback == nil || health.Feedback.Ratings != 3 || health.Feedback.Correct != 2 {
+		t.Fatalf("Expected 2 of 3 ratings correct, got %+v", health.Feedback)
+	}
+	if cat := health.ClassFeedback["cat"]; cat.Ratings != 2 || cat.Correct != 1 {
+		t.Errorf("Expected 1 of 2 cat ratings correct, got %+v", cat)
+	}
+	if dog := health.ClassFeedback["dog"]; dog.Ratings != 1 || dog.Correct != 1 {
+		t.Errorf("Expected the restored dog rating only, got %+v", dog)
+	}
+}
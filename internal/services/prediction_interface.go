@@ -1,17 +1,22 @@
 package services
 
 import (
+	"context"
+
 	"github.com/francknouama/image-recognition-webapp/internal/models"
 )
 
 // PredictionServiceInterface defines the interface for prediction services
 type PredictionServiceInterface interface {
 	// PredictImage performs image classification
-	PredictImage(imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error)
+	PredictImage(ctx context.Context, imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error)
 	
 	// GetResult retrieves a prediction result by ID
 	GetResult(resultID string) (*models.PredictionResult, error)
 	
+	// SubmitFeedback records user feedback on a prediction result
+	SubmitFeedback(ctx context.Context, resultID string, request models.FeedbackRequest) (*models.PredictionResult, error)
+	
 	// ListModels returns available models
 	ListModels() []models.ModelInfo
 }
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -9,8 +10,12 @@ import (
 	"sort"
 	"time"
 
+	"github.com/francknouama/image-recognition-webapp/internal/logging"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
 	"github.com/francknouama/image-recognition-webapp/internal/models"
+	"github.com/francknouama/image-recognition-webapp/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // PredictionService handles model inference operations
@@ -22,17 +27,26 @@ type PredictionService struct {
 }
 
 // NewPredictionService creates a new prediction service
-func NewPredictionService(modelService *ModelService, imageService *ImageService) *PredictionService {
+func NewPredictionService(modelService *ModelService, imageService *ImageService, logger *logrus.Logger) *PredictionService {
 	return &PredictionService{
 		modelService: modelService,
 		imageService: imageService,
-		logger:       logrus.New(),
+		logger:       logger,
 		results:      make(map[string]*models.PredictionResult),
 	}
 }
 
 // PredictImage performs image classification prediction
-func (s *PredictionService) PredictImage(imageData []byte, metadata *models.ImageMetadata, modelID string) (*models.PredictionResult, error) {
+func (s *PredictionService) PredictImage(ctx context.Context, imageData []byte, metadata *models.ImageMetadata, modelID string) (_ *models.PredictionResult, err error) {
+	ctx, span := tracing.StartSpan(ctx, "PredictionService.PredictImage",
+		attribute.String("model.requested_id", modelID),
+		attribute.String("inference.engine", metrics.EngineSimulated),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	startTime := time.Now()
 	
 	// Get model
@@ -41,6 +55,14 @@ func (s *PredictionService) PredictImage(imageData []byte, metadata *models.Imag
 		return nil, fmt.Errorf("failed to get model: %w", err)
 	}
 
+	// Bound preprocessing and inference by the model's deadline
+	timeout := s.modelService.InferenceTimeout(model.Info.ID)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// Decode image for preprocessing
 	img, _, err := s.imageService.decodeImage(bytes.NewReader(imageData))
 	if err != nil {
@@ -54,9 +76,14 @@ func (s *PredictionService) PredictImage(imageData []byte, metadata *models.Imag
 	}
 
 	// Perform prediction (simulated for now since we don't have actual TensorFlow integration)
-	predictions, err := s.performInference(processedData, model)
+	inferenceStart := time.Now()
+	predictions, err := s.performInference(ctx, processedData, model)
+	metrics.ObserveInference(model.Info.ID, metrics.EngineSimulated, time.Since(inferenceStart))
 	if err != nil {
 		s.modelService.UpdateModelStats(model.Info.ID, 0, false)
+		if ctx.Err() != nil {
+			return nil, inferenceError(ctx, model.Info.ID, timeout, err)
+		}
 		return nil, fmt.Errorf("inference failed: %w", err)
 	}
 
@@ -74,21 +101,27 @@ func (s *PredictionService) PredictImage(imageData []byte, metadata *models.Imag
 		ProcessedAt: time.Now(),
 		ProcessTime: processingTime,
 		ModelInfo:   model.Info,
+		RequestID:   logging.RequestIDFromContext(ctx),
+		Engine:      metrics.EngineSimulated,
 	}
 
 	// Store result for later retrieval
 	s.results[resultID] = result
 
-	s.logger.Infof("Prediction completed: %s (%.2fms, model: %s)", 
+	logging.FromContext(ctx, s.logger).Infof("Prediction completed: %s (%.2fms, model: %s)", 
 		resultID, processingTime, model.Info.Name)
 
 	return result, nil
 }
 
 // performInference simulates model inference (placeholder for actual TensorFlow integration)
-func (s *PredictionService) performInference(imageData []byte, model *LoadedModel) ([]models.ClassificationResult, error) {
-	// Simulate processing time
-	time.Sleep(time.Millisecond * 100)
+func (s *PredictionService) performInference(ctx context.Context, imageData []byte, model *LoadedModel) ([]models.ClassificationResult, error) {
+	// Simulate processing time, giving up early if the request is canceled
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
 	// Generate simulated predictions
 	predictions := make([]models.ClassificationResult, 0, 5)
@@ -106,8 +139,8 @@ func (s *PredictionService) performInference(imageData []byte, model *LoadedMode
 		if confidence > 0.01 { // Only include predictions with >1% confidence
 			predictions = append(predictions, models.ClassificationResult{
 				ClassName:   class,
-				Label:       class,
-				Description: s.getClassDescription(class),
+				Label:       displayName(class),
+				Description: defaultClassDescriptions[class],
 				Confidence:  confidence,
 				Probability: confidence, // For now, confidence and probability are the same
 			})
@@ -168,38 +201,9 @@ func (s *PredictionService) normalizeProbabilities(predictions []models.Classifi
 	}
 }
 
-// getClassDescription returns a description for a class name
-func (s *PredictionService) getClassDescription(className string) string {
-	descriptions := map[string]string{
-		"cat":        "A small domestic feline mammal",
-		"dog":        "A domestic canine companion animal",
-		"bird":       "A feathered, winged, bipedal animal",
-		"car":        "A four-wheeled motor vehicle",
-		"truck":      "A large motor vehicle for transporting goods",
-		"airplane":   "A powered flying vehicle with wings",
-		"boat":       "A watercraft designed for travel on water",
-		"train":      "A connected series of railway cars",
-		"bicycle":    "A two-wheeled vehicle powered by pedaling",
-		"motorcycle": "A two-wheeled motor vehicle",
-		"person":     "A human being",
-		"horse":      "A large domesticated ungulate mammal",
-		"sheep":      "A woolly ruminant mammal",
-		"cow":        "A large domesticated bovine animal",
-		"elephant":   "A large mammal with a trunk",
-		"bear":       "A large omnivorous mammal",
-		"zebra":      "A black and white striped equine",
-		"giraffe":    "A tall African mammal with a long neck",
-	}
-	
-	if desc, exists := descriptions[className]; exists {
-		return desc
-	}
-	
-	return fmt.Sprintf("A %s object or entity", className)
-}
 
 // BatchPredict performs batch prediction on multiple images
-func (s *PredictionService) BatchPredict(requests []models.ImageRequest, modelID string) (*models.BatchPredictionResponse, error) {
+func (s *PredictionService) BatchPredict(ctx context.Context, requests []models.ImageRequest, modelID string) (*models.BatchPredictionResponse, error) {
 	startTime := time.Now()
 	
 	response := &models.BatchPredictionResponse{
@@ -216,7 +220,7 @@ func (s *PredictionService) BatchPredict(requests []models.ImageRequest, modelID
 		}
 
 		// Perform prediction
-		result, err := s.PredictImage(req.Data, metadata, modelID)
+		result, err := s.PredictImage(ctx, req.Data, metadata, modelID)
 		if err != nil {
 			response.Errors[req.ID] = *models.NewErrorResponse(
 				models.ErrorCodePredictionFailed,
@@ -239,12 +243,34 @@ func (s *PredictionService) BatchPredict(requests []models.ImageRequest, modelID
 func (s *PredictionService) GetResult(resultID string) (*models.PredictionResult, error) {
 	result, exists := s.results[resultID]
 	if !exists {
-		return nil, fmt.Errorf("result not found: %s", resultID)
+		metrics.CacheMiss("results")
+		return nil, fmt.Errorf("%w: %s", ErrResultNotFound, resultID)
 	}
 
+	metrics.CacheHit("results")
 	return result, nil
 }
 
+// SubmitFeedback records user feedback on a result, replacing earlier feedback
+func (s *PredictionService) SubmitFeedback(ctx context.Context, resultID string, request models.FeedbackRequest) (*models.PredictionResult, error) {
+	result, err := s.GetResult(resultID)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := newFeedback(result, request)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *result
+	updated.Feedback = feedback
+	s.results[resultID] = &updated
+
+	s.modelService.RecordFeedback(updated.ModelInfo.ID, result.Feedback, feedback)
+	metrics.PredictionFeedback(updated.ModelInfo.ID, feedback.Rating)
+	return &updated, nil
+}
+
 // GetTopPrediction returns the top prediction result
 func (s *PredictionService) GetTopPrediction(result *models.PredictionResult) *models.ClassificationResult {
 	if len(result.Predictions) == 0 {
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+type rejectionRulesKey struct{}
+
+// WithRejectionRules returns a context carrying rejection rules that
+// replace the model's for one request
+func WithRejectionRules(ctx context.Context, rules *models.RejectionRules) context.Context {
+	if rules == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rejectionRulesKey{}, rules)
+}
+
+// rejectionRulesFromContext returns the request's rejection rules, if any
+func rejectionRulesFromContext(ctx context.Context) (*models.RejectionRules, bool) {
+	rules, ok := ctx.Value(rejectionRulesKey{}).(*models.RejectionRules)
+	return rules, ok
+}
+
+// ValidateRejectionRules checks that every threshold is between 0 and 1
+func ValidateRejectionRules(rules *models.RejectionRules) error {
+	thresholds := []struct {
+		name  string
+		value float64
+	}{
+		{"min_confidence", rules.MinConfidence},
+		{"min_margin", rules.MinMargin},
+		{"max_entropy", rules.MaxEntropy},
+	}
+	for _, threshold := range thresholds {
+		if threshold.value < 0 || threshold.value > 1 || math.IsNaN(threshold.value) {
+			return fmt.Errorf("%s must be between 0 and 1, got %g", threshold.name, threshold.value)
+		}
+	}
+	return nil
+}
+
+// evaluateRejection applies rules to predictions sorted by confidence and
+// returns the first rule they fail, or nil when they are accepted
+func evaluateRejection(rules *models.RejectionRules, predictions []models.ClassificationResult) *models.Rejection {
+	if rules == nil || len(predictions) == 0 {
+		return nil
+	}
+
+	top := predictions[0].Confidence
+	if rules.MinConfidence > 0 && top < rules.MinConfidence {
+		return &models.Rejection{Reason: models.RejectLowConfidence, Value: top, Threshold: rules.MinConfidence}
+	}
+
+	if rules.MinMargin > 0 {
+		margin := top
+		if len(predictions) > 1 {
+			margin -= predictions[1].Confidence
+		}
+		if margin < rules.MinMargin {
+			return &models.Rejection{Reason: models.RejectLowMargin, Value: margin, Threshold: rules.MinMargin}
+		}
+	}
+
+	if rules.MaxEntropy > 0 {
+		if entropy := normalizedEntropy(predictions); entropy > rules.MaxEntropy {
+			return &models.Rejection{Reason: models.RejectHighEntropy, Value: entropy, Threshold: rules.MaxEntropy}
+		}
+	}
+
+	return nil
+}
+
+// normalizedEntropy returns the entropy of the predictions' confidences,
+// renormalized over the reported classes and divided by its maximum, so 0
+// is a single certain class and 1 is a uniform spread
+func normalizedEntropy(predictions []models.ClassificationResult) float64 {
+	if len(predictions) < 2 {
+		return 0
+	}
+
+	var total float64
+	for _, pred := range predictions {
+		total += pred.Confidence
+	}
+	if total <= 0 {
+		return 1
+	}
+
+	var entropy float64
+	for _, pred := range predictions {
+		if p := pred.Confidence / total; p > 0 {
+			entropy -= p * math.Log(p)
+		}
+	}
+	return entropy / math.Log(float64(len(predictions)))
+}
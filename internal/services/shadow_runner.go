@@ -0,0 +1,185 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+	"github.com/francknouama/image-recognition-webapp/internal/metrics"
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// maxShadowDisagreements is how many recent disagreements are kept per candidate
+const maxShadowDisagreements = 20
+
+// ShadowRunner holds the candidate models run in the background on live
+// traffic and compares their top-1 predictions and latency with the model
+// that served each request. Shadows are best effort: when all slots are
+// busy a request is not shadowed.
+type ShadowRunner struct {
+	slots chan struct{}
+
+	mu         sync.RWMutex
+	models     []string
+	candidates map[string]*shadowCounters
+}
+
+// shadowCounters accumulates the comparisons of one candidate model
+type shadowCounters struct {
+	compared      int64
+	agreements    int64
+	failures      int64
+	skipped       int64
+	primaryTime   float64
+	shadowTime    float64
+	disagreements []models.ShadowDisagreement
+}
+
+// NewShadowRunner creates a shadow runner for the configured candidates
+func NewShadowRunner(cfg *config.Config) *ShadowRunner {
+	runner := &ShadowRunner{
+		slots:      make(chan struct{}, max(cfg.Model.ShadowMaxConcurrent, 1)),
+		candidates: make(map[string]*shadowCounters),
+	}
+	runner.SetModels(cfg.Model.ShadowModels)
+	return runner
+}
+
+// SetModels replaces the candidate models. Statistics of earlier
+// candidates are kept for the report.
+func (r *ShadowRunner) SetModels(modelIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.models = append([]string(nil), modelIDs...)
+	for _, modelID := range modelIDs {
+		if _, ok := r.candidates[modelID]; !ok {
+			r.candidates[modelID] = &shadowCounters{}
+		}
+	}
+}
+
+// Models returns the current candidate models
+func (r *ShadowRunner) Models() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models
+}
+
+// acquire takes a shadow slot without waiting, counting the candidate as
+// skipped when none is free. A successful acquire must be released.
+func (r *ShadowRunner) acquire(modelID string) bool {
+	select {
+	case r.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	metrics.ShadowComparison(modelID, "skipped")
+	r.mu.Lock()
+	r.counters(modelID).skipped++
+	r.mu.Unlock()
+	return false
+}
+
+// release frees a shadow slot
+func (r *ShadowRunner) release() {
+	<-r.slots
+}
+
+// recordFailure counts a shadow inference that did not produce predictions
+func (r *ShadowRunner) recordFailure(modelID string) {
+	metrics.ShadowComparison(modelID, "error")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters(modelID).failures++
+}
+
+// record compares a shadow prediction with the primary result, given the
+// primary engine time in milliseconds, and reports whether their top-1
+// classes agree
+func (r *ShadowRunner) record(primary *models.PredictionResult, shadow models.ShadowPrediction, primaryTime float64) bool {
+	primaryTop := primary.Predictions[0]
+	var shadowTop models.ClassificationResult
+	if len(shadow.Predictions) > 0 {
+		shadowTop = shadow.Predictions[0]
+	}
+	agrees := shadowTop.ClassName == primaryTop.ClassName
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counters := r.counters(shadow.ModelID)
+	counters.compared++
+	counters.primaryTime += primaryTime
+	counters.shadowTime += shadow.ProcessTime
+	if agrees {
+		counters.agreements++
+		metrics.ShadowComparison(shadow.ModelID, "agree")
+		return true
+	}
+
+	metrics.ShadowComparison(shadow.ModelID, "disagree")
+	disagreement := models.ShadowDisagreement{
+		ResultID:          primary.ID,
+		PrimaryModel:      primary.ModelInfo.ID,
+		PrimaryClass:      primaryTop.ClassName,
+		PrimaryConfidence: primaryTop.Confidence,
+		ShadowClass:       shadowTop.ClassName,
+		ShadowConfidence:  shadowTop.Confidence,
+		At:                time.Now(),
+	}
+	// Newest first, keeping only the most recent examples
+	counters.disagreements = append([]models.ShadowDisagreement{disagreement}, counters.disagreements...)
+	if len(counters.disagreements) > maxShadowDisagreements {
+		counters.disagreements = counters.disagreements[:maxShadowDisagreements]
+	}
+	return false
+}
+
+// counters returns the counters of a candidate, creating them if needed.
+// The caller must hold r.mu.
+func (r *ShadowRunner) counters(modelID string) *shadowCounters {
+	counters, ok := r.candidates[modelID]
+	if !ok {
+		counters = &shadowCounters{}
+		r.candidates[modelID] = counters
+	}
+	return counters
+}
+
+// Report returns the comparison of every candidate that has been configured
+func (r *ShadowRunner) Report() models.ShadowReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := models.ShadowReport{
+		Models:     append([]string{}, r.models...),
+		Candidates: make([]models.ShadowCandidate, 0, len(r.candidates)),
+	}
+	for modelID, counters := range r.candidates {
+		candidate := models.ShadowCandidate{
+			ModelID:       modelID,
+			Compared:      counters.compared,
+			Agreements:    counters.agreements,
+			Failures:      counters.failures,
+			Skipped:       counters.skipped,
+			Disagreements: append([]models.ShadowDisagreement{}, counters.disagreements...),
+		}
+		if counters.compared > 0 {
+			compared := float64(counters.compared)
+			candidate.AgreementRate = float64(counters.agreements) / compared
+			candidate.MeanPrimaryLatency = counters.primaryTime / compared
+			candidate.MeanShadowLatency = counters.shadowTime / compared
+			candidate.MeanLatencyDelta = candidate.MeanShadowLatency - candidate.MeanPrimaryLatency
+		}
+		report.Candidates = append(report.Candidates, candidate)
+	}
+	sort.Slice(report.Candidates, func(i, j int) bool {
+		return report.Candidates[i].ModelID < report.Candidates[j].ModelID
+	})
+
+	return report
+}
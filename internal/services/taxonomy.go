@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/francknouama/image-recognition-webapp/internal/models"
+)
+
+// taxonomyFile is the name of the optional taxonomy in a model directory
+const taxonomyFile = "taxonomy.json"
+
+// Taxonomy links labels to their parent labels, WordNet style, so that
+// fine-grained classes such as "tabby" can be reported as "cat" or
+// "animal". Labels without a parent are roots.
+type Taxonomy struct {
+	parents map[string]string
+}
+
+// NewTaxonomy creates a taxonomy from child to parent links, rejecting
+// cycles
+func NewTaxonomy(parents map[string]string) (*Taxonomy, error) {
+	for label := range parents {
+		seen := map[string]bool{label: true}
+		for parent, ok := parents[label]; ok; parent, ok = parents[parent] {
+			if seen[parent] {
+				return nil, fmt.Errorf("taxonomy has a cycle through %q", label)
+			}
+			seen[parent] = true
+		}
+	}
+	return &Taxonomy{parents: parents}, nil
+}
+
+// loadTaxonomy reads a JSON object of child to parent links
+func loadTaxonomy(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var parents map[string]string
+	if err := json.Unmarshal(data, &parents); err != nil {
+		return nil, fmt.Errorf("failed to parse taxonomy: %w", err)
+	}
+	return NewTaxonomy(parents)
+}
+
+// Path returns the labels from the root of the taxonomy down to label
+func (t *Taxonomy) Path(label string) []string {
+	path := []string{label}
+	for parent, ok := t.parents[label]; ok; parent, ok = t.parents[parent] {
+		path = append(path, parent)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+type rollupDepthKey struct{}
+
+// WithRollupDepth returns a context asking for predictions rolled up to
+// depth in the model's taxonomy, where 0 is the root
+func WithRollupDepth(ctx context.Context, depth *int) context.Context {
+	if depth == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rollupDepthKey{}, *depth)
+}
+
+// rollupDepthFromContext returns the requested roll-up depth, if any
+func rollupDepthFromContext(ctx context.Context) (int, bool) {
+	depth, ok := ctx.Value(rollupDepthKey{}).(int)
+	return depth, ok
+}
+
+// rollUp replaces each prediction deeper than depth by its ancestor at
+// depth, described by labels, and sums the scores of predictions sharing an
+// ancestor. Summed confidences are capped at 1, since per-class calibration
+// does not keep them a distribution. The result is sorted by confidence.
+func (t *Taxonomy) rollUp(predictions []models.ClassificationResult, depth int, labels *Labels) []models.ClassificationResult {
+	var rolled []models.ClassificationResult
+	index := make(map[string]int)
+
+	for _, pred := range predictions {
+		path := t.Path(pred.ClassName)
+		if len(path) > depth+1 {
+			path = path[:depth+1]
+		}
+		label := path[len(path)-1]
+
+		i, ok := index[label]
+		if !ok {
+			i = len(rolled)
+			index[label] = i
+			rolled = append(rolled, models.ClassificationResult{ClassName: label, Path: path})
+			labels.describe(&rolled[i])
+		}
+		rolled[i].Confidence += pred.Confidence
+		rolled[i].Probability += pred.Probability
+		rolled[i].RawConfidence += pred.RawConfidence
+	}
+
+	for i := range rolled {
+		rolled[i].Confidence = min(rolled[i].Confidence, 1)
+		rolled[i].Probability = min(rolled[i].Probability, 1)
+		rolled[i].RawConfidence = min(rolled[i].RawConfidence, 1)
+	}
+	sort.SliceStable(rolled, func(i, j int) bool {
+		return rolled[i].Confidence > rolled[j].Confidence
+	})
+	return rolled
+}
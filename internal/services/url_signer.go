@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+)
+
+// URLSigner issues and verifies expiring URLs. A signed URL carries its
+// expiry time and an HMAC-SHA256 of the path and expiry, so it grants
+// access to exactly one path until it expires.
+type URLSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewURLSigner creates a signer using the configured key and TTL. Without
+// a configured key a random one is generated.
+func NewURLSigner(cfg *config.Config) (*URLSigner, error) {
+	key := []byte(cfg.Server.URLSigningKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate URL signing key: %w", err)
+		}
+	}
+
+	return &URLSigner{
+		key: key,
+		ttl: time.Duration(cfg.Server.SignedURLTTL) * time.Second,
+		now: time.Now,
+	}, nil
+}
+
+// Sign returns path with "expires" and "signature" query parameters
+func (s *URLSigner) Sign(path string) string {
+	expires := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.signature(path, expires)},
+	}
+	return path + "?" + query.Encode()
+}
+
+// Verify checks the expiry and signature of a signed URL for path and
+// returns when it expires
+func (s *URLSigner) Verify(path, expires, signature string) (time.Time, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(path, expires))) {
+		return time.Time{}, ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+	expiry := time.Unix(unix, 0)
+	if !s.now().Before(expiry) {
+		return time.Time{}, ErrURLExpired
+	}
+	return expiry, nil
+}
+
+func (s *URLSigner) signature(path, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
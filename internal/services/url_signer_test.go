@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francknouama/image-recognition-webapp/internal/config"
+)
+
+func TestURLSigner(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{URLSigningKey: "key", SignedURLTTL: 60}}
+	signer, err := NewURLSigner(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+
+	signed := signer.Sign("/results/pred_1/image")
+	path, rawQuery, _ := strings.Cut(signed, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	expires, signature := query.Get("expires"), query.Get("signature")
+
+	expiry, err := signer.Verify(path, expires, signature)
+	if err != nil {
+		t.Fatalf("Expected valid signature, got: %v", err)
+	}
+	if !expiry.Equal(time.Unix(now.Add(time.Minute).Unix(), 0)) {
+		t.Errorf("Expected expiry one TTL from now, got %v", expiry)
+	}
+
+	// The signature covers the path and the expiry
+	if _, err := signer.Verify("/results/pred_2/image", expires, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another path, got: %v", err)
+	}
+	if _, err := signer.Verify(path, "99999999999", signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for an extended expiry, got: %v", err)
+	}
+
+	// A different key rejects the URL
+	other, _ := NewURLSigner(&config.Config{Server: config.ServerConfig{SignedURLTTL: 60}})
+	if _, err := other.Verify(path, expires, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another key, got: %v", err)
+	}
+
+	signer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, err := signer.Verify(path, expires, signature); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired, got: %v", err)
+	}
+}
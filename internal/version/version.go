@@ -0,0 +1,17 @@
+// Package version holds build information injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/francknouama/image-recognition-webapp/internal/version.Version=v1.2.3 \
+//	  -X github.com/francknouama/image-recognition-webapp/internal/version.Commit=abc1234"
+package version
+
+// Build information, overridden with -ldflags -X
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// String returns a human-readable version string
+func String() string {
+	return Version + " (commit " + Commit + ", built " + BuildTime + ")"
+}